@@ -0,0 +1,96 @@
+package tshelper
+
+// Bouquet Association Table (EN 300 468 5.2.2), table_id 0x4A on PID 0x11, 1 table per
+// bouquet_id.  It is laid out just like the NIT, bouquet descriptors (the name) then a loop of
+// transport streams with the services in each, so the transport stream loop is decoded by
+// nitParse.go.  Bouquets group services from across the network, so like the SDT other they are
+// kept apart from serviceMap and the report picks them up from what was kept of each section
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BATEvent - a BAT section has been parsed.  A big BAT is split over several sections, each
+// with some of the transport streams
+type BATEvent struct {
+	Position
+	BouquetID        uint16
+	BouquetName      string
+	TransportStreams []NITTransportStream
+}
+
+// BouquetReport is the current version of the BAT for 1 bouquet, all its sections put together
+type BouquetReport struct {
+	BouquetID        uint16               `json:"bouquetId"`
+	Name             string               `json:"name"`
+	Version          uint8                `json:"version"`
+	Complete         bool                 `json:"complete"`
+	TransportStreams []NITTransportStream `json:"transportStreams"`
+}
+
+// decode 1 whole BAT section, table_id through CRC.  As much as could be decoded is handed back
+// along with any error
+func parseBATSection(section []byte, decoders *decoderRegistry) (*BATEvent, error) {
+	bat := &BATEvent{BouquetID: (uint16(section[3]) << 8) | uint16(section[4])}
+	bouquetDescriptors, rest, err := lengthPrefixedLoop(section[8 : len(section)-4])
+	if err != nil {
+		return bat, fmt.Errorf("BAT bouquet_descriptors: %v", err)
+	}
+	var textErr error
+	err = forEachDescriptor(bouquetDescriptors, func(tag uint8, body []byte) {
+		if tag == 0x47 {
+			bat.BouquetName, textErr = decodeDVBText(body)
+		}
+	})
+	if err != nil {
+		return bat, fmt.Errorf("BAT bouquet_descriptors: %v", err)
+	}
+	bat.TransportStreams, err = parseTransportStreamLoop(rest, decoders)
+	if textErr != nil {
+		err = worseError(fmt.Errorf("bouquet_name: %w", textErr), err)
+	}
+	if err != nil {
+		return bat, fmt.Errorf("BAT %w", err)
+	}
+	return bat, nil
+}
+
+// parse a BAT section, keep a copy for the report and hand it on
+func (tables tableParser) batParser(pid uint16, section []byte) {
+	event, err := parseBATSection(section, tables.decoders)
+	if err != nil {
+		tables.report.raise(SeverityWarning, tableErrorCode(err), "%v", err)
+	}
+	event.Position = tables.report.position
+	kept := *event
+	kept.TransportStreams = copyTransportStreams(event.TransportStreams)
+	tables.keepDecoded(pid, section, &kept)
+	for _, handler := range tables.report.handlers {
+		handler.OnBAT(event)
+	}
+}
+
+// the bouquet part of a report, put back together from what was kept of each section
+func (tables tableParser) addBATToReport(report *Report) {
+	report.Bouquets = make([]BouquetReport, 0)
+	for key, state := range tables.versions {
+		if key.tableID != uint8(batSection) {
+			continue
+		}
+		bouquet := BouquetReport{BouquetID: key.tableIDExtension, Version: state.version, Complete: state.complete}
+		bouquet.TransportStreams = make([]NITTransportStream, 0)
+		for _, decoded := range state.decoded {
+			bat, isBAT := decoded.(*BATEvent)
+			if !isBAT {
+				continue
+			}
+			if bat.BouquetName != "" {
+				bouquet.Name = bat.BouquetName
+			}
+			bouquet.TransportStreams = append(bouquet.TransportStreams, copyTransportStreams(bat.TransportStreams)...)
+		}
+		report.Bouquets = append(report.Bouquets, bouquet)
+	}
+	sort.Slice(report.Bouquets, func(i, j int) bool { return report.Bouquets[i].BouquetID < report.Bouquets[j].BouquetID })
+}
@@ -0,0 +1,65 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+// BAT section for bouquet 0x5001, bouquet descriptors then transport streams
+func testBAT(sectionNumber, lastSectionNumber uint8, bouquetDescriptors []byte, streams []byte) []byte {
+	body := append(testLoop(bouquetDescriptors), testLoop(streams)...)
+	return testLongSection(0x4a, 0x5001, 0, sectionNumber, lastSectionNumber, body)
+}
+
+func TestBAT(t *testing.T) {
+	first := append([]byte{0, 1, 0, 2}, testLoop([]byte{0x41, 3, 0, 1, 0x01})...)
+	second := append([]byte{0, 3, 0, 4}, testLoop([]byte{0x41, 3, 0, 9, 0x02})...)
+
+	tables, diagnostics, events := testSectionTables()
+	tables.processSection(0x11, testBAT(0, 1, append([]byte{0x47, 2}, "Bq"...), first))
+	tables.processSection(0x11, testBAT(1, 1, nil, second))
+	if len(*diagnostics) != 0 {
+		t.Errorf("diagnostics %v", *diagnostics)
+	}
+	if len(events.bats) != 2 {
+		t.Fatalf("%d BAT events, expected 2", len(events.bats))
+	}
+
+	report := &Report{}
+	tables.addToReport(report)
+	streamOne := NITTransportStream{TransportStreamID: 1, OriginalNetworkID: 2, Services: []NITService{{ServiceID: 1, ServiceType: 0x01}}}
+	streamThree := NITTransportStream{TransportStreamID: 3, OriginalNetworkID: 4, Services: []NITService{{ServiceID: 9, ServiceType: 0x02}}}
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"first section", *events.bats[0], BATEvent{BouquetID: 0x5001, BouquetName: "Bq", TransportStreams: []NITTransportStream{streamOne}}},
+		{"second section", *events.bats[1], BATEvent{BouquetID: 0x5001, TransportStreams: []NITTransportStream{streamThree}}},
+		{"report", report.Bouquets, []BouquetReport{{BouquetID: 0x5001, Name: "Bq", Complete: true, TransportStreams: []NITTransportStream{streamOne, streamThree}}}},
+		{"bouquet services not in serviceMap", len(tables.serviceMap), 0},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+}
+
+func TestBATMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		body []byte
+	}{
+		{"bouquet_descriptors_length too long", []byte{0xf0, 0x20, 0x47, 1, 'B'}},
+		{"bouquet name descriptor too long", []byte{0xf0, 0x03, 0x47, 9, 'B', 0xf0, 0}},
+		{"no transport_stream_loop", []byte{0xf0, 0}},
+		{"transport_stream_loop_length too long", []byte{0xf0, 0, 0xf0, 0x10, 0, 1, 0, 2}},
+		{"transport_descriptors_length too long", []byte{0xf0, 0, 0xf0, 0x06, 0, 1, 0, 2, 0xf0, 0x09}},
+	} {
+		tables, diagnostics, events := testSectionTables()
+		tables.processSection(0x11, testLongSection(0x4a, 0x5001, 0, 0, 0, test.body))
+		if diagnostics.count(DiagBadTable) != 1 || len(events.bats) != 1 {
+			t.Errorf("%s: %d BAT events, diagnostics %v", test.name, len(events.bats), *diagnostics)
+		}
+	}
+}
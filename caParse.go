@@ -0,0 +1,244 @@
+package tshelper
+
+// Conditional access.  The CAT (table_id 0x01 on PID 1) lists a CA_descriptor for every CA system
+// with entitlement (EMM) messages in the stream, each giving the PID they are on.  PMTs carry
+// CA_descriptors too, at program level for the whole service or in a component's ES loop for
+// just that component, and there the PID is the one the ECMs are on.
+// CA_system_IDs are allocated to vendors in blocks (ETSI TS 101 162), so a name can be put to
+// most of them
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CADescriptor is 1 CA_descriptor.  PID is an EMM PID when it comes from the CAT and an ECM PID
+// when it comes from a PMT
+type CADescriptor struct {
+	SystemID    uint16 `json:"systemId"`
+	Vendor      string `json:"vendor"`
+	PID         uint16 `json:"pid"`
+	PrivateData []byte `json:"privateData,omitempty"`
+}
+
+// ServiceCASystem is a CA system protecting a service, or 1 component of it
+type ServiceCASystem struct {
+	CADescriptor
+	ComponentPID uint16 `json:"componentPid,omitempty"` // 0 for the whole service
+}
+
+// CASystemReport is everything known about 1 CA system in the stream
+type CASystemReport struct {
+	SystemID uint16   `json:"systemId"`
+	Vendor   string   `json:"vendor"`
+	EMMPIDs  []uint16 `json:"emmPids"`
+	ECMPIDs  []uint16 `json:"ecmPids"`
+	Services []uint16 `json:"services"` // program numbers
+}
+
+// CATEvent - a CAT section has been parsed
+type CATEvent struct {
+	Position
+	CASystems []CADescriptor
+}
+
+// CA_system_IDs given out individually, or in blocks smaller than 256
+var caSystemNames = map[uint16]string{
+	0x4a10: "EasyCas",
+	0x4a20: "AlphaCrypt",
+	0x4a30: "DVN Holdings",
+	0x4a60: "@Sky (Geocrypt)",
+	0x4a70: "Dreamcrypt",
+	0x4a80: "THALESCrypt",
+	0x4ad0: "XCrypt",
+	0x4ad1: "XCrypt",
+	0x4ae0: "DRE-Crypt",
+	0x4ae1: "DRE-Crypt",
+	0x4aea: "Cryptoguard",
+	0x4b00: "Tongfang",
+	0x5581: "Bulcrypt",
+	0x7be1: "DRE-Crypt",
+}
+
+// CA_system_IDs given out as a block of 256, by the top byte
+var caSystemBlockNames = map[uint8]string{
+	0x01: "Canal+ (Mediaguard)",
+	0x02: "CCETT",
+	0x03: "Kabel Deutschland",
+	0x04: "Eurodec",
+	0x05: "France Telecom (Viaccess)",
+	0x06: "Irdeto",
+	0x07: "Jerrold/GI/Motorola (DigiCipher)",
+	0x08: "Matra Communication",
+	0x09: "News Datacom (NDS Videoguard)",
+	0x0a: "Nokia",
+	0x0b: "Norwegian Telekom (Conax)",
+	0x0c: "NTL",
+	0x0d: "Philips (Cryptoworks)",
+	0x0e: "Scientific Atlanta (PowerVu)",
+	0x0f: "Sony",
+	0x10: "Tandberg Television",
+	0x11: "Thomson",
+	0x12: "TV/Com",
+	0x13: "HPT - Croatian Post and Telecommunications",
+	0x14: "HRT - Croatian Radio and Television",
+	0x15: "IBM",
+	0x16: "Nera",
+	0x17: "BetaTechnik (Betacrypt)",
+	0x18: "Kudelski (Nagravision)",
+	0x19: "Titan Information Systems",
+	0x20: "Telefonica Servicios Audiovisuales",
+	0x21: "Stentor",
+	0x22: "Scopus Network Technologies",
+	0x23: "BARCO AS",
+	0x24: "StarGuide Digital Networks",
+	0x25: "Mentor Data System",
+	0x26: "European Broadcasting Union (BISS)",
+	0x47: "General Instrument",
+	0x48: "Telemann",
+	0x49: "Digital TV Industry Alliance of China",
+}
+
+// vendor for a CA_system_ID, "unknown" if it isn't one we know
+func caSystemName(systemID uint16) string {
+	if name, known := caSystemNames[systemID]; known {
+		return name
+	}
+	if name, known := caSystemBlockNames[uint8(systemID>>8)]; known {
+		return name
+	}
+	return "unknown"
+}
+
+// decode the body of a CA_descriptor (tag 0x09)
+func parseCADescriptor(body []byte) (CADescriptor, error) {
+	if len(body) < 4 {
+		return CADescriptor{}, fmt.Errorf("CA_descriptor length %d, needs at least 4", len(body))
+	}
+	ca := CADescriptor{
+		SystemID: (uint16(body[0]) << 8) | uint16(body[1]),
+		PID:      ((uint16(body[2]) << 8) | uint16(body[3])) & 0x1fff,
+	}
+	ca.Vendor = caSystemName(ca.SystemID)
+	if len(body) > 4 {
+		ca.PrivateData = append([]byte(nil), body[4:]...)
+	}
+	return ca, nil
+}
+
+// decode 1 whole CAT section, table_id through CRC
+func parseCATSection(section []byte) (*CATEvent, error) {
+	event := &CATEvent{}
+	var caErr error
+	err := forEachDescriptor(section[8:len(section)-4], func(tag uint8, body []byte) {
+		if tag != 0x09 {
+			return
+		}
+		ca, err := parseCADescriptor(body)
+		if err != nil {
+			caErr = err
+			return
+		}
+		event.CASystems = append(event.CASystems, ca)
+	})
+	if err != nil {
+		return event, fmt.Errorf("CAT: %v", err)
+	}
+	if caErr != nil {
+		return event, fmt.Errorf("CAT: %v", caErr)
+	}
+	return event, nil
+}
+
+// parse a CAT section, keep its EMM PIDs for the report and hand it on
+func (tables tableParser) catParser(pid uint16, section []byte) {
+	event, err := parseCATSection(section)
+	if err != nil {
+		tables.report.raise(SeverityWarning, DiagBadDescriptor, "%v", err)
+	}
+	event.Position = tables.report.position
+	tables.keepDecoded(pid, section, &CATEvent{CASystems: append([]CADescriptor(nil), event.CASystems...)})
+	for _, handler := range tables.report.handlers {
+		handler.OnCAT(event)
+	}
+}
+
+// CA_descriptors with private data of their own, for handing out
+func copyCASystems(systems []CADescriptor) []CADescriptor {
+	if len(systems) == 0 {
+		return nil
+	}
+	copied := make([]CADescriptor, len(systems))
+	for i, ca := range systems {
+		copied[i] = ca
+		copied[i].PrivateData = append([]byte(nil), ca.PrivateData...)
+	}
+	return copied
+}
+
+// every CA system protecting a service, the whole service first then by component
+func (service programDefinition) serviceCASystems() []ServiceCASystem {
+	var systems []ServiceCASystem
+	for _, ca := range copyCASystems(service.caSystems) {
+		systems = append(systems, ServiceCASystem{CADescriptor: ca})
+	}
+	for _, comp := range service.streamComps {
+		for _, ca := range copyCASystems(comp.caSystems) {
+			systems = append(systems, ServiceCASystem{CADescriptor: ca, ComponentPID: comp.streamPID})
+		}
+	}
+	return systems
+}
+
+// add a value to a sorted list, once
+func addSorted(values []uint16, value uint16) []uint16 {
+	i := sort.Search(len(values), func(i int) bool { return values[i] >= value })
+	if i < len(values) && values[i] == value {
+		return values
+	}
+	values = append(values, 0)
+	copy(values[i+1:], values[i:])
+	values[i] = value
+	return values
+}
+
+// the CA systems part of a report, EMMs from the CAT and ECMs from the PMTs
+func (tables tableParser) addCAToReport(report *Report) {
+	systems := make(map[uint16]*CASystemReport)
+	system := func(systemID uint16) *CASystemReport {
+		if systems[systemID] == nil {
+			systems[systemID] = &CASystemReport{SystemID: systemID, Vendor: caSystemName(systemID),
+				EMMPIDs: make([]uint16, 0), ECMPIDs: make([]uint16, 0), Services: make([]uint16, 0)}
+		}
+		return systems[systemID]
+	}
+
+	for key, state := range tables.versions {
+		if key.tableID != uint8(conditionalAccessSection) {
+			continue
+		}
+		for _, decoded := range state.decoded {
+			cat, isCAT := decoded.(*CATEvent)
+			if !isCAT {
+				continue
+			}
+			for _, ca := range cat.CASystems {
+				emm := system(ca.SystemID)
+				emm.EMMPIDs = addSorted(emm.EMMPIDs, ca.PID)
+			}
+		}
+	}
+	for programNumber, service := range tables.serviceMap {
+		for _, ca := range service.serviceCASystems() {
+			ecm := system(ca.SystemID)
+			ecm.ECMPIDs = addSorted(ecm.ECMPIDs, ca.PID)
+			ecm.Services = addSorted(ecm.Services, programNumber)
+		}
+	}
+
+	report.CASystems = make([]CASystemReport, 0, len(systems))
+	for _, system := range systems {
+		report.CASystems = append(report.CASystems, *system)
+	}
+	sort.Slice(report.CASystems, func(i, j int) bool { return report.CASystems[i].SystemID < report.CASystems[j].SystemID })
+}
@@ -0,0 +1,111 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+// CAT with EMMs for CA system 0x0100 on 0x300 and 0x301, and 0x0500 on 0x302
+func testCAT() []byte {
+	return testLongSection(0x01, 0xffff, 0, 0, 0, []byte{
+		0x09, 4, 0x01, 0x00, 0xe3, 0x00,
+		0x09, 4, 0x01, 0x00, 0xe3, 0x01,
+		0x09, 5, 0x05, 0x00, 0xe3, 0x02, 0xaa,
+	})
+}
+
+func TestCASystems(t *testing.T) {
+	// program 1 scrambled by 0x0100 with ECMs on 0x400, and its audio by 0x0500 too with ECMs on 0x401
+	pmt := append([]byte{0xe1, 0x01}, testLoop([]byte{0x09, 4, 0x01, 0x00, 0xe4, 0x00})...)
+	pmt = append(append(pmt, 0x1b, 0xe1, 0x01), testLoop(nil)...)
+	pmt = append(append(pmt, 0x03, 0xe1, 0x02), testLoop([]byte{0x09, 4, 0x05, 0x00, 0xe4, 0x01})...)
+
+	tables, diagnostics, events := testSectionTables()
+	tables.processSection(0, testPAT())
+	tables.processSection(0x100, testLongSection(0x02, 1, 0, 0, 0, pmt))
+	tables.processSection(0x01, testCAT())
+	if diagnostics.count(DiagBadDescriptor) != 0 || len(events.cats) != 1 {
+		t.Fatalf("%d CAT events, diagnostics %v", len(events.cats), *diagnostics)
+	}
+
+	mediaguard, viaccess := "Canal+ (Mediaguard)", "France Telecom (Viaccess)"
+	programECM := CADescriptor{SystemID: 0x0100, Vendor: mediaguard, PID: 0x400}
+	audioECM := CADescriptor{SystemID: 0x0500, Vendor: viaccess, PID: 0x401}
+	report := &Report{}
+	tables.addToReport(report)
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"CAT event", events.cats[0].CASystems, []CADescriptor{
+			{SystemID: 0x0100, Vendor: mediaguard, PID: 0x300}, {SystemID: 0x0100, Vendor: mediaguard, PID: 0x301},
+			{SystemID: 0x0500, Vendor: viaccess, PID: 0x302, PrivateData: []byte{0xaa}}}},
+		{"PMT event program", events.pmts[0].CASystems, []CADescriptor{programECM}},
+		{"PMT event audio", events.pmts[0].Streams[1].CASystems, []CADescriptor{audioECM}},
+		{"service", report.Services[0].CASystems, []ServiceCASystem{{CADescriptor: programECM}, {CADescriptor: audioECM, ComponentPID: 0x102}}},
+		{"CA systems", report.CASystems, []CASystemReport{
+			{SystemID: 0x0100, Vendor: mediaguard, EMMPIDs: []uint16{0x300, 0x301}, ECMPIDs: []uint16{0x400}, Services: []uint16{1}},
+			{SystemID: 0x0500, Vendor: viaccess, EMMPIDs: []uint16{0x302}, ECMPIDs: []uint16{0x401}, Services: []uint16{1}}}},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+}
+
+// the EMM PIDs are kept when the CAT arrives, out of reach of handlers
+func TestCATKept(t *testing.T) {
+	tables, _, events := testSectionTables()
+	tables.processSection(0x01, testCAT())
+	for _, event := range events.cats {
+		for i := range event.CASystems {
+			event.CASystems[i].SystemID = 0xffff
+		}
+	}
+	report := &Report{}
+	tables.addToReport(report)
+	var got [][2]interface{}
+	for _, system := range report.CASystems {
+		got = append(got, [2]interface{}{system.SystemID, system.EMMPIDs})
+	}
+	if expected := [][2]interface{}{{uint16(0x0100), []uint16{0x300, 0x301}}, {uint16(0x0500), []uint16{0x302}}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("CA systems %v, expected %v", got, expected)
+	}
+}
+
+func TestCASystemName(t *testing.T) {
+	for _, test := range []struct {
+		systemID uint16
+		expected string
+	}{
+		{0x0100, "Canal+ (Mediaguard)"},
+		{0x1802, "Kudelski (Nagravision)"},
+		{0x2600, "European Broadcasting Union (BISS)"},
+		{0x4aea, "Cryptoguard"},
+		{0x4aeb, "unknown"},
+		{0xffff, "unknown"},
+	} {
+		if name := caSystemName(test.systemID); name != test.expected {
+			t.Errorf("0x%04x: %q, expected %q", test.systemID, name, test.expected)
+		}
+	}
+}
+
+func TestCATMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		body    []byte
+		systems int // decoded before the bad one
+	}{
+		{"descriptor too long", []byte{0x09, 4, 0x01, 0x00, 0xe3, 0x00, 0x09, 9, 0x05}, 1},
+		{"CA_descriptor too short", []byte{0x09, 2, 0x01, 0x00}, 0},
+		{"descriptor length missing", []byte{0x09}, 0},
+	} {
+		tables, diagnostics, events := testSectionTables()
+		tables.processSection(0x01, testLongSection(0x01, 0xffff, 0, 0, 0, test.body))
+		if diagnostics.count(DiagBadDescriptor) != 1 || len(events.cats) != 1 || len(events.cats[0].CASystems) != test.systems {
+			t.Errorf("%s: events %+v, diagnostics %v", test.name, events.cats, *diagnostics)
+		}
+	}
+}
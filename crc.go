@@ -0,0 +1,77 @@
+package tshelper
+
+// MPEG-2 CRC32, as used on the end of PSI / SI sections (13818-1 Annex A)
+// polynomial 0x04C11DB7, starting from all 1s, no bit reflection and no final xor.  Running it over
+// a whole section including its CRC_32 gives 0 when the section is good
+
+var crc32MpegTable = makeCRC32MpegTable()
+
+func makeCRC32MpegTable() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x80000000 != 0 {
+				crc = (crc << 1) ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return
+}
+
+func crc32Mpeg(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc = (crc << 8) ^ crc32MpegTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// tables with a CRC_32 on the end.  All long form sections have one, of the short form ones
+// only the TOT and SCTE-35's splice_info_section do
+func sectionHasCRC(section []byte) bool {
+	tableID := section[0]
+	return section[1]&0x80 != 0 || tableID == uint8(scte35SpliceInfoSection) || tableID == uint8(totSection)
+}
+
+// key for counting CRC failures
+type crcErrorKey struct {
+	pid     uint16
+	tableID uint8
+}
+
+// CRCErrorEvent - a section failed its CRC check and has been dropped
+type CRCErrorEvent struct {
+	Position
+	TableID  uint8
+	Expected uint32 // CRC_32 carried in the section
+	Computed uint32 // CRC worked out from the section's contents
+}
+
+// check the CRC on a complete section, counting and reporting it if it's wrong
+func (tables tableParser) sectionCRCGood(pid uint16, section []byte) bool {
+	if !sectionHasCRC(section) {
+		return true
+	}
+	if len(section) < 7 {
+		// not even room for a CRC after the header, so nothing can be checked or parsed
+		tables.report.raise(SeverityWarning, DiagBadSectionLength, "table 0x%x section of %d bytes is too short to hold a CRC_32 - dropped", section[0], len(section))
+		return false
+	}
+	end := len(section) - 4
+	computed := crc32Mpeg(section[:end])
+	expected := (uint32(section[end]) << 24) | (uint32(section[end+1]) << 16) | (uint32(section[end+2]) << 8) | uint32(section[end+3])
+	if computed == expected {
+		return true
+	}
+
+	tables.crcErrors[crcErrorKey{pid: pid, tableID: section[0]}] += 1
+	tables.report.raise(SeverityError, DiagCRCError, "table 0x%x CRC_32 0x%08x, section gives 0x%08x - dropped", section[0], expected, computed)
+	event := &CRCErrorEvent{Position: tables.report.position, TableID: section[0], Expected: expected, Computed: computed}
+	for _, handler := range tables.report.handlers {
+		handler.OnCRCError(event)
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package tshelper
+
+import (
+	"testing"
+)
+
+func TestCRC32Mpeg(t *testing.T) {
+	for _, test := range []struct {
+		data string
+		crc  uint32
+	}{
+		{"", 0xffffffff},
+		{"123456789", 0x0376e6e7}, // the CRC-32/MPEG-2 check value
+		{"\x00", 0x4e08bfb4},
+		{"\x00\xb0\x0d\x00\x01\xc1\x00\x00\x00\x01\xe0\x20", 0xa2c32941},
+	} {
+		if crc := crc32Mpeg([]byte(test.data)); crc != test.crc {
+			t.Errorf("CRC of %q is 0x%08x, expected 0x%08x", test.data, crc, test.crc)
+		}
+	}
+	// run over the section and its CRC, a good section comes out 0
+	if crc := crc32Mpeg(testPAT()); crc != 0 {
+		t.Errorf("CRC over a whole good section is 0x%08x, expected 0", crc)
+	}
+}
+
+func TestSectionCRCCheck(t *testing.T) {
+	damaged := testPAT()
+	damaged[9] ^= 0x01
+	for _, test := range []struct {
+		name    string
+		section []byte
+		good    bool
+		code    DiagnosticCode // the 1 diagnostic expected, 0 for none
+	}{
+		{"good", testPAT(), true, 0},
+		{"damaged", damaged, false, DiagCRCError},
+		{"damaged CRC_32", append(testPAT()[:len(damaged)-1], 0), false, DiagCRCError},
+		{"short form, no CRC", []byte{0x70, 0x70, 0x05, 1, 2, 3, 4, 5}, true, 0},
+		{"too short for a CRC", []byte{0x00, 0xb0, 0x03, 0, 1, 0xc1}, false, DiagBadSectionLength},
+	} {
+		report := new(reporter)
+		diagnostics := &testDiagnostics{}
+		report.sink = diagnostics.sink
+		events := &testEvents{}
+		report.handlers = append(report.handlers, events)
+		tables := newTableParser(report)
+		if good := tables.sectionCRCGood(0, test.section); good != test.good {
+			t.Errorf("%s: CRC good %v", test.name, good)
+		}
+		snapshot := &Report{}
+		tables.addToReport(snapshot)
+		var code DiagnosticCode
+		if len(*diagnostics) == 1 {
+			code = (*diagnostics)[0].Code
+		}
+		if len(*diagnostics) > 1 || code != test.code {
+			t.Errorf("%s: diagnostics %v", test.name, *diagnostics)
+		}
+		if test.code != DiagCRCError {
+			if len(events.crcErrors) != 0 || len(snapshot.CRCErrors) != 0 {
+				t.Errorf("%s: CRC error events %+v, report %+v", test.name, events.crcErrors, snapshot.CRCErrors)
+			}
+			continue
+		}
+		if len(events.crcErrors) != 1 || events.crcErrors[0].TableID != 0 {
+			t.Errorf("%s: CRC error events %+v", test.name, events.crcErrors)
+		}
+		if len(snapshot.CRCErrors) != 1 || snapshot.CRCErrors[0] != (CRCErrorCount{PID: 0, TableID: 0, Count: 1}) {
+			t.Errorf("%s: report CRC errors %+v", test.name, snapshot.CRCErrors)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package tshelper
+
+// SCTE-35 cue injection
+// CueInjector sits between a 188 byte TS and an io.Writer, passing the stream through with
+// splice_info_sections added on a cue PID of the caller's choosing.  The program's PMT is
+// rewritten so a splicer downstream knows the cues are there: the CUEI registration_descriptor
+// in the program_info loop, and a stream_type 0x86 entry for the cue PID carrying a
+// cue_identifier_descriptor, the same things pmtParser looks for.  The rewritten PMT takes the
+// place of every copy of the original, with the version moved on by 1 so a receiver that saw
+// the original notices the change.
+// Each cue is sent when the program's PCR reaches the time asked for, straight after the packet
+// carrying that PCR.  PMT sections are assumed to start at the start of a packet, as they always
+// do in practice, a PMT PID that doesn't is passed through untouched.  The PMT PID's
+// continuity_counter carries on from the one before the first packet the injector takes hold of,
+// so a receiver sees no break where the rewritten sections start
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// cue_stream_type for the cue_identifier_descriptor, any splice command may be sent
+const cueStreamTypeAllCommands = 0x01
+
+// PacketiseSection splits a section into TS packets on pid, the first with PUSI set and a
+// pointer_field of 0, the last stuffed out with 0xFF.  continuityCounter is the counter of the
+// last packet sent on the PID, and is left at that of the last packet made
+func PacketiseSection(pid uint16, section []byte, continuityCounter *uint8) []byte {
+	var packets []byte
+	payload := append([]byte{0}, section...) // pointer_field
+	for first := true; len(payload) > 0; first = false {
+		*continuityCounter = (*continuityCounter + 1) & 0xf
+		header := []byte{tsSyncByte, byte(pid>>8) & 0x1f, byte(pid), 0x10 | *continuityCounter}
+		if first {
+			header[1] |= 0x40
+		}
+		size := len(payload)
+		if size > tsPacketSize-4 {
+			size = tsPacketSize - 4
+		}
+		packet := append(header, payload[:size]...)
+		for len(packet) < tsPacketSize {
+			packet = append(packet, 0xff)
+		}
+		packets = append(packets, packet...)
+		payload = payload[size:]
+	}
+	return packets
+}
+
+// rewrite a PMT section to carry cuePID, adding the CUEI registration and the cue stream if
+// they're not already there, moving the version on and putting a new CRC on the end
+func addCueToPMT(section []byte, cuePID uint16) ([]byte, error) {
+	if len(section) < 16 {
+		return nil, fmt.Errorf("PMT section of %d bytes is too short", len(section))
+	}
+	programInfoLength := ((int(section[10]) << 8) | int(section[11])) & 0x0fff
+	esStart := 12 + programInfoLength
+	esEnd := len(section) - 4
+	if esStart > esEnd {
+		return nil, fmt.Errorf("PMT program_info_length %d runs past the end of the section", programInfoLength)
+	}
+
+	programInfo := section[12:esStart]
+	hasRegistration := false
+	for rd := 0; rd+2 <= len(programInfo); rd += 2 + int(programInfo[rd+1]) {
+		if programInfo[rd] == 0x05 && rd+6 <= len(programInfo) && string(programInfo[rd+2:rd+6]) == "CUEI" {
+			hasRegistration = true
+		}
+	}
+	hasCueStream := false
+	for rd := esStart; rd+5 <= esEnd; rd += 5 + (((int(section[rd+3]) << 8) | int(section[rd+4])) & 0x0fff) {
+		if ((uint16(section[rd+1])<<8)|uint16(section[rd+2]))&0x1fff == cuePID {
+			if section[rd] != 0x86 {
+				return nil, fmt.Errorf("PID 0x%x is already in the PMT as stream_type 0x%x", cuePID, section[rd])
+			}
+			hasCueStream = true
+		}
+	}
+
+	if !hasRegistration {
+		programInfo = append(append([]byte(nil), programInfo...), 0x05, 4, 'C', 'U', 'E', 'I')
+	}
+	rewritten := append([]byte(nil), section[:10]...)
+	rewritten = append(rewritten, 0xf0|byte(len(programInfo)>>8), byte(len(programInfo)))
+	rewritten = append(rewritten, programInfo...)
+	rewritten = append(rewritten, section[esStart:esEnd]...)
+	if !hasCueStream {
+		rewritten = append(rewritten, 0x86, 0xe0|byte(cuePID>>8), byte(cuePID), 0xf0, 3, 0x8a, 1, cueStreamTypeAllCommands)
+	}
+
+	sectionLength := len(rewritten) + 4 - 3
+	if sectionLength > 1021 {
+		return nil, fmt.Errorf("PMT section_length would be %d with the cue added", sectionLength)
+	}
+	rewritten[1] = (rewritten[1] & 0xf0) | byte(sectionLength>>8)
+	rewritten[2] = byte(sectionLength)
+	version := ((rewritten[5] >> 1) + 1) & 0x1f
+	rewritten[5] = (rewritten[5] & 0xc1) | version<<1
+	crc := crc32Mpeg(rewritten)
+	return append(rewritten, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc)), nil
+}
+
+// a cue waiting to be sent
+type pendingCue struct {
+	sendAt  uint64 // PCR base, 90kHz
+	section []byte
+}
+
+// collects 1 section from the packets of a PID
+type sectionGatherer struct {
+	data []byte
+	held []byte // the packets it came in, for passing on unchanged
+}
+
+// add a packet's payload, handing back the section once it is all there
+func (gatherer *sectionGatherer) add(packet []byte, pusi bool, payload []byte) (section []byte, usable bool) {
+	if pusi {
+		gatherer.held = nil
+		gatherer.data = nil
+		if len(payload) == 0 || payload[0] != 0 || len(payload) < 4 {
+			return nil, false
+		}
+		gatherer.data = append([]byte(nil), payload[1:]...)
+	} else if gatherer.data != nil {
+		gatherer.data = append(gatherer.data, payload...)
+	} else {
+		return nil, false
+	}
+	gatherer.held = append(gatherer.held, packet...)
+	sectionLength := ((int(gatherer.data[1]) << 8) | int(gatherer.data[2])) & 0x0fff
+	if len(gatherer.data) < 3+sectionLength {
+		return nil, true
+	}
+	section = gatherer.data[:3+sectionLength]
+	gatherer.data = nil
+	return section, true
+}
+
+// CueInjector adds SCTE-35 cues to a 188 byte TS as it is written through it.  Not safe for use
+// from more than 1 goroutine
+type CueInjector struct {
+	out           io.Writer
+	programNumber uint16 // 0 until the PAT says, when the caller didn't give one
+	cuePID        uint16
+	cueCC         uint8
+	pmtPID        uint16
+	pmtCC         uint8
+	pmtCCKnown    bool // pmtCC has been taken from the stream
+	pcrPID        uint16
+	haveProgram   bool // pmtPID known
+	havePCRPID    bool
+	pat           sectionGatherer
+	pmt           sectionGatherer
+	cues          []pendingCue
+	partial       []byte // bytes short of a whole packet from the last Write
+}
+
+// NewCueInjector makes a CueInjector writing to out.  Cues are added to programNumber, or the
+// first program in the PAT if that is 0, on cuePID, which must not already be in use.  A packet
+// on cuePID in the stream written is an error
+func NewCueInjector(out io.Writer, programNumber uint16, cuePID uint16) *CueInjector {
+	return &CueInjector{out: out, programNumber: programNumber, cuePID: cuePID, cueCC: 0xf}
+}
+
+// AddCue has a splice_info_section sent once the program's PCR reaches sendAt, a PCR base in
+// 90kHz ticks.  Send it comfortably before the splice time it carries, SCTE 67 asks for 4 seconds
+func (injector *CueInjector) AddCue(splice *SpliceInfoSection, sendAt uint64) error {
+	section, err := splice.Encode()
+	if err != nil {
+		return err
+	}
+	injector.cues = append(injector.cues, pendingCue{sendAt: sendAt & timestampMask, section: section})
+	sort.SliceStable(injector.cues, func(i, j int) bool { return timestampDelta(injector.cues[j].sendAt, injector.cues[i].sendAt) < 0 })
+	return nil
+}
+
+// PendingCues is how many cues are still waiting for their time to come
+func (injector *CueInjector) PendingCues() int {
+	return len(injector.cues)
+}
+
+// Write takes the next part of the TS, writing out the stream with the cues added.  On an error
+// the count is of the bytes of data in the packets that went before the one at fault
+func (injector *CueInjector) Write(data []byte) (int, error) {
+	stream := append(injector.partial, data...)
+	// bytes of stream that came from before this Write
+	carried := len(injector.partial)
+	consumed := func(rd int) int {
+		if rd < carried {
+			return 0
+		}
+		return rd - carried
+	}
+	rd := 0
+	for ; rd+tsPacketSize <= len(stream); rd += tsPacketSize {
+		if stream[rd] != tsSyncByte {
+			injector.partial = nil
+			return consumed(rd), errors.New("tshelper: CueInjector needs 188 byte packets, lost sync")
+		}
+		if err := injector.processPacket(stream[rd : rd+tsPacketSize]); err != nil {
+			injector.partial = nil
+			return consumed(rd), err
+		}
+	}
+	injector.partial = append([]byte(nil), stream[rd:]...)
+	return len(data), nil
+}
+
+// Close writes out anything held back.  Cues whose time never came are not sent
+func (injector *CueInjector) Close() error {
+	held, partial := injector.pmt.held, injector.partial
+	injector.pmt.held, injector.partial = nil, nil
+	if err := injector.passPMT(held); err != nil {
+		return err
+	}
+	return injector.write(partial)
+}
+
+func (injector *CueInjector) processPacket(packet []byte) error {
+	pid := ((uint16(packet[1]) << 8) | uint16(packet[2])) & 0x1fff
+	pusi := packet[1]&0x40 != 0
+	payload := packet[4:]
+	if packet[3]&0x20 != 0 {
+		if 5+int(packet[4]) > tsPacketSize {
+			// adaptation_field_length runs past the packet, so there's no telling where a payload would be
+			payload = nil
+		} else {
+			payload = packet[5+int(packet[4]):]
+		}
+	}
+	if packet[3]&0x10 == 0 {
+		payload = nil
+	}
+
+	switch {
+	case pid == injector.cuePID:
+		return fmt.Errorf("tshelper: CueInjector's cue PID 0x%x is already in use in the stream", pid)
+	case pid == 0:
+		if section, _ := injector.pat.add(packet, pusi, payload); section != nil {
+			injector.findProgram(section)
+		}
+		return injector.write(packet)
+	case injector.haveProgram && pid == injector.pmtPID:
+		if !injector.pmtCCKnown {
+			// the counter the packet before this one had, which is what was last sent on
+			injector.pmtCC = packet[3] & 0xf
+			if packet[3]&0x10 != 0 {
+				injector.pmtCC = (injector.pmtCC - 1) & 0xf
+			}
+			injector.pmtCCKnown = true
+		}
+		return injector.rewritePMT(packet, pusi, payload)
+	}
+
+	if err := injector.write(packet); err != nil {
+		return err
+	}
+	if injector.havePCRPID && pid == injector.pcrPID && packet[3]&0x20 != 0 && packet[4] >= 7 && packet[5]&0x10 != 0 {
+		pcrBase := (extractPCR(packet[6:]) / 300) & timestampMask
+		for len(injector.cues) > 0 && timestampDelta(injector.cues[0].sendAt, pcrBase) >= 0 {
+			if err := injector.write(PacketiseSection(injector.cuePID, injector.cues[0].section, &injector.cueCC)); err != nil {
+				return err
+			}
+			injector.cues = injector.cues[1:]
+		}
+	}
+	return nil
+}
+
+// find the PMT PID from a PAT section
+func (injector *CueInjector) findProgram(section []byte) {
+	if section[0] != uint8(programAssociationSection) || len(section) < 12 {
+		return
+	}
+	for rd := 8; rd+4 <= len(section)-4; rd += 4 {
+		programNumber := (uint16(section[rd]) << 8) | uint16(section[rd+1])
+		pid := ((uint16(section[rd+2]) << 8) | uint16(section[rd+3])) & 0x1fff
+		if programNumber != 0 && (injector.programNumber == 0 || injector.programNumber == programNumber) {
+			injector.programNumber = programNumber
+			injector.pmtPID = pid
+			injector.haveProgram = true
+			return
+		}
+	}
+}
+
+// hold back packets on the PMT PID until the section is in, then send it on rewritten (or as it
+// was if it's not the PMT of our program)
+func (injector *CueInjector) rewritePMT(packet []byte, pusi bool, payload []byte) error {
+	if pusi && injector.pmt.held != nil {
+		if err := injector.passPMT(injector.pmt.held); err != nil {
+			return err
+		}
+	}
+	section, usable := injector.pmt.add(packet, pusi, payload)
+	if !usable {
+		return injector.passPMT(packet)
+	}
+	if section == nil {
+		return nil // more to come
+	}
+	held := injector.pmt.held
+	injector.pmt.held = nil
+	programNumber := (uint16(section[3]) << 8) | uint16(section[4])
+	if section[0] != uint8(ProgramMapSection) || programNumber != injector.programNumber || crc32Mpeg(section) != 0 {
+		return injector.passPMT(held)
+	}
+	rewritten, err := addCueToPMT(section, injector.cuePID)
+	if err != nil {
+		return err
+	}
+	injector.pcrPID = ((uint16(section[8]) << 8) | uint16(section[9])) & 0x1fff
+	injector.havePCRPID = true
+	return injector.write(PacketiseSection(injector.pmtPID, rewritten, &injector.pmtCC))
+}
+
+// send on original packets from the PMT PID, renumbered to follow on from the rewritten ones
+func (injector *CueInjector) passPMT(packets []byte) error {
+	packets = append([]byte(nil), packets...)
+	for i := 0; i+tsPacketSize <= len(packets); i += tsPacketSize {
+		if packets[i+3]&0x10 != 0 {
+			injector.pmtCC = (injector.pmtCC + 1) & 0xf
+		}
+		packets[i+3] = (packets[i+3] & 0xf0) | injector.pmtCC
+	}
+	return injector.write(packets)
+}
+
+func (injector *CueInjector) write(data []byte) error {
+	_, err := injector.out.Write(data)
+	return err
+}
@@ -0,0 +1,244 @@
+package tshelper
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// PIDs of every packet in a 188 byte stream
+func testPIDs(data []byte) []uint16 {
+	var pids []uint16
+	for rd := 0; rd+tsPacketSize <= len(data); rd += tsPacketSize {
+		pids = append(pids, ((uint16(data[rd+1])<<8)|uint16(data[rd+2]))&0x1fff)
+	}
+	return pids
+}
+
+func TestCueInjector(t *testing.T) {
+	const second = 90000
+	for _, test := range []struct {
+		name     string
+		pcrs     []uint64 // PCR bases, each in its own packet after the PAT and PMT
+		cues     []uint64 // the PCR base each is to go out at
+		expected []uint16 // PIDs out
+		pending  int
+	}{
+		{"cue goes out after the PCR reaching its time", []uint64{0, second, 2 * second}, []uint64{second},
+			[]uint16{0, 0x100, 0x101, 0x101, 0x500, 0x101}, 0},
+		{"cue not due yet", []uint64{0, second}, []uint64{5 * second},
+			[]uint16{0, 0x100, 0x101, 0x101}, 1},
+		{"cues go out in time order", []uint64{0, second, 2 * second}, []uint64{2 * second, second},
+			[]uint16{0, 0x100, 0x101, 0x101, 0x500, 0x101, 0x500}, 0},
+		{"cues due together go out together", []uint64{0, 3 * second}, []uint64{second, 2 * second},
+			[]uint16{0, 0x100, 0x101, 0x101, 0x500, 0x500}, 0},
+		{"PCR wraps past the cue time", []uint64{timestampMask - second, 0}, []uint64{timestampMask},
+			[]uint16{0, 0x100, 0x101, 0x101, 0x500}, 0},
+	} {
+		stream := newTestStream()
+		stream.section(0, testPAT())
+		stream.section(0x100, testPMT(0, 0x1b, 0x101))
+		for _, pcr := range test.pcrs {
+			stream.packet(0x101, false, testPCRAdaptation(pcr*300), make([]byte, 176))
+		}
+
+		var out bytes.Buffer
+		injector := NewCueInjector(&out, 0, 0x500)
+		for _, sendAt := range test.cues {
+			splice := &SpliceInfoSection{CommandType: SpliceCommandInsert, Insert: &SpliceInsert{SpliceEventID: uint32(sendAt), ProgramSplice: true, SpliceImmediate: true}}
+			if err := injector.AddCue(splice, sendAt); err != nil {
+				t.Fatalf("%s: AddCue: %v", test.name, err)
+			}
+		}
+		// in uneven pieces, the injector has to carry part packets between writes
+		for data := stream.data; len(data) > 0; {
+			n := len(data)
+			if n > 100 {
+				n = 100
+			}
+			if written, err := injector.Write(data[:n]); err != nil || written != n {
+				t.Fatalf("%s: Write gave %d, %v", test.name, written, err)
+			}
+			data = data[n:]
+		}
+		if err := injector.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", test.name, err)
+		}
+		if pids := testPIDs(out.Bytes()); !reflect.DeepEqual(pids, test.expected) {
+			t.Errorf("%s: PIDs out %x, expected %x", test.name, pids, test.expected)
+		}
+		if injector.PendingCues() != test.pending {
+			t.Errorf("%s: %d cues pending, expected %d", test.name, injector.PendingCues(), test.pending)
+		}
+
+		// what comes out demuxes cleanly, with the cue PID in the PMT and the cues on it
+		result := newTestStream()
+		result.data = append(result.data, out.Bytes()...)
+		result.padding(3)
+		demuxer, diagnostics := newTestDemuxer()
+		events := &testEvents{}
+		demuxer.AddHandler(events)
+		feedTestStream(t, demuxer, result)
+		services := demuxer.Report().Services
+		cueComponent := ComponentReport{PID: 0x500, StreamType: 0x86, StreamTypeName: "SCTE-35", CueDescriptor: true, Descriptors: []Descriptor{
+			{Tag: 0x8a, Name: "cue_identifier_descriptor", Raw: []byte{cueStreamTypeAllCommands}, Value: &CueIdentifierDescriptor{CueStreamType: cueStreamTypeAllCommands}}}}
+		if len(services) != 1 || !services[0].HasSCTE35 || len(services[0].Components) != 2 || !reflect.DeepEqual(services[0].Components[1], cueComponent) {
+			t.Errorf("%s: services %+v, expected the cue PID added", test.name, services)
+		}
+		if len(events.scte35s) != len(test.cues)-test.pending || diagnostics.count(DiagContinuityError) != 0 || diagnostics.count(DiagCRCError) != 0 {
+			t.Errorf("%s: %d cues demuxed, expected %d, with diagnostics %v", test.name, len(events.scte35s), len(test.cues)-test.pending, *diagnostics)
+		}
+	}
+}
+
+func TestAddCueToPMT(t *testing.T) {
+	plain := testPMT(31, 0x1b, 0x101)
+	withCue := testLongSection(0x02, 1, 4, 0, 0, []byte{0xe1, 0x01, 0xf0, 6, 0x05, 4, 'C', 'U', 'E', 'I', 0x86, 0xe5, 0x00, 0xf0, 3, 0x8a, 1, 1})
+	for _, test := range []struct {
+		name     string
+		section  []byte
+		expected []byte
+	}{
+		{"registration and cue stream added, version wraps",
+			plain, testLongSection(0x02, 1, 0, 0, 0, []byte{0xe1, 0x01, 0xf0, 6, 0x05, 4, 'C', 'U', 'E', 'I', 0x1b, 0xe1, 0x01, 0xf0, 0, 0x86, 0xe5, 0x00, 0xf0, 3, 0x8a, 1, 1})},
+		{"already there, only the version moves on",
+			withCue, testLongSection(0x02, 1, 5, 0, 0, withCue[8:len(withCue)-4])},
+	} {
+		rewritten, err := addCueToPMT(test.section, 0x500)
+		if err != nil || !bytes.Equal(rewritten, test.expected) {
+			t.Errorf("%s: rewritten as %X, %v, expected %X", test.name, rewritten, err, test.expected)
+		}
+	}
+
+	for _, test := range []struct {
+		name    string
+		section []byte
+	}{
+		{"too short", plain[:12]},
+		{"program_info_length past the end", testLongSection(0x02, 1, 0, 0, 0, []byte{0xe1, 0x01, 0xf0, 20})},
+		{"cue PID already a video stream", testPMT(0, 0x1b, 0x500)},
+	} {
+		if _, err := addCueToPMT(test.section, 0x500); err == nil {
+			t.Errorf("%s: rewritten", test.name)
+		}
+	}
+}
+
+// damaged packets are passed through, never a panic
+func TestCueInjectorDamagedInput(t *testing.T) {
+	damaged := func(pid uint16, control, adaptationLength uint8) []byte {
+		packet := make([]byte, tsPacketSize)
+		packet[0], packet[1], packet[2], packet[3], packet[4] = 0x47, 0x40|uint8(pid>>8), uint8(pid), control<<4, adaptationLength
+		return packet
+	}
+	for _, test := range []struct {
+		name    string
+		packets [][]byte
+	}{
+		{"adaptation_field_length past the packet", [][]byte{damaged(0, 0x3, 200), damaged(0x100, 0x3, 200), damaged(0x101, 0x3, 200)}},
+		{"adaptation only, length past the packet", [][]byte{damaged(0x100, 0x2, 255)}},
+	} {
+		stream := newTestStream()
+		stream.section(0, testPAT())
+		for _, packet := range test.packets {
+			stream.data = append(stream.data, packet...)
+		}
+		var out bytes.Buffer
+		injector := NewCueInjector(&out, 0, 0x500)
+		if _, err := injector.Write(stream.data); err != nil {
+			t.Errorf("%s: Write: %v", test.name, err)
+		}
+		if err := injector.Close(); err != nil {
+			t.Errorf("%s: Close: %v", test.name, err)
+		}
+		if out.Len() != len(stream.data) || !reflect.DeepEqual(testPIDs(out.Bytes()), testPIDs(stream.data)) {
+			t.Errorf("%s: PIDs out %v, expected %v", test.name, testPIDs(out.Bytes()), testPIDs(stream.data))
+		}
+	}
+}
+
+// the PMT PID's continuity_counter carries on from the stream's, however far it had got and
+// whether or not PMT packets went by before the PAT
+func TestCueInjectorPMTContinuity(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		firstCC   uint8
+		beforePAT bool // a PMT goes by before the PAT names its PID
+		expected  []uint8
+	}{
+		{"from 0", 0, false, []uint8{0, 1}},
+		{"from 7", 7, false, []uint8{7, 8}},
+		{"wrapping", 15, false, []uint8{15, 0}},
+		{"PMT before the PAT", 7, true, []uint8{7, 8, 9}},
+	} {
+		stream := newTestStream()
+		stream.continuity[0x100] = test.firstCC
+		if test.beforePAT {
+			stream.section(0x100, testPMT(0, 0x1b, 0x101))
+		}
+		stream.section(0, testPAT())
+		stream.section(0x100, testPMT(0, 0x1b, 0x101))
+		stream.section(0x100, testPMT(0, 0x1b, 0x101))
+
+		var out bytes.Buffer
+		injector := NewCueInjector(&out, 0, 0x500)
+		if _, err := injector.Write(stream.data); err != nil {
+			t.Fatalf("%s: Write: %v", test.name, err)
+		}
+		var ccs []uint8
+		for rd := 0; rd+tsPacketSize <= out.Len(); rd += tsPacketSize {
+			if packet := out.Bytes()[rd : rd+tsPacketSize]; testPIDs(packet)[0] == 0x100 {
+				ccs = append(ccs, packet[3]&0xf)
+			}
+		}
+		if !reflect.DeepEqual(ccs, test.expected) {
+			t.Errorf("%s: PMT continuity_counters %v, expected %v", test.name, ccs, test.expected)
+		}
+	}
+}
+
+// a Write that fails says how much of what it was given went out before the packet at fault
+func TestCueInjectorWriteErrors(t *testing.T) {
+	good := newTestStream()
+	good.section(0, testPAT())
+	good.section(0x100, testPMT(0, 0x1b, 0x101))
+	good.padding(1)
+	unsynced := append([]byte(nil), good.data...)
+	unsynced[2*tsPacketSize] = 0
+	onCuePID := append([]byte(nil), good.data...)
+	onCuePID[2*tsPacketSize+1], onCuePID[2*tsPacketSize+2] = 0x05, 0x00
+	cueInPMT := newTestStream()
+	cueInPMT.section(0, testPAT())
+	cueInPMT.section(0x100, testPMT(0, 0x1b, 0x500))
+
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		split    int // bytes in a first Write, which goes through
+		consumed int // bytes of the stream gone out when the error comes
+	}{
+		{"lost sync", unsynced, 0, 2 * tsPacketSize},
+		{"lost sync, second Write", unsynced, tsPacketSize + 100, 2 * tsPacketSize},
+		{"packet on the cue PID", onCuePID, 0, 2 * tsPacketSize},
+		{"packet on the cue PID, second Write", onCuePID, 2*tsPacketSize + 50, 2 * tsPacketSize},
+		{"cue PID already in the PMT", cueInPMT.data, 0, tsPacketSize},
+	} {
+		var out bytes.Buffer
+		injector := NewCueInjector(&out, 0, 0x500)
+		if n, err := injector.Write(test.data[:test.split]); err != nil || n != test.split {
+			t.Fatalf("%s: first Write gave %d, %v", test.name, n, err)
+		}
+		// none of the second Write, when the packet at fault started in the first
+		expected := test.consumed - test.split
+		if expected < 0 {
+			expected = 0
+		}
+		n, err := injector.Write(test.data[test.split:])
+		if err == nil || n != expected {
+			t.Errorf("%s: Write gave %d, %v, expected %d and an error", test.name, n, err, expected)
+		}
+		if pids := testPIDs(out.Bytes()); !reflect.DeepEqual(pids, testPIDs(test.data[:test.consumed])) {
+			t.Errorf("%s: PIDs out %x, expected %x", test.name, pids, testPIDs(test.data[:test.consumed]))
+		}
+	}
+}
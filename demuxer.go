@@ -0,0 +1,174 @@
+package tshelper
+
+// Demuxer is the streaming front end to the tsdmx.  ParseTSDataBlob wants whole TS packets, but
+// files, pipes and sockets hand back whatever length of data they feel like.  The Demuxer keeps
+// hold of any partial packet left at the end of one read and glues it onto the front of the next,
+// so callers can just point it at an io.Reader
+// It is also the concurrency boundary.  The tsdmx underneath is not safe to share, so every Demuxer
+// method takes the Demuxer's lock - one goroutine can Run / Feed while others take Reports of where
+// things have got to.  Handlers and the DiagnosticSink are called with the lock held, so they must
+// not call back into the Demuxer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// how much to ask the reader for each time round - a whole number of TS packets keeps
+// the common case (aligned files) from ever needing to carry data over
+const demuxerReadSize = 188 * 348
+
+// Demuxer feeds a tsdmx from a stream of bytes that need not arrive in whole packets
+type Demuxer struct {
+	mu      sync.Mutex // guards everything below, including all the state inside dmx
+	dmx     tsdmx
+	pending []byte // bytes read but not yet parsed - a partial packet, or a few packets while hunting for sync
+}
+
+// NewDemuxer creates a Demuxer with an empty tsdmx behind it
+func NewDemuxer() *Demuxer {
+	return &Demuxer{dmx: Newtsdmx()}
+}
+
+// Run reads from r and demuxes what it gets until r returns io.EOF, a read fails or ctx is
+// cancelled.  EOF is a clean finish and returns nil, any partial packet left at the very end of
+// the stream is dropped and any unbounded PES still open is flushed.  Cancellation is checked
+// between reads, so a reader that blocks forever (eg a quiet socket) needs a deadline of its own
+// as well.  Stream problems never stop a run and are not returned, so without a DiagnosticSink
+// every diagnostic is lost
+func (d *Demuxer) Run(ctx context.Context, r io.Reader) error {
+	buf := make([]byte, demuxerReadSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			// stream errors (lost sync, CC errors...) don't stop the run, set a DiagnosticSink to see them
+			d.Feed(buf[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			d.Flush()
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tshelper: read failed at byte offset %d: %w", d.Offset(), err)
+		}
+	}
+}
+
+// Feed hands the next chunk of the stream to the demuxer, for callers that already have their
+// own read loop.  data can be any length and is not kept after Feed returns.  With no
+// DiagnosticSink set, the SeverityError diagnostics raised for this chunk come back as
+// Diagnostics and the SeverityInfo / SeverityWarning ones are dropped - set a sink to see those
+func (d *Demuxer) Feed(data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending = append(d.pending, data...)
+	if len(d.pending) < tsPacketSize {
+		return nil
+	}
+	used, err := d.dmx.ParseTSDataBlob(d.pending, uint64(len(d.pending)))
+	if errors.Is(err, ErrNeedMoreData) {
+		// what is left is kept for the next Feed, so that's taken care of
+		err = nil
+	}
+
+	// shuffle the leftovers down to the front so pending never grows past a read + a few packets
+	left := copy(d.pending, d.pending[used:])
+	d.pending = d.pending[:left]
+	return err
+}
+
+// Offset is the byte offset in the stream of the first byte not yet demuxed, ie the total
+// number of bytes consumed so far
+func (d *Demuxer) Offset() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dmx.globalStats.bytesConsumed
+}
+
+// SetSyncLockCount sets how many consecutive sync bytes are needed to (re)lock, minimum 1
+func (d *Demuxer) SetSyncLockCount(count int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dmx.SetSyncLockCount(count)
+}
+
+// SyncEvents lists every sync acquire / loss seen so far, oldest first
+func (d *Demuxer) SyncEvents() []SyncEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dmx.SyncEvents()
+}
+
+// SetPacketFormat fixes the packet format rather than detecting it, PacketFormatAuto (the default)
+// goes back to detecting
+func (d *Demuxer) SetPacketFormat(format PacketFormat) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dmx.SetPacketFormat(format)
+}
+
+// PacketFormat is the packet format in use, PacketFormatAuto until one has been detected
+func (d *Demuxer) PacketFormat() PacketFormat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dmx.PacketFormat()
+}
+
+// SetDiagnosticSink sets where diagnostics go, every severity of them.  nil goes back to returning
+// just the errors from Feed
+func (d *Demuxer) SetDiagnosticSink(sink DiagnosticSink) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dmx.SetDiagnosticSink(sink)
+}
+
+// AddHandler registers a handler for demux events, see Handler
+func (d *Demuxer) AddHandler(handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dmx.AddHandler(handler)
+}
+
+// RegisterDescriptorDecoder sets the decoder for a private descriptor, see privateDecoders.go
+func (d *Demuxer) RegisterDescriptorDecoder(tag uint8, privateDataSpecifier uint32, decoder DescriptorDecoder) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dmx.RegisterDescriptorDecoder(tag, privateDataSpecifier, decoder)
+}
+
+// RegisterTableDecoder sets the decoder for a private table, see privateDecoders.go
+func (d *Demuxer) RegisterTableDecoder(pid uint16, tableID uint8, decoder TableDecoder) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dmx.RegisterTableDecoder(pid, tableID, decoder)
+}
+
+// Flush hands on any unbounded PES still being put together.  Run does this at EOF, Feed
+// callers should do it when their stream ends
+func (d *Demuxer) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dmx.Flush()
+}
+
+// Report takes a consistent, point in time snapshot of what has been found so far.  It is safe to
+// call from any goroutine, including while another is inside Run or Feed
+func (d *Demuxer) Report() *Report {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dmx.Report()
+}
+
+// SummariseFindings prints what the demuxer has found so far
+func (d *Demuxer) SummariseFindings() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dmx.SummariseFindings()
+}
@@ -0,0 +1,149 @@
+package tshelper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// hands back at most size bytes a read
+type chunkReader struct {
+	data []byte
+	size int
+}
+
+func (reader *chunkReader) Read(p []byte) (int, error) {
+	if len(reader.data) == 0 {
+		return 0, io.EOF
+	}
+	n := reader.size
+	if n > len(p) {
+		n = len(p)
+	}
+	n = copy(p[:n], reader.data)
+	reader.data = reader.data[n:]
+	return n, nil
+}
+
+// a PAT then enough null packets to lock on to it
+func testPATStream() *testStream {
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.padding(3)
+	return stream
+}
+
+func TestFeedInAnySizeChunks(t *testing.T) {
+	stream := testPATStream()
+	for _, size := range []int{1, 7, 187, 188, 189, 1000} {
+		demuxer, diagnostics := newTestDemuxer()
+		for rd := 0; rd < len(stream.data); rd += size {
+			end := rd + size
+			if end > len(stream.data) {
+				end = len(stream.data)
+			}
+			demuxer.Feed(stream.data[rd:end])
+		}
+		if offset := demuxer.Offset(); offset != uint64(len(stream.data)) {
+			t.Errorf("chunks of %d: offset %d, expected %d", size, offset, len(stream.data))
+		}
+		if packets := demuxer.dmx.globalStats.totalPackets; packets != 4 {
+			t.Errorf("chunks of %d: %d packets, expected 4", size, packets)
+		}
+		if found := diagnostics.count(DiagProgramFound); found != 1 {
+			t.Errorf("chunks of %d: program found %d times, expected 1", size, found)
+		}
+		if lost := diagnostics.count(DiagSyncLost); lost != 0 {
+			t.Errorf("chunks of %d: lost sync %d times", size, lost)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	stream := testPATStream()
+	demuxer, diagnostics := newTestDemuxer()
+	// a partial packet at the end is dropped
+	data := append(append([]byte(nil), stream.data...), 0x47, 0, 0)
+	if err := demuxer.Run(context.Background(), &chunkReader{data: data, size: 100}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if offset := demuxer.Offset(); offset != uint64(len(stream.data)) {
+		t.Errorf("offset %d, expected %d", offset, len(stream.data))
+	}
+	if found := diagnostics.count(DiagProgramFound); found != 1 {
+		t.Errorf("program found %d times, expected 1", found)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewDemuxer().Run(ctx, bytes.NewReader(stream.data)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run after cancel returned %v", err)
+	}
+}
+
+// with no sink only errors come back from Feed
+func TestFeedReturnsOnlyErrorsWithoutSink(t *testing.T) {
+	stream := newTestStream()
+	for i := 0; i < 4; i++ {
+		stream.section(0, testPAT())
+	}
+	// break the continuity counter of the last packet
+	stream.data[len(stream.data)-tsPacketSize+3] ^= 0x05
+	demuxer := NewDemuxer()
+	err := demuxer.Feed(stream.data)
+	var diagnostics Diagnostics
+	if !errors.As(err, &diagnostics) {
+		t.Fatalf("Feed returned %v, expected Diagnostics", err)
+	}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity != SeverityError {
+			t.Errorf("%v returned without a sink", diagnostic)
+		}
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Code != DiagContinuityError {
+		t.Errorf("Feed returned %v, expected 1 continuity error", err)
+	}
+}
+
+// Reports taken and decoders registered while another goroutine feeds the demuxer, run with -race
+// to check the locking
+func TestReportWhileFeeding(t *testing.T) {
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.section(0x100, testPMT(0, 0x1b, 0x101))
+	for i := 0; i < 50; i++ {
+		stream.packet(0x101, false, testPCRAdaptation(uint64(i)*27000), make([]byte, 176))
+	}
+	demuxer, _ := newTestDemuxer()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for rd := 0; rd < len(stream.data); rd += 100 {
+			end := rd + 100
+			if end > len(stream.data) {
+				end = len(stream.data)
+			}
+			demuxer.Feed(stream.data[rd:end])
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		report := demuxer.Report()
+		if report.TotalPackets > 52 {
+			t.Fatalf("%d packets, expected no more than 52", report.TotalPackets)
+		}
+		demuxer.SyncEvents()
+		demuxer.Offset()
+		demuxer.RegisterDescriptorDecoder(0x88, AnyPrivateDataSpecifier, testDescriptorDecoder("any"))
+		demuxer.RegisterTableDecoder(0x700, 0x90, func(pid uint16, section []byte) (interface{}, error) { return nil, nil })
+	}
+	if report := demuxer.Report(); report.TotalPackets != 52 {
+		t.Errorf("%d packets, expected 52", report.TotalPackets)
+	}
+}
@@ -0,0 +1,43 @@
+package tshelper
+
+// helpers shared by the table parsers for walking descriptor loops and reading the BCD and
+// length prefixed fields DVB SI is full of
+
+import (
+	"fmt"
+)
+
+// call found for each descriptor in a descriptor loop, in order.  An error means a descriptor ran
+// past the end of the loop, the ones before it have still been handed over
+func forEachDescriptor(loop []byte, found func(tag uint8, body []byte)) error {
+	for rd := 0; rd < len(loop); {
+		if rd+2 > len(loop) || rd+2+int(loop[rd+1]) > len(loop) {
+			return fmt.Errorf("descriptor 0x%02x runs past the end of its loop", loop[rd])
+		}
+		found(loop[rd], loop[rd+2:rd+2+int(loop[rd+1])])
+		rd += 2 + int(loop[rd+1])
+	}
+	return nil
+}
+
+// split off a loop that starts with a 12 bit length (the top 4 bits of the 2 bytes are reserved),
+// giving the loop and what follows it
+func lengthPrefixedLoop(data []byte) (loop []byte, rest []byte, err error) {
+	if len(data) < 2 {
+		return nil, nil, fmt.Errorf("%d bytes is too short for a loop length", len(data))
+	}
+	length := ((int(data[0]) << 8) | int(data[1])) & 0x0fff
+	if 2+length > len(data) {
+		return nil, nil, fmt.Errorf("loop length %d runs past the %d bytes left", length, len(data)-2)
+	}
+	return data[2 : 2+length], data[2+length:], nil
+}
+
+// value of a run of BCD digits, 2 to a byte
+func bcdValue(data []byte) uint64 {
+	value := uint64(0)
+	for _, b := range data {
+		value = value*100 + uint64(b>>4)*10 + uint64(b&0xf)
+	}
+	return value
+}
@@ -0,0 +1,184 @@
+package tshelper
+
+// diagnostics - anything odd found in the stream, from lost sync down to a descriptor with the
+// wrong length.  Each one says how bad it is, what it is and where it was found.  They go to the
+// DiagnosticSink if the caller has set one, otherwise errors are handed back from ParseTSDataBlob
+// and everything else is dropped.  Nothing is ever printed
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Severity of a diagnostic
+type Severity uint8
+
+const (
+	SeverityInfo    Severity = iota // worth knowing, nothing is wrong
+	SeverityWarning                 // something is odd, but nothing has been lost
+	SeverityError                   // data has been lost or could not be used
+)
+
+func (severity Severity) String() string {
+	switch severity {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// DiagnosticCode says what a diagnostic is about, so callers can filter without matching on text
+type DiagnosticCode uint16
+
+const (
+	DiagSyncAcquired DiagnosticCode = iota + 1
+	DiagSyncLost
+	DiagContinuityError
+	DiagBadAdaptationField
+	DiagBadPointerField
+	DiagBadSectionLength
+	DiagSectionDiscarded
+	DiagBadDescriptor
+	DiagProgramFound
+	DiagPESDiscarded
+	DiagBadPESHeader
+	DiagMissingTimestamp
+	DiagTimestampWrap
+	DiagPTSJump
+	DiagDTSNonMonotonic
+	DiagCRCError
+	DiagTableChangedWithoutVersion
+	DiagBadSectionNumber
+	DiagBadSpliceInfo
+	DiagLateSpliceCue
+	DiagSplicePassed
+	DiagSpliceNotOnIDR
+	DiagBadTable
+	DiagClockJump
+	DiagUndecodableText
+)
+
+func (code DiagnosticCode) String() string {
+	switch code {
+	case DiagSyncAcquired:
+		return "SyncAcquired"
+	case DiagSyncLost:
+		return "SyncLost"
+	case DiagContinuityError:
+		return "ContinuityError"
+	case DiagBadAdaptationField:
+		return "BadAdaptationField"
+	case DiagBadPointerField:
+		return "BadPointerField"
+	case DiagBadSectionLength:
+		return "BadSectionLength"
+	case DiagSectionDiscarded:
+		return "SectionDiscarded"
+	case DiagBadDescriptor:
+		return "BadDescriptor"
+	case DiagProgramFound:
+		return "ProgramFound"
+	case DiagPESDiscarded:
+		return "PESDiscarded"
+	case DiagBadPESHeader:
+		return "BadPESHeader"
+	case DiagMissingTimestamp:
+		return "MissingTimestamp"
+	case DiagTimestampWrap:
+		return "TimestampWrap"
+	case DiagPTSJump:
+		return "PTSJump"
+	case DiagDTSNonMonotonic:
+		return "DTSNonMonotonic"
+	case DiagCRCError:
+		return "CRCError"
+	case DiagTableChangedWithoutVersion:
+		return "TableChangedWithoutVersion"
+	case DiagBadSectionNumber:
+		return "BadSectionNumber"
+	case DiagBadSpliceInfo:
+		return "BadSpliceInfo"
+	case DiagLateSpliceCue:
+		return "LateSpliceCue"
+	case DiagSplicePassed:
+		return "SplicePassed"
+	case DiagSpliceNotOnIDR:
+		return "SpliceNotOnIDR"
+	case DiagBadTable:
+		return "BadTable"
+	case DiagClockJump:
+		return "ClockJump"
+	case DiagUndecodableText:
+		return "UndecodableText"
+	}
+	return "unknown"
+}
+
+// Position says where in the stream something was found
+type Position struct {
+	PID         uint16    // PID of the packet, not meaningful for sync diagnostics
+	PacketIndex uint64    // number of packets demuxed before this one
+	Offset      uint64    // stream byte offset of the packet (or byte) concerned
+	UTC         time.Time // wall clock time from the PCR once a TDT / TOT has given it, else zero
+
+	ArrivalTimestamp uint32 // M2TS only - the packet's 27MHz arrival_time_stamp, 0 for other formats
+}
+
+// Diagnostic is one problem or observation about the stream
+type Diagnostic struct {
+	Position
+	Severity Severity
+	Code     DiagnosticCode
+	Message  string
+}
+
+func (diag *Diagnostic) Error() string {
+	return fmt.Sprintf("%v %v: PID 0x%x packet %d offset %d: %s", diag.Severity, diag.Code, diag.PID, diag.PacketIndex, diag.Offset, diag.Message)
+}
+
+// DiagnosticSink is called with each diagnostic as it is raised, on the goroutine doing the demuxing
+type DiagnosticSink func(diag *Diagnostic)
+
+// Diagnostics is the error ParseTSDataBlob returns when errors were found and there is no sink
+type Diagnostics []*Diagnostic
+
+func (list Diagnostics) Error() string {
+	messages := make([]string, len(list))
+	for i, diag := range list {
+		messages[i] = diag.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// reporter is shared (by pointer) between the tsdmx and the tableParser.  It knows where the packet
+// being processed sits in the stream, so whatever raises a diagnostic or event doesn't have to
+type reporter struct {
+	sink     DiagnosticSink
+	position Position
+	errs     Diagnostics // errors from the current ParseTSDataBlob call, only kept when sink is nil
+	handlers []Handler   // see events.go
+}
+
+func (rep *reporter) raise(severity Severity, code DiagnosticCode, format string, args ...interface{}) {
+	rep.raiseAt(rep.position, severity, code, format, args...)
+}
+
+func (rep *reporter) raiseAt(position Position, severity Severity, code DiagnosticCode, format string, args ...interface{}) {
+	diag := &Diagnostic{Position: position, Severity: severity, Code: code, Message: fmt.Sprintf(format, args...)}
+	if rep.sink != nil {
+		rep.sink(diag)
+	} else if severity == SeverityError {
+		rep.errs = append(rep.errs, diag)
+	}
+}
+
+// SetDiagnosticSink sets where diagnostics go, every severity of them.  nil goes back to returning
+// just the errors from ParseTSDataBlob
+func (metaInfo tsdmx) SetDiagnosticSink(sink DiagnosticSink) {
+	metaInfo.report.sink = sink
+}
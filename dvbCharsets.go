@@ -0,0 +1,273 @@
+package tshelper
+
+// the top halves (0xA0 - 0xFF) of the ISO/IEC 8859 character tables DVB text can select, see
+// dvbText.go.  0xFFFD marks codes a table leaves undefined.  8859-1 needs no table, its top half
+// is the same as Unicode
+
+var iso8859Tables = map[uint8]*[96]rune{
+	2: {
+		0x00a0, 0x0104, 0x02d8, 0x0141, 0x00a4, 0x013d, 0x015a, 0x00a7,
+		0x00a8, 0x0160, 0x015e, 0x0164, 0x0179, 0x00ad, 0x017d, 0x017b,
+		0x00b0, 0x0105, 0x02db, 0x0142, 0x00b4, 0x013e, 0x015b, 0x02c7,
+		0x00b8, 0x0161, 0x015f, 0x0165, 0x017a, 0x02dd, 0x017e, 0x017c,
+		0x0154, 0x00c1, 0x00c2, 0x0102, 0x00c4, 0x0139, 0x0106, 0x00c7,
+		0x010c, 0x00c9, 0x0118, 0x00cb, 0x011a, 0x00cd, 0x00ce, 0x010e,
+		0x0110, 0x0143, 0x0147, 0x00d3, 0x00d4, 0x0150, 0x00d6, 0x00d7,
+		0x0158, 0x016e, 0x00da, 0x0170, 0x00dc, 0x00dd, 0x0162, 0x00df,
+		0x0155, 0x00e1, 0x00e2, 0x0103, 0x00e4, 0x013a, 0x0107, 0x00e7,
+		0x010d, 0x00e9, 0x0119, 0x00eb, 0x011b, 0x00ed, 0x00ee, 0x010f,
+		0x0111, 0x0144, 0x0148, 0x00f3, 0x00f4, 0x0151, 0x00f6, 0x00f7,
+		0x0159, 0x016f, 0x00fa, 0x0171, 0x00fc, 0x00fd, 0x0163, 0x02d9,
+	},
+	3: {
+		0x00a0, 0x0126, 0x02d8, 0x00a3, 0x00a4, 0xfffd, 0x0124, 0x00a7,
+		0x00a8, 0x0130, 0x015e, 0x011e, 0x0134, 0x00ad, 0xfffd, 0x017b,
+		0x00b0, 0x0127, 0x00b2, 0x00b3, 0x00b4, 0x00b5, 0x0125, 0x00b7,
+		0x00b8, 0x0131, 0x015f, 0x011f, 0x0135, 0x00bd, 0xfffd, 0x017c,
+		0x00c0, 0x00c1, 0x00c2, 0xfffd, 0x00c4, 0x010a, 0x0108, 0x00c7,
+		0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+		0xfffd, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x0120, 0x00d6, 0x00d7,
+		0x011c, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x016c, 0x015c, 0x00df,
+		0x00e0, 0x00e1, 0x00e2, 0xfffd, 0x00e4, 0x010b, 0x0109, 0x00e7,
+		0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+		0xfffd, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x0121, 0x00f6, 0x00f7,
+		0x011d, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x016d, 0x015d, 0x02d9,
+	},
+	4: {
+		0x00a0, 0x0104, 0x0138, 0x0156, 0x00a4, 0x0128, 0x013b, 0x00a7,
+		0x00a8, 0x0160, 0x0112, 0x0122, 0x0166, 0x00ad, 0x017d, 0x00af,
+		0x00b0, 0x0105, 0x02db, 0x0157, 0x00b4, 0x0129, 0x013c, 0x02c7,
+		0x00b8, 0x0161, 0x0113, 0x0123, 0x0167, 0x014a, 0x017e, 0x014b,
+		0x0100, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x012e,
+		0x010c, 0x00c9, 0x0118, 0x00cb, 0x0116, 0x00cd, 0x00ce, 0x012a,
+		0x0110, 0x0145, 0x014c, 0x0136, 0x00d4, 0x00d5, 0x00d6, 0x00d7,
+		0x00d8, 0x0172, 0x00da, 0x00db, 0x00dc, 0x0168, 0x016a, 0x00df,
+		0x0101, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x012f,
+		0x010d, 0x00e9, 0x0119, 0x00eb, 0x0117, 0x00ed, 0x00ee, 0x012b,
+		0x0111, 0x0146, 0x014d, 0x0137, 0x00f4, 0x00f5, 0x00f6, 0x00f7,
+		0x00f8, 0x0173, 0x00fa, 0x00fb, 0x00fc, 0x0169, 0x016b, 0x02d9,
+	},
+	5: {
+		0x00a0, 0x0401, 0x0402, 0x0403, 0x0404, 0x0405, 0x0406, 0x0407,
+		0x0408, 0x0409, 0x040a, 0x040b, 0x040c, 0x00ad, 0x040e, 0x040f,
+		0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+		0x0418, 0x0419, 0x041a, 0x041b, 0x041c, 0x041d, 0x041e, 0x041f,
+		0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+		0x0428, 0x0429, 0x042a, 0x042b, 0x042c, 0x042d, 0x042e, 0x042f,
+		0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+		0x0438, 0x0439, 0x043a, 0x043b, 0x043c, 0x043d, 0x043e, 0x043f,
+		0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+		0x0448, 0x0449, 0x044a, 0x044b, 0x044c, 0x044d, 0x044e, 0x044f,
+		0x2116, 0x0451, 0x0452, 0x0453, 0x0454, 0x0455, 0x0456, 0x0457,
+		0x0458, 0x0459, 0x045a, 0x045b, 0x045c, 0x00a7, 0x045e, 0x045f,
+	},
+	6: {
+		0x00a0, 0xfffd, 0xfffd, 0xfffd, 0x00a4, 0xfffd, 0xfffd, 0xfffd,
+		0xfffd, 0xfffd, 0xfffd, 0xfffd, 0x060c, 0x00ad, 0xfffd, 0xfffd,
+		0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+		0xfffd, 0xfffd, 0xfffd, 0x061b, 0xfffd, 0xfffd, 0xfffd, 0x061f,
+		0xfffd, 0x0621, 0x0622, 0x0623, 0x0624, 0x0625, 0x0626, 0x0627,
+		0x0628, 0x0629, 0x062a, 0x062b, 0x062c, 0x062d, 0x062e, 0x062f,
+		0x0630, 0x0631, 0x0632, 0x0633, 0x0634, 0x0635, 0x0636, 0x0637,
+		0x0638, 0x0639, 0x063a, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+		0x0640, 0x0641, 0x0642, 0x0643, 0x0644, 0x0645, 0x0646, 0x0647,
+		0x0648, 0x0649, 0x064a, 0x064b, 0x064c, 0x064d, 0x064e, 0x064f,
+		0x0650, 0x0651, 0x0652, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+		0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+	},
+	7: {
+		0x00a0, 0x2018, 0x2019, 0x00a3, 0x20ac, 0x20af, 0x00a6, 0x00a7,
+		0x00a8, 0x00a9, 0x037a, 0x00ab, 0x00ac, 0x00ad, 0xfffd, 0x2015,
+		0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x0384, 0x0385, 0x0386, 0x00b7,
+		0x0388, 0x0389, 0x038a, 0x00bb, 0x038c, 0x00bd, 0x038e, 0x038f,
+		0x0390, 0x0391, 0x0392, 0x0393, 0x0394, 0x0395, 0x0396, 0x0397,
+		0x0398, 0x0399, 0x039a, 0x039b, 0x039c, 0x039d, 0x039e, 0x039f,
+		0x03a0, 0x03a1, 0xfffd, 0x03a3, 0x03a4, 0x03a5, 0x03a6, 0x03a7,
+		0x03a8, 0x03a9, 0x03aa, 0x03ab, 0x03ac, 0x03ad, 0x03ae, 0x03af,
+		0x03b0, 0x03b1, 0x03b2, 0x03b3, 0x03b4, 0x03b5, 0x03b6, 0x03b7,
+		0x03b8, 0x03b9, 0x03ba, 0x03bb, 0x03bc, 0x03bd, 0x03be, 0x03bf,
+		0x03c0, 0x03c1, 0x03c2, 0x03c3, 0x03c4, 0x03c5, 0x03c6, 0x03c7,
+		0x03c8, 0x03c9, 0x03ca, 0x03cb, 0x03cc, 0x03cd, 0x03ce, 0xfffd,
+	},
+	8: {
+		0x00a0, 0xfffd, 0x00a2, 0x00a3, 0x00a4, 0x00a5, 0x00a6, 0x00a7,
+		0x00a8, 0x00a9, 0x00d7, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x00af,
+		0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x00b4, 0x00b5, 0x00b6, 0x00b7,
+		0x00b8, 0x00b9, 0x00f7, 0x00bb, 0x00bc, 0x00bd, 0x00be, 0xfffd,
+		0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+		0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+		0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+		0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0x2017,
+		0x05d0, 0x05d1, 0x05d2, 0x05d3, 0x05d4, 0x05d5, 0x05d6, 0x05d7,
+		0x05d8, 0x05d9, 0x05da, 0x05db, 0x05dc, 0x05dd, 0x05de, 0x05df,
+		0x05e0, 0x05e1, 0x05e2, 0x05e3, 0x05e4, 0x05e5, 0x05e6, 0x05e7,
+		0x05e8, 0x05e9, 0x05ea, 0xfffd, 0xfffd, 0x200e, 0x200f, 0xfffd,
+	},
+	9: {
+		0x00a0, 0x00a1, 0x00a2, 0x00a3, 0x00a4, 0x00a5, 0x00a6, 0x00a7,
+		0x00a8, 0x00a9, 0x00aa, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x00af,
+		0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x00b4, 0x00b5, 0x00b6, 0x00b7,
+		0x00b8, 0x00b9, 0x00ba, 0x00bb, 0x00bc, 0x00bd, 0x00be, 0x00bf,
+		0x00c0, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x00c7,
+		0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+		0x011e, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x00d7,
+		0x00d8, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x0130, 0x015e, 0x00df,
+		0x00e0, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x00e7,
+		0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+		0x011f, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x00f7,
+		0x00f8, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x0131, 0x015f, 0x00ff,
+	},
+	10: {
+		0x00a0, 0x0104, 0x0112, 0x0122, 0x012a, 0x0128, 0x0136, 0x00a7,
+		0x013b, 0x0110, 0x0160, 0x0166, 0x017d, 0x00ad, 0x016a, 0x014a,
+		0x00b0, 0x0105, 0x0113, 0x0123, 0x012b, 0x0129, 0x0137, 0x00b7,
+		0x013c, 0x0111, 0x0161, 0x0167, 0x017e, 0x2015, 0x016b, 0x014b,
+		0x0100, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x012e,
+		0x010c, 0x00c9, 0x0118, 0x00cb, 0x0116, 0x00cd, 0x00ce, 0x00cf,
+		0x00d0, 0x0145, 0x014c, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x0168,
+		0x00d8, 0x0172, 0x00da, 0x00db, 0x00dc, 0x00dd, 0x00de, 0x00df,
+		0x0101, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x012f,
+		0x010d, 0x00e9, 0x0119, 0x00eb, 0x0117, 0x00ed, 0x00ee, 0x00ef,
+		0x00f0, 0x0146, 0x014d, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x0169,
+		0x00f8, 0x0173, 0x00fa, 0x00fb, 0x00fc, 0x00fd, 0x00fe, 0x0138,
+	},
+	11: {
+		0x00a0, 0x0e01, 0x0e02, 0x0e03, 0x0e04, 0x0e05, 0x0e06, 0x0e07,
+		0x0e08, 0x0e09, 0x0e0a, 0x0e0b, 0x0e0c, 0x0e0d, 0x0e0e, 0x0e0f,
+		0x0e10, 0x0e11, 0x0e12, 0x0e13, 0x0e14, 0x0e15, 0x0e16, 0x0e17,
+		0x0e18, 0x0e19, 0x0e1a, 0x0e1b, 0x0e1c, 0x0e1d, 0x0e1e, 0x0e1f,
+		0x0e20, 0x0e21, 0x0e22, 0x0e23, 0x0e24, 0x0e25, 0x0e26, 0x0e27,
+		0x0e28, 0x0e29, 0x0e2a, 0x0e2b, 0x0e2c, 0x0e2d, 0x0e2e, 0x0e2f,
+		0x0e30, 0x0e31, 0x0e32, 0x0e33, 0x0e34, 0x0e35, 0x0e36, 0x0e37,
+		0x0e38, 0x0e39, 0x0e3a, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0x0e3f,
+		0x0e40, 0x0e41, 0x0e42, 0x0e43, 0x0e44, 0x0e45, 0x0e46, 0x0e47,
+		0x0e48, 0x0e49, 0x0e4a, 0x0e4b, 0x0e4c, 0x0e4d, 0x0e4e, 0x0e4f,
+		0x0e50, 0x0e51, 0x0e52, 0x0e53, 0x0e54, 0x0e55, 0x0e56, 0x0e57,
+		0x0e58, 0x0e59, 0x0e5a, 0x0e5b, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+	},
+	13: {
+		0x00a0, 0x201d, 0x00a2, 0x00a3, 0x00a4, 0x201e, 0x00a6, 0x00a7,
+		0x00d8, 0x00a9, 0x0156, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x00c6,
+		0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x201c, 0x00b5, 0x00b6, 0x00b7,
+		0x00f8, 0x00b9, 0x0157, 0x00bb, 0x00bc, 0x00bd, 0x00be, 0x00e6,
+		0x0104, 0x012e, 0x0100, 0x0106, 0x00c4, 0x00c5, 0x0118, 0x0112,
+		0x010c, 0x00c9, 0x0179, 0x0116, 0x0122, 0x0136, 0x012a, 0x013b,
+		0x0160, 0x0143, 0x0145, 0x00d3, 0x014c, 0x00d5, 0x00d6, 0x00d7,
+		0x0172, 0x0141, 0x015a, 0x016a, 0x00dc, 0x017b, 0x017d, 0x00df,
+		0x0105, 0x012f, 0x0101, 0x0107, 0x00e4, 0x00e5, 0x0119, 0x0113,
+		0x010d, 0x00e9, 0x017a, 0x0117, 0x0123, 0x0137, 0x012b, 0x013c,
+		0x0161, 0x0144, 0x0146, 0x00f3, 0x014d, 0x00f5, 0x00f6, 0x00f7,
+		0x0173, 0x0142, 0x015b, 0x016b, 0x00fc, 0x017c, 0x017e, 0x2019,
+	},
+	14: {
+		0x00a0, 0x1e02, 0x1e03, 0x00a3, 0x010a, 0x010b, 0x1e0a, 0x00a7,
+		0x1e80, 0x00a9, 0x1e82, 0x1e0b, 0x1ef2, 0x00ad, 0x00ae, 0x0178,
+		0x1e1e, 0x1e1f, 0x0120, 0x0121, 0x1e40, 0x1e41, 0x00b6, 0x1e56,
+		0x1e81, 0x1e57, 0x1e83, 0x1e60, 0x1ef3, 0x1e84, 0x1e85, 0x1e61,
+		0x00c0, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x00c7,
+		0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+		0x0174, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x1e6a,
+		0x00d8, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x00dd, 0x0176, 0x00df,
+		0x00e0, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x00e7,
+		0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+		0x0175, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x1e6b,
+		0x00f8, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x00fd, 0x0177, 0x00ff,
+	},
+	15: {
+		0x00a0, 0x00a1, 0x00a2, 0x00a3, 0x20ac, 0x00a5, 0x0160, 0x00a7,
+		0x0161, 0x00a9, 0x00aa, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x00af,
+		0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x017d, 0x00b5, 0x00b6, 0x00b7,
+		0x017e, 0x00b9, 0x00ba, 0x00bb, 0x0152, 0x0153, 0x0178, 0x00bf,
+		0x00c0, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x00c7,
+		0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+		0x00d0, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x00d7,
+		0x00d8, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x00dd, 0x00de, 0x00df,
+		0x00e0, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x00e7,
+		0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+		0x00f0, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x00f7,
+		0x00f8, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x00fd, 0x00fe, 0x00ff,
+	},
+	16: {
+		0x00a0, 0x0104, 0x0105, 0x0141, 0x20ac, 0x201e, 0x0160, 0x00a7,
+		0x0161, 0x00a9, 0x0218, 0x00ab, 0x0179, 0x00ad, 0x017a, 0x017b,
+		0x00b0, 0x00b1, 0x010c, 0x0142, 0x017d, 0x201d, 0x00b6, 0x00b7,
+		0x017e, 0x010d, 0x0219, 0x00bb, 0x0152, 0x0153, 0x0178, 0x017c,
+		0x00c0, 0x00c1, 0x00c2, 0x0102, 0x00c4, 0x0106, 0x00c6, 0x00c7,
+		0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+		0x0110, 0x0143, 0x00d2, 0x00d3, 0x00d4, 0x0150, 0x00d6, 0x015a,
+		0x0170, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x0118, 0x021a, 0x00df,
+		0x00e0, 0x00e1, 0x00e2, 0x0103, 0x00e4, 0x0107, 0x00e6, 0x00e7,
+		0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+		0x0111, 0x0144, 0x00f2, 0x00f3, 0x00f4, 0x0151, 0x00f6, 0x015b,
+		0x0171, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x0119, 0x021b, 0x00ff,
+	},
+}
+
+// ISO/IEC 6937 non-spacing diacritical marks (0xC1 - 0xCF), the combining character each one is
+var iso6937Diacritics = map[uint8]rune{
+	0xc1: 0x0300, // combining grave accent
+	0xc2: 0x0301, // combining acute accent
+	0xc3: 0x0302, // combining circumflex accent
+	0xc4: 0x0303, // combining tilde
+	0xc5: 0x0304, // combining macron
+	0xc6: 0x0306, // combining breve
+	0xc7: 0x0307, // combining dot above
+	0xc8: 0x0308, // combining diaeresis
+	0xca: 0x030a, // combining ring above
+	0xcb: 0x0327, // combining cedilla
+	0xcd: 0x030b, // combining double acute accent
+	0xce: 0x0328, // combining ogonek
+	0xcf: 0x030c, // combining caron
+}
+
+// ISO/IEC 6937 diacritical mark and letter pairs that Unicode has a single character for, keyed by
+// mark << 8 | letter
+var iso6937Composed = map[uint16]rune{
+	0xc141: 0x00c0, 0xc145: 0x00c8, 0xc149: 0x00cc, 0xc14e: 0x01f8, 0xc14f: 0x00d2, 0xc155: 0x00d9,
+	0xc157: 0x1e80, 0xc159: 0x1ef2, 0xc161: 0x00e0, 0xc165: 0x00e8, 0xc169: 0x00ec, 0xc16e: 0x01f9,
+	0xc16f: 0x00f2, 0xc175: 0x00f9, 0xc177: 0x1e81, 0xc179: 0x1ef3,
+	0xc241: 0x00c1, 0xc243: 0x0106, 0xc245: 0x00c9, 0xc247: 0x01f4, 0xc249: 0x00cd, 0xc24b: 0x1e30,
+	0xc24c: 0x0139, 0xc24d: 0x1e3e, 0xc24e: 0x0143, 0xc24f: 0x00d3, 0xc250: 0x1e54, 0xc252: 0x0154,
+	0xc253: 0x015a, 0xc255: 0x00da, 0xc257: 0x1e82, 0xc259: 0x00dd, 0xc25a: 0x0179, 0xc261: 0x00e1,
+	0xc263: 0x0107, 0xc265: 0x00e9, 0xc267: 0x01f5, 0xc269: 0x00ed, 0xc26b: 0x1e31, 0xc26c: 0x013a,
+	0xc26d: 0x1e3f, 0xc26e: 0x0144, 0xc26f: 0x00f3, 0xc270: 0x1e55, 0xc272: 0x0155, 0xc273: 0x015b,
+	0xc275: 0x00fa, 0xc277: 0x1e83, 0xc279: 0x00fd, 0xc27a: 0x017a,
+	0xc341: 0x00c2, 0xc343: 0x0108, 0xc345: 0x00ca, 0xc347: 0x011c, 0xc348: 0x0124, 0xc349: 0x00ce,
+	0xc34a: 0x0134, 0xc34f: 0x00d4, 0xc353: 0x015c, 0xc355: 0x00db, 0xc357: 0x0174, 0xc359: 0x0176,
+	0xc35a: 0x1e90, 0xc361: 0x00e2, 0xc363: 0x0109, 0xc365: 0x00ea, 0xc367: 0x011d, 0xc368: 0x0125,
+	0xc369: 0x00ee, 0xc36a: 0x0135, 0xc36f: 0x00f4, 0xc373: 0x015d, 0xc375: 0x00fb, 0xc377: 0x0175,
+	0xc379: 0x0177, 0xc37a: 0x1e91,
+	0xc441: 0x00c3, 0xc445: 0x1ebc, 0xc449: 0x0128, 0xc44e: 0x00d1, 0xc44f: 0x00d5, 0xc455: 0x0168,
+	0xc456: 0x1e7c, 0xc459: 0x1ef8, 0xc461: 0x00e3, 0xc465: 0x1ebd, 0xc469: 0x0129, 0xc46e: 0x00f1,
+	0xc46f: 0x00f5, 0xc475: 0x0169, 0xc476: 0x1e7d, 0xc479: 0x1ef9,
+	0xc541: 0x0100, 0xc545: 0x0112, 0xc547: 0x1e20, 0xc549: 0x012a, 0xc54f: 0x014c, 0xc555: 0x016a,
+	0xc559: 0x0232, 0xc561: 0x0101, 0xc565: 0x0113, 0xc567: 0x1e21, 0xc569: 0x012b, 0xc56f: 0x014d,
+	0xc575: 0x016b, 0xc579: 0x0233,
+	0xc641: 0x0102, 0xc645: 0x0114, 0xc647: 0x011e, 0xc649: 0x012c, 0xc64f: 0x014e, 0xc655: 0x016c,
+	0xc661: 0x0103, 0xc665: 0x0115, 0xc667: 0x011f, 0xc669: 0x012d, 0xc66f: 0x014f, 0xc675: 0x016d,
+	0xc741: 0x0226, 0xc742: 0x1e02, 0xc743: 0x010a, 0xc744: 0x1e0a, 0xc745: 0x0116, 0xc746: 0x1e1e,
+	0xc747: 0x0120, 0xc748: 0x1e22, 0xc749: 0x0130, 0xc74d: 0x1e40, 0xc74e: 0x1e44, 0xc74f: 0x022e,
+	0xc750: 0x1e56, 0xc752: 0x1e58, 0xc753: 0x1e60, 0xc754: 0x1e6a, 0xc757: 0x1e86, 0xc758: 0x1e8a,
+	0xc759: 0x1e8e, 0xc75a: 0x017b, 0xc761: 0x0227, 0xc762: 0x1e03, 0xc763: 0x010b, 0xc764: 0x1e0b,
+	0xc765: 0x0117, 0xc766: 0x1e1f, 0xc767: 0x0121, 0xc768: 0x1e23, 0xc76d: 0x1e41, 0xc76e: 0x1e45,
+	0xc76f: 0x022f, 0xc770: 0x1e57, 0xc772: 0x1e59, 0xc773: 0x1e61, 0xc774: 0x1e6b, 0xc777: 0x1e87,
+	0xc778: 0x1e8b, 0xc779: 0x1e8f, 0xc77a: 0x017c,
+	0xc841: 0x00c4, 0xc845: 0x00cb, 0xc848: 0x1e26, 0xc849: 0x00cf, 0xc84f: 0x00d6, 0xc855: 0x00dc,
+	0xc857: 0x1e84, 0xc858: 0x1e8c, 0xc859: 0x0178, 0xc861: 0x00e4, 0xc865: 0x00eb, 0xc868: 0x1e27,
+	0xc869: 0x00ef, 0xc86f: 0x00f6, 0xc874: 0x1e97, 0xc875: 0x00fc, 0xc877: 0x1e85, 0xc878: 0x1e8d,
+	0xc879: 0x00ff,
+	0xca41: 0x00c5, 0xca55: 0x016e, 0xca61: 0x00e5, 0xca75: 0x016f, 0xca77: 0x1e98, 0xca79: 0x1e99,
+	0xcb43: 0x00c7, 0xcb44: 0x1e10, 0xcb45: 0x0228, 0xcb47: 0x0122, 0xcb48: 0x1e28, 0xcb4b: 0x0136,
+	0xcb4c: 0x013b, 0xcb4e: 0x0145, 0xcb52: 0x0156, 0xcb53: 0x015e, 0xcb54: 0x0162, 0xcb63: 0x00e7,
+	0xcb64: 0x1e11, 0xcb65: 0x0229, 0xcb67: 0x0123, 0xcb68: 0x1e29, 0xcb6b: 0x0137, 0xcb6c: 0x013c,
+	0xcb6e: 0x0146, 0xcb72: 0x0157, 0xcb73: 0x015f, 0xcb74: 0x0163,
+	0xcd4f: 0x0150, 0xcd55: 0x0170, 0xcd6f: 0x0151, 0xcd75: 0x0171,
+	0xce41: 0x0104, 0xce45: 0x0118, 0xce49: 0x012e, 0xce4f: 0x01ea, 0xce55: 0x0172, 0xce61: 0x0105,
+	0xce65: 0x0119, 0xce69: 0x012f, 0xce6f: 0x01eb, 0xce75: 0x0173,
+	0xcf41: 0x01cd, 0xcf43: 0x010c, 0xcf44: 0x010e, 0xcf45: 0x011a, 0xcf47: 0x01e6, 0xcf48: 0x021e,
+	0xcf49: 0x01cf, 0xcf4b: 0x01e8, 0xcf4c: 0x013d, 0xcf4e: 0x0147, 0xcf4f: 0x01d1, 0xcf52: 0x0158,
+	0xcf53: 0x0160, 0xcf54: 0x0164, 0xcf55: 0x01d3, 0xcf5a: 0x017d, 0xcf61: 0x01ce, 0xcf63: 0x010d,
+	0xcf64: 0x010f, 0xcf65: 0x011b, 0xcf67: 0x01e7, 0xcf68: 0x021f, 0xcf69: 0x01d0, 0xcf6a: 0x01f0,
+	0xcf6b: 0x01e9, 0xcf6c: 0x013e, 0xcf6e: 0x0148, 0xcf6f: 0x01d2, 0xcf72: 0x0159, 0xcf73: 0x0161,
+	0xcf74: 0x0165, 0xcf75: 0x01d4, 0xcf7a: 0x017e,
+}
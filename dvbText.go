@@ -0,0 +1,230 @@
+package tshelper
+
+// DVB text (EN 300 468 Annex A).  Names and descriptions in the SI start with an optional byte
+// choosing the character table, with none meaning table 00, ISO/IEC 6937 plus the euro sign.
+//   0x01 - 0x0B         ISO/IEC 8859-5 to 8859-15 (there is no 8859-12, so 0x08 is reserved)
+//   0x10 0x00 n         ISO/IEC 8859-n
+//   0x11                ISO/IEC 10646 Basic Multilingual Plane, 2 bytes a character
+//   0x12 / 0x13 / 0x14  KS X 1001 / GB-2312 / Big5, which need tables we don't carry
+//   0x15                UTF-8
+//   0x1F n              a compression scheme (encoding_type_id), which we can't undo
+// Text in the tables we can't decode keeps its ASCII, with U+FFFD for every other character, and
+// the parsers raise an UndecodableText diagnostic for it rather than pass it off as the real thing.
+// Codes 0x80 - 0x9F are control codes in the 1 byte tables, and U+E080 - U+E09F in the others.
+// 0x86 / 0x87 turn emphasis on and off, which plain text can't show, and 0x8A is a new line
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ISO/IEC 6937 codes 0xA0 - 0xFF that are a character by themselves.  The diacritical marks,
+// 0xC1 - 0xCF, are in dvbCharsets.go
+var iso6937Table = [96]rune{
+	0x00a0, 0x00a1, 0x00a2, 0x00a3, 0x20ac, 0x00a5, 0x0023, 0x00a7, // 0xA4 is the euro sign in DVB
+	0x00a4, 0x2018, 0x201c, 0x00ab, 0x2190, 0x2191, 0x2192, 0x2193,
+	0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x00d7, 0x00b5, 0x00b6, 0x00b7,
+	0x00f7, 0x2019, 0x201d, 0x00bb, 0x00bc, 0x00bd, 0x00be, 0x00bf,
+	0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+	0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd, 0xfffd,
+	0x2015, 0x00b9, 0x00ae, 0x00a9, 0x2122, 0x266a, 0x00ac, 0x00a6,
+	0xfffd, 0xfffd, 0xfffd, 0xfffd, 0x215b, 0x215c, 0x215d, 0x215e,
+	0x2126, 0x00c6, 0x0110, 0x00aa, 0x0126, 0xfffd, 0x0132, 0x013f,
+	0x0141, 0x00d8, 0x0152, 0x00ba, 0x00de, 0x0166, 0x014a, 0x0149,
+	0x0138, 0x00e6, 0x0111, 0x00f0, 0x0127, 0x0131, 0x0133, 0x0140,
+	0x0142, 0x00f8, 0x0153, 0x00df, 0x00fe, 0x0167, 0x014b, 0x00ad,
+}
+
+// 1 byte table selected by 0x01 - 0x0B, as an ISO/IEC 8859 part
+var dvbSelectorParts = []uint8{0, 5, 6, 7, 8, 9, 10, 11, 0, 13, 14, 15}
+
+// text being put back together, with the control codes dealt with
+type dvbTextBuilder struct {
+	text []rune
+}
+
+func (builder *dvbTextBuilder) add(char rune) {
+	switch {
+	case char == 0x8a || char == 0xe08a:
+		builder.text = append(builder.text, '\n')
+	case char < 0x20 || (char >= 0x80 && char < 0xa0) || (char >= 0xe080 && char < 0xe0a0):
+		// emphasis, the other control codes and anything reserved or user defined
+	default:
+		builder.text = append(builder.text, char)
+	}
+}
+
+// text in a character table there is no decoder for.  The text is still worth having, so the
+// table parsers carry on past it and hand it back once they are done, unless something worse
+// turned up
+type undecodableTextError struct {
+	selector uint8
+}
+
+func (err undecodableTextError) Error() string {
+	name := "reserved"
+	switch err.selector {
+	case 0x12:
+		name = "KS X 1001"
+	case 0x13:
+		name = "GB-2312"
+	case 0x14:
+		name = "Big5"
+	case 0x10:
+		name = "ISO/IEC 8859 part with no table"
+	case 0x1f:
+		name = "compressed"
+	}
+	return fmt.Sprintf("text in character table 0x%02x (%s) can't be decoded", err.selector, name)
+}
+
+func isUndecodableText(err error) bool {
+	var textErr undecodableTextError
+	return errors.As(err, &textErr)
+}
+
+// the error worth keeping of 2, the one kept so far unless it is only undecodable text and err
+// is worse
+func worseError(kept, err error) error {
+	if kept == nil || (err != nil && isUndecodableText(kept) && !isUndecodableText(err)) {
+		return err
+	}
+	return kept
+}
+
+// the diagnostic for an error from one of the table parsers
+func tableErrorCode(err error) DiagnosticCode {
+	if isUndecodableText(err) {
+		return DiagUndecodableText
+	}
+	return DiagBadTable
+}
+
+// DecodeDVBText turns a string from the SI, character table selector and all, into Go's UTF-8.
+// Characters it can't decode come out as U+FFFD, which is every character that isn't ASCII for
+// the tables we don't carry
+func DecodeDVBText(data []byte) string {
+	text, _ := decodeDVBText(data)
+	return text
+}
+
+// DecodeDVBText, with an error when the text is in a table there is no decoder for
+func decodeDVBText(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	var err error
+	builder := &dvbTextBuilder{}
+	selector := data[0]
+	switch {
+	case selector >= 0x20:
+		decodeISO6937(builder, data)
+	case selector >= 0x01 && selector <= 0x0b:
+		if !decodeISO8859(builder, dvbSelectorParts[selector], data[1:]) {
+			err = undecodableTextError{selector: selector}
+		}
+	case selector == 0x10:
+		if len(data) < 3 {
+			return "", nil
+		}
+		if !decodeISO8859(builder, data[2], data[3:]) {
+			err = undecodableTextError{selector: selector}
+		}
+	case selector == 0x11:
+		for rd := 1; rd+2 <= len(data); rd += 2 {
+			builder.add((rune(data[rd]) << 8) | rune(data[rd+1]))
+		}
+	case selector == 0x15:
+		for rd := 1; rd < len(data); {
+			char, size := utf8.DecodeRune(data[rd:])
+			builder.add(char)
+			rd += size
+		}
+	case selector >= 0x12 && selector <= 0x14:
+		decodeDoubleByte(builder, data[1:])
+		err = undecodableTextError{selector: selector}
+	case selector == 0x1f:
+		// compressed, ASCII is as good as we can do and may not be much
+		if len(data) > 2 {
+			decodeUnknown(builder, data[2:])
+		}
+		err = undecodableTextError{selector: selector}
+	default:
+		decodeUnknown(builder, data[1:])
+		err = undecodableTextError{selector: selector}
+	}
+	return string(builder.text), err
+}
+
+// table 00, ISO/IEC 6937.  A diacritical mark comes before the letter it goes on
+func decodeISO6937(builder *dvbTextBuilder, data []byte) {
+	for rd := 0; rd < len(data); rd++ {
+		code := data[rd]
+		switch {
+		case code < 0xa0:
+			builder.add(rune(code))
+		case code >= 0xc1 && code <= 0xcf:
+			mark, isMark := iso6937Diacritics[code]
+			if !isMark || rd+1 >= len(data) {
+				builder.add(0xfffd)
+				continue
+			}
+			rd += 1
+			if composed, found := iso6937Composed[(uint16(code)<<8)|uint16(data[rd])]; found {
+				builder.add(composed)
+			} else if data[rd] >= 0x20 && data[rd] < 0x80 {
+				// no single character for it, so the letter then the combining mark
+				builder.add(rune(data[rd]))
+				builder.add(mark)
+			} else {
+				builder.add(0xfffd)
+			}
+		default:
+			builder.add(iso6937Table[code-0xa0])
+		}
+	}
+}
+
+// decodable is false for a part there is no table for, whose characters above 0x9F come out as
+// U+FFFD
+func decodeISO8859(builder *dvbTextBuilder, part uint8, data []byte) (decodable bool) {
+	table := iso8859Tables[part]
+	for _, code := range data {
+		switch {
+		case code < 0xa0 || part == 1:
+			builder.add(rune(code))
+		case table == nil:
+			builder.add(0xfffd)
+		default:
+			builder.add(table[code-0xa0])
+		}
+	}
+	return table != nil || part == 1
+}
+
+// KS X 1001, GB-2312 or Big5 without the tables.  They are all ASCII below 0x80, and a byte above
+// starts a 2 byte character, whose second byte may look like ASCII in Big5
+func decodeDoubleByte(builder *dvbTextBuilder, data []byte) {
+	for rd := 0; rd < len(data); rd++ {
+		if data[rd] < 0x80 {
+			builder.add(rune(data[rd]))
+			continue
+		}
+		builder.add(0xfffd)
+		if data[rd] > 0x80 {
+			rd += 1
+		}
+	}
+}
+
+// a table we can't decode, keep what is plain ASCII
+func decodeUnknown(builder *dvbTextBuilder, data []byte) {
+	for _, code := range data {
+		if code < 0x80 {
+			builder.add(rune(code))
+		} else {
+			builder.add(0xfffd)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package tshelper
+
+import (
+	"testing"
+)
+
+func TestDecodeDVBText(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		data      []byte
+		text      string
+		decodable bool
+	}{
+		{"empty", nil, "", true},
+		{"table 00", []byte("BBC One"), "BBC One", true},
+		{"table 00 euro and diacritic", []byte{0xa4, '5', ' ', 0xc2, 'e'}, "€5 é", true},
+		{"table 00 mark with no composed character", []byte{0xc3, 'q'}, "q̂", true},
+		{"table 00 mark at the end", []byte{'a', 0xc2}, "a�", true},
+		{"new line and emphasis", []byte{'a', 0x86, 'b', 0x87, 0x8a, 'c'}, "ab\nc", true},
+		{"8859-5", []byte{0x01, 0xb0}, "А", true},
+		{"8859-15", []byte{0x0b, 0xa4}, "€", true},
+		{"8859-n", []byte{0x10, 0x00, 0x07, 0xe1}, "α", true},
+		{"8859-1", []byte{0x10, 0x00, 0x01, 0xe9}, "é", true},
+		{"8859-n cut short", []byte{0x10, 0x00}, "", true},
+		{"8859 reserved selector 0x08", []byte{0x08, 'x', 0xe1}, "x�", false},
+		{"8859-n part 0", []byte{0x10, 0x00, 0x00, 'x', 0xe1}, "x�", false},
+		{"8859-n part 12", []byte{0x10, 0x00, 0x0c, 'x', 0xe1}, "x�", false},
+		{"8859-n part 17", []byte{0x10, 0x00, 0x11, 'x', 0xe1}, "x�", false},
+		{"8859-16", []byte{0x10, 0x00, 0x10, 0xa4}, "€", true},
+		{"BMP", []byte{0x11, 0x04, 0x10, 0x00, 'x', 0xe0, 0x8a}, "Аx\n", true},
+		{"UTF-8", append([]byte{0x15}, "日本"...), "日本", true},
+		{"KS X 1001", []byte{0x12, 'K', 0xb0, 0xa1, 'B'}, "K�B", false},
+		{"GB-2312", []byte{0x13, 0xd6, 0xd0, 'C'}, "�C", false},
+		{"Big5 trail byte in ASCII range", []byte{0x14, 0xa4, 0x40, 'A'}, "�A", false},
+		{"compressed", []byte{0x1f, 0x01, 'x'}, "x", false},
+		{"reserved", []byte{0x16, 'x', 0xa0}, "x�", false},
+	} {
+		text, err := decodeDVBText(test.data)
+		if text != test.text {
+			t.Errorf("%s: decoded as %q, expected %q", test.name, text, test.text)
+		}
+		if (err == nil) != test.decodable || (err != nil && !isUndecodableText(err)) {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		if public := DecodeDVBText(test.data); public != text {
+			t.Errorf("%s: DecodeDVBText gave %q, decodeDVBText %q", test.name, public, text)
+		}
+	}
+}
+
+// names and event text in the SI go through the character tables
+func TestDVBTextInTables(t *testing.T) {
+	name := string([]byte{0x01, 0xb0, 0xb1})
+	tables, diagnostics, events := testSectionTables()
+	tables.processSection(0x11, testSDT(0x42, 1, 2, testSDTService(1, "\x15ü", name)))
+	if len(*diagnostics) != 0 || len(events.sdts) != 1 {
+		t.Fatalf("%d SDT events, diagnostics %v", len(events.sdts), *diagnostics)
+	}
+	if service := events.sdts[0].Services[0]; service.Name != "АБ" || service.Provider != "ü" {
+		t.Errorf("service %+v", service)
+	}
+	if name := tables.serviceMap[1].serviceName; name != "АБ" {
+		t.Errorf("service 1 named %q", name)
+	}
+}
+
+// a name that can't be decoded is a diagnostic of its own, and the rest of the table is still used
+func TestUndecodableServiceName(t *testing.T) {
+	tables, diagnostics, _ := testSectionTables()
+	big5 := string([]byte{0x14, 0xa4, 0x40})
+	tables.processSection(0x11, testSDT(0x42, 1, 2, testSDTService(1, "", big5), testSDTService(2, "", "Two")))
+	if diagnostics.count(DiagUndecodableText) != 1 || diagnostics.count(DiagBadTable) != 0 {
+		t.Errorf("diagnostics %v", *diagnostics)
+	}
+	for _, test := range []struct {
+		serviceID uint16
+		name      string
+	}{{1, "�"}, {2, "Two"}} {
+		if name := tables.serviceMap[test.serviceID].serviceName; name != test.name {
+			t.Errorf("service %d named %q, expected %q", test.serviceID, name, test.name)
+		}
+	}
+}
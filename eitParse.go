@@ -0,0 +1,331 @@
+package tshelper
+
+// Event Information Table (EN 300 468 5.2.4), on PID 0x12.  Every section is for 1 service
+// (table_id_extension is the service_id).  Table 0x4E is present/following for this transport
+// stream, section 0 the programme on now and section 1 the one after, and 0x4F the same for
+// other transport streams.  0x50 - 0x5F (this stream) and 0x60 - 0x6F (others) are the schedule,
+// up to 64 days of it split into segments of 3 hours.
+// Events for services in this stream are kept against the service in serviceMap, so the report
+// can say what is on now and next.  Each schedule section's events replace what that section
+// held before, and a new version of a schedule table throws away every section of the old one,
+// so events that are dropped or moved don't linger
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ShortEvent is the short_event_descriptor, the title and a line about the event in 1 language
+type ShortEvent struct {
+	Language string `json:"language"`
+	Name     string `json:"name"`
+	Text     string `json:"text,omitempty"`
+}
+
+// ExtendedEventItem is 1 described item of an extended_event_descriptor, eg "Director" / "someone"
+type ExtendedEventItem struct {
+	Description string `json:"description"`
+	Item        string `json:"item"`
+}
+
+// ExtendedEvent is the text of every extended_event_descriptor for 1 language, put back together
+type ExtendedEvent struct {
+	Language string              `json:"language"`
+	Items    []ExtendedEventItem `json:"items,omitempty"`
+	Text     string              `json:"text,omitempty"`
+}
+
+// ContentGenre is 1 entry of the content_descriptor
+type ContentGenre struct {
+	Level1   uint8  `json:"level1"`
+	Level2   uint8  `json:"level2"`
+	User     uint8  `json:"user"`
+	Category string `json:"category"` // name of the level 1 nibble
+}
+
+// ParentalRating is 1 entry of the parental_rating_descriptor.  MinimumAge is 0 when the rating is
+// undefined or set by the broadcaster rather than an age
+type ParentalRating struct {
+	Country    string `json:"country"`
+	Rating     uint8  `json:"rating"`
+	MinimumAge uint8  `json:"minimumAge,omitempty"`
+}
+
+// EPGEvent is 1 event (programme) from the EIT
+type EPGEvent struct {
+	EventID         uint16           `json:"eventId"`
+	StartTime       time.Time        `json:"startTime"` // UTC, zero if not given
+	Duration        uint32           `json:"duration"`  // seconds
+	RunningStatus   string           `json:"runningStatus"`
+	FreeCAMode      bool             `json:"freeCaMode"` // scrambled
+	ShortEvents     []ShortEvent     `json:"shortEvents,omitempty"`
+	ExtendedEvents  []ExtendedEvent  `json:"extendedEvents,omitempty"`
+	Content         []ContentGenre   `json:"content,omitempty"`
+	ParentalRatings []ParentalRating `json:"parentalRatings,omitempty"`
+}
+
+// EITEvent - an EIT section has been parsed
+type EITEvent struct {
+	Position
+	TableID           uint8
+	ServiceID         uint16
+	TransportStreamID uint16
+	OriginalNetworkID uint16
+	Actual            bool // for a service in this transport stream
+	PresentFollowing  bool // 0x4E / 0x4F rather than schedule
+	SectionNumber     uint8
+	Events            []EPGEvent
+}
+
+// the events of 1 schedule table (table_id) of a service, by section_number
+type eitScheduleTable struct {
+	version  uint8
+	sections map[uint8][]EPGEvent
+}
+
+var runningStatusNames = []string{"undefined", "not running", "starts in a few seconds", "pausing", "running", "service off-air"}
+
+var contentCategoryNames = map[uint8]string{
+	0x1: "Movie/Drama",
+	0x2: "News/Current affairs",
+	0x3: "Show/Game show",
+	0x4: "Sports",
+	0x5: "Children's/Youth programmes",
+	0x6: "Music/Ballet/Dance",
+	0x7: "Arts/Culture (without music)",
+	0x8: "Social/Political issues/Economics",
+	0x9: "Education/Science/Factual topics",
+	0xa: "Leisure hobbies",
+	0xb: "Special characteristics",
+	0xc: "Adult",
+	0xf: "User defined",
+}
+
+// start_time, 16 bit Modified Julian Date then hours, minutes and seconds in BCD.  All 1s means
+// the time isn't given
+func decodeMJDTime(data []byte) time.Time {
+	if data[0] == 0xff && data[1] == 0xff && data[2] == 0xff && data[3] == 0xff && data[4] == 0xff {
+		return time.Time{}
+	}
+	mjd := (int(data[0]) << 8) | int(data[1])
+	seconds := bcdDuration(data[2:5])
+	return time.Date(1858, 11, 17, 0, 0, 0, 0, time.UTC).AddDate(0, 0, mjd).Add(time.Duration(seconds) * time.Second)
+}
+
+// hours, minutes and seconds in BCD, as seconds
+func bcdDuration(data []byte) uint32 {
+	return uint32(bcdValue(data[0:1])*3600 + bcdValue(data[1:2])*60 + bcdValue(data[2:3]))
+}
+
+// a copy of the event sharing nothing with it
+func (event *EPGEvent) clone() EPGEvent {
+	copied := *event
+	copied.ShortEvents = append([]ShortEvent(nil), event.ShortEvents...)
+	copied.ExtendedEvents = append([]ExtendedEvent(nil), event.ExtendedEvents...)
+	for i := range copied.ExtendedEvents {
+		copied.ExtendedEvents[i].Items = append([]ExtendedEventItem(nil), event.ExtendedEvents[i].Items...)
+	}
+	copied.Content = append([]ContentGenre(nil), event.Content...)
+	copied.ParentalRatings = append([]ParentalRating(nil), event.ParentalRatings...)
+	return copied
+}
+
+// decode the event's descriptors.  Text that can't be decoded doesn't stop the rest, its error
+// is handed back if there is nothing worse
+func (event *EPGEvent) addDescriptors(loop []byte) error {
+	var textErr error
+	decodeText := func(data []byte) string {
+		text, err := decodeDVBText(data)
+		if err != nil && textErr == nil {
+			textErr = err
+		}
+		return text
+	}
+	err := forEachDescriptor(loop, func(tag uint8, body []byte) {
+		switch tag {
+		case 0x4d:
+			if len(body) >= 5 && 5+int(body[3]) <= len(body) && 5+int(body[3])+int(body[4+int(body[3])]) <= len(body) {
+				nameLength := int(body[3])
+				short := ShortEvent{Language: string(body[0:3]), Name: decodeText(body[4 : 4+nameLength])}
+				short.Text = decodeText(body[5+nameLength : 5+nameLength+int(body[4+nameLength])])
+				event.ShortEvents = append(event.ShortEvents, short)
+			}
+		case 0x4e:
+			event.addExtendedEvent(body, decodeText)
+		case 0x54:
+			for rd := 0; rd+2 <= len(body); rd += 2 {
+				genre := ContentGenre{Level1: body[rd] >> 4, Level2: body[rd] & 0xf, User: body[rd+1]}
+				genre.Category = contentCategoryNames[genre.Level1]
+				event.Content = append(event.Content, genre)
+			}
+		case 0x55:
+			for rd := 0; rd+4 <= len(body); rd += 4 {
+				rating := ParentalRating{Country: string(body[rd : rd+3]), Rating: body[rd+3]}
+				if rating.Rating >= 0x01 && rating.Rating <= 0x0f {
+					rating.MinimumAge = rating.Rating + 3
+				}
+				event.ParentalRatings = append(event.ParentalRatings, rating)
+			}
+		}
+	})
+	return worseError(err, textErr)
+}
+
+// the extended_event_descriptors for 1 language follow on from each other, descriptor_number 0
+// up, so the items and text are added to what that language already has
+func (event *EPGEvent) addExtendedEvent(body []byte, decodeText func([]byte) string) {
+	if len(body) < 5 || 5+int(body[4]) > len(body) {
+		return
+	}
+	language := string(body[1:4])
+	var extended *ExtendedEvent
+	for i := range event.ExtendedEvents {
+		if event.ExtendedEvents[i].Language == language {
+			extended = &event.ExtendedEvents[i]
+		}
+	}
+	if extended == nil {
+		event.ExtendedEvents = append(event.ExtendedEvents, ExtendedEvent{Language: language})
+		extended = &event.ExtendedEvents[len(event.ExtendedEvents)-1]
+	}
+
+	items := body[5 : 5+int(body[4])]
+	for rd := 0; rd < len(items); {
+		if rd+1+int(items[rd]) >= len(items) || rd+2+int(items[rd])+int(items[rd+1+int(items[rd])]) > len(items) {
+			break
+		}
+		descriptionLength := int(items[rd])
+		itemLength := int(items[rd+1+descriptionLength])
+		extended.Items = append(extended.Items, ExtendedEventItem{
+			Description: decodeText(items[rd+1 : rd+1+descriptionLength]),
+			Item:        decodeText(items[rd+2+descriptionLength : rd+2+descriptionLength+itemLength]),
+		})
+		rd += 2 + descriptionLength + itemLength
+	}
+	rest := body[5+len(items):]
+	if len(rest) >= 1 && 1+int(rest[0]) <= len(rest) {
+		extended.Text += decodeText(rest[1 : 1+int(rest[0])])
+	}
+}
+
+// decode 1 whole EIT section, table_id through CRC.  As much as could be decoded is handed back
+// along with any error
+func parseEITSection(section []byte) (*EITEvent, error) {
+	tableID := section[0]
+	eit := &EITEvent{
+		TableID:          tableID,
+		ServiceID:        (uint16(section[3]) << 8) | uint16(section[4]),
+		Actual:           tableID == 0x4e || (tableID >= 0x50 && tableID <= 0x5f),
+		PresentFollowing: tableID == 0x4e || tableID == 0x4f,
+		SectionNumber:    section[6],
+	}
+	body := section[8 : len(section)-4]
+	if len(body) < 6 {
+		return eit, fmt.Errorf("EIT section of %d bytes is too short", len(section))
+	}
+	eit.TransportStreamID = (uint16(body[0]) << 8) | uint16(body[1])
+	eit.OriginalNetworkID = (uint16(body[2]) << 8) | uint16(body[3])
+
+	var textErr error
+	for rd := 6; rd < len(body); {
+		if rd+12 > len(body) {
+			return eit, fmt.Errorf("EIT event runs past the end of the section")
+		}
+		event := EPGEvent{
+			EventID:       (uint16(body[rd]) << 8) | uint16(body[rd+1]),
+			StartTime:     decodeMJDTime(body[rd+2 : rd+7]),
+			Duration:      bcdDuration(body[rd+7 : rd+10]),
+			RunningStatus: valueName(runningStatusNames, body[rd+10]>>5),
+			FreeCAMode:    body[rd+10]&0x10 != 0,
+		}
+		descriptors, _, err := lengthPrefixedLoop(body[rd+10:])
+		if err != nil {
+			return eit, fmt.Errorf("EIT event 0x%x: %v", event.EventID, err)
+		}
+		err = event.addDescriptors(descriptors)
+		eit.Events = append(eit.Events, event)
+		if isUndecodableText(err) {
+			if textErr == nil {
+				textErr = fmt.Errorf("EIT event 0x%x: %w", event.EventID, err)
+			}
+		} else if err != nil {
+			return eit, fmt.Errorf("EIT event 0x%x: %v", event.EventID, err)
+		}
+		rd += 12 + len(descriptors)
+	}
+	return eit, textErr
+}
+
+// parse an EIT section, keep its events against the service if it's one of ours, and hand it on
+func (tables tableParser) eitParser(section []byte) {
+	event, err := parseEITSection(section)
+	if err != nil {
+		tables.report.raise(SeverityWarning, tableErrorCode(err), "%v", err)
+	}
+	event.Position = tables.report.position
+
+	// an EIT for a service the PAT doesn't list doesn't make one up
+	if service, known := tables.serviceMap[event.ServiceID]; event.Actual && known {
+		if event.PresentFollowing {
+			// copies, the handlers are free to do what they like with event
+			var first *EPGEvent
+			if len(event.Events) > 0 {
+				present := event.Events[0].clone()
+				first = &present
+			}
+			if event.SectionNumber == 0 {
+				service.presentEvent = first
+			} else if event.SectionNumber == 1 {
+				service.followingEvent = first
+			}
+		} else {
+			if service.schedule == nil {
+				service.schedule = make(map[uint8]*eitScheduleTable)
+			}
+			version := (section[5] >> 1) & 0x1f
+			table := service.schedule[event.TableID]
+			if table == nil || table.version != version {
+				table = &eitScheduleTable{version: version, sections: make(map[uint8][]EPGEvent)}
+				service.schedule[event.TableID] = table
+			}
+			events := make([]EPGEvent, len(event.Events))
+			for i := range event.Events {
+				events[i] = event.Events[i].clone()
+			}
+			table.sections[event.SectionNumber] = events
+		}
+		tables.serviceMap[event.ServiceID] = service
+	}
+
+	for _, handler := range tables.report.handlers {
+		handler.OnEIT(event)
+	}
+}
+
+// the schedule of a service in start time order.  An event sent in more than 1 section is only
+// listed once
+func (service programDefinition) scheduleByTime() []EPGEvent {
+	if len(service.schedule) == 0 {
+		return nil
+	}
+	var schedule []EPGEvent
+	listed := make(map[uint16]bool)
+	for _, table := range service.schedule {
+		for _, events := range table.sections {
+			for i := range events {
+				if !listed[events[i].EventID] {
+					listed[events[i].EventID] = true
+					schedule = append(schedule, events[i].clone())
+				}
+			}
+		}
+	}
+	sort.Slice(schedule, func(i, j int) bool {
+		if !schedule[i].StartTime.Equal(schedule[j].StartTime) {
+			return schedule[i].StartTime.Before(schedule[j].StartTime)
+		}
+		return schedule[i].EventID < schedule[j].EventID
+	})
+	return schedule
+}
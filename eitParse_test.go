@@ -0,0 +1,224 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 1 EIT event starting at 2024-01-01 hours:00:00 and running an hour, with a short_event_descriptor
+func testEITEvent(eventID uint16, hours uint8, name string) []byte {
+	short := append([]byte{0x4d, uint8(5 + len(name)), 'e', 'n', 'g', uint8(len(name))}, name...)
+	short = append(short, 0)
+	event := []byte{uint8(eventID >> 8), uint8(eventID), 0xeb, 0x96, hours/10<<4 | hours%10, 0, 0, 0x01, 0, 0}
+	loop := testLoop(short)
+	loop[0] = 0x80 | loop[0]&0x0f // running
+	return append(event, loop...)
+}
+
+// EIT section for service 1 of transport stream 1, network 2
+func testEIT(tableID uint8, version uint8, sectionNumber, lastSectionNumber uint8, events ...[]byte) []byte {
+	body := []byte{0, 1, 0, 2, lastSectionNumber, tableID}
+	for _, event := range events {
+		body = append(body, event...)
+	}
+	return testLongSection(tableID, 1, version, sectionNumber, lastSectionNumber, body)
+}
+
+// tables that already know service 1 from its PAT and PMT
+func testEITTables() (tableParser, *testDiagnostics, *testEvents) {
+	tables, diagnostics, events := testSectionTables()
+	tables.processSection(0, testPAT())
+	tables.processSection(0x100, testPMT(0, 0x1b, 0x101))
+	return tables, diagnostics, events
+}
+
+func testEPGEvent(eventID uint16, hours int, name string) EPGEvent {
+	return EPGEvent{EventID: eventID, StartTime: time.Date(2024, 1, 1, hours, 0, 0, 0, time.UTC), Duration: 3600,
+		RunningStatus: "running", ShortEvents: []ShortEvent{{Language: "eng", Name: name}}}
+}
+
+func TestEITPresentFollowing(t *testing.T) {
+	tables, diagnostics, events := testEITTables()
+	tables.processSection(0x12, testEIT(0x4e, 0, 0, 1, testEITEvent(1, 10, "News")))
+	tables.processSection(0x12, testEIT(0x4e, 0, 1, 1, testEITEvent(2, 11, "Film")))
+	if diagnostics.count(DiagBadTable) != 0 {
+		t.Errorf("diagnostics %v", *diagnostics)
+	}
+	report := &Report{}
+	tables.addToReport(report)
+	if len(report.Services) != 1 || len(events.eits) != 2 {
+		t.Fatalf("%d services and %d EIT events, expected 1 and 2", len(report.Services), len(events.eits))
+	}
+	present, following := testEPGEvent(1, 10, "News"), testEPGEvent(2, 11, "Film")
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"present", report.Services[0].Present, &present},
+		{"following", report.Services[0].Following, &following},
+		{"first event", *events.eits[0], EITEvent{TableID: 0x4e, ServiceID: 1, TransportStreamID: 1, OriginalNetworkID: 2, Actual: true, PresentFollowing: true,
+			Events: []EPGEvent{present}}},
+		{"second event section", events.eits[1].SectionNumber, uint8(1)},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+}
+
+func TestEITSchedule(t *testing.T) {
+	tables, _, _ := testEITTables()
+	tables.processSection(0x12, testEIT(0x50, 0, 0, 8, testEITEvent(2, 11, "b"), testEITEvent(1, 10, "a")))
+	tables.processSection(0x12, testEIT(0x50, 0, 8, 8, testEITEvent(3, 12, "c")))
+	// another transport stream's schedule isn't kept
+	tables.processSection(0x12, testEIT(0x60, 0, 0, 0, testEITEvent(4, 13, "d")))
+
+	report := &Report{}
+	tables.addToReport(report)
+	expected := []EPGEvent{testEPGEvent(1, 10, "a"), testEPGEvent(2, 11, "b"), testEPGEvent(3, 12, "c")}
+	if len(report.Services) != 1 || !reflect.DeepEqual(report.Services[0].Schedule, expected) {
+		t.Errorf("services %+v, expected 1 with schedule %+v", report.Services, expected)
+	}
+}
+
+// each schedule section replaces what it held, and a new version replaces the whole table
+// the EIT for a service not in the PAT is handed on, but doesn't add the service to the report
+func TestEITUnknownService(t *testing.T) {
+	for _, tableID := range []uint8{0x4e, 0x50} {
+		eit := testEIT(tableID, 0, 0, 0, testEITEvent(1, 10, "News"))
+		tables, _, events := testEITTables()
+		tables.processSection(0x12, testLongSection(tableID, 9, 0, 0, 0, eit[8:len(eit)-4]))
+		report := &Report{}
+		tables.addToReport(report)
+		var services []uint16
+		for _, service := range report.Services {
+			services = append(services, service.ProgramNumber)
+		}
+		if !reflect.DeepEqual(services, []uint16{1}) || len(events.eits) != 1 || events.eits[0].ServiceID != 9 {
+			t.Errorf("table 0x%x: services %v, %d EIT events", tableID, services, len(events.eits))
+		}
+		if _, known := tables.serviceMap[9]; known {
+			t.Errorf("table 0x%x: service 9 made up", tableID)
+		}
+	}
+}
+
+func TestEITScheduleReplaced(t *testing.T) {
+	tables, _, _ := testEITTables()
+	for _, step := range []struct {
+		name     string
+		section  []byte
+		schedule []EPGEvent
+	}{
+		{"section 0", testEIT(0x50, 0, 0, 8, testEITEvent(1, 10, "a"), testEITEvent(2, 11, "b")),
+			[]EPGEvent{testEPGEvent(1, 10, "a"), testEPGEvent(2, 11, "b")}},
+		{"section 8", testEIT(0x50, 0, 8, 8, testEITEvent(3, 12, "c")),
+			[]EPGEvent{testEPGEvent(1, 10, "a"), testEPGEvent(2, 11, "b"), testEPGEvent(3, 12, "c")}},
+		{"section 0 again, event 2 dropped", testEIT(0x50, 0, 0, 8, testEITEvent(1, 10, "a")),
+			[]EPGEvent{testEPGEvent(1, 10, "a"), testEPGEvent(3, 12, "c")}},
+		{"new version, event 3 moved and section 8 gone", testEIT(0x50, 1, 0, 0, testEITEvent(1, 10, "a"), testEITEvent(3, 13, "c")),
+			[]EPGEvent{testEPGEvent(1, 10, "a"), testEPGEvent(3, 13, "c")}},
+	} {
+		tables.processSection(0x12, step.section)
+		report := &Report{}
+		tables.addToReport(report)
+		if len(report.Services) != 1 || !reflect.DeepEqual(report.Services[0].Schedule, step.schedule) {
+			t.Errorf("%s: services %+v, expected 1 with schedule %+v", step.name, report.Services, step.schedule)
+		}
+	}
+}
+
+// handlers and report users can change what they are given without it reaching the stored events
+func TestEITEventsCopied(t *testing.T) {
+	tables, _, events := testEITTables()
+	tables.processSection(0x12, testEIT(0x4e, 0, 0, 1, testEITEvent(1, 10, "News")))
+	tables.processSection(0x12, testEIT(0x50, 0, 0, 0, testEITEvent(2, 11, "Film")))
+	for _, event := range events.eits {
+		event.Events[0].EventID = 0xffff
+		event.Events[0].ShortEvents[0].Name = "changed"
+	}
+	for i := 0; i < 2; i++ {
+		report := &Report{}
+		tables.addToReport(report)
+		service := report.Services[0]
+		present, schedule := testEPGEvent(1, 10, "News"), []EPGEvent{testEPGEvent(2, 11, "Film")}
+		if !reflect.DeepEqual(service.Present, &present) || !reflect.DeepEqual(service.Schedule, schedule) {
+			t.Errorf("report %d: present %+v, schedule %+v", i, service.Present, service.Schedule)
+		}
+		service.Present.ShortEvents[0].Name = "changed"
+		service.Schedule[0].ShortEvents[0].Name = "changed"
+	}
+}
+
+func TestEITEventDescriptors(t *testing.T) {
+	extended := func(number, last uint8, language string, items []byte, text string) []byte {
+		body := append([]byte{number<<4 | last}, language...)
+		body = append(append(body, uint8(len(items))), items...)
+		body = append(append(body, uint8(len(text))), text...)
+		return append([]byte{0x4e, uint8(len(body))}, body...)
+	}
+	director := append(append([]byte{8}, "Director"...), append([]byte{4}, "Someone"[:4]...)...)
+	cast := append(append([]byte{4}, "Cast"...), append([]byte{3}, "A B"...)...)
+
+	for _, test := range []struct {
+		name     string
+		loop     []byte
+		expected EPGEvent
+	}{
+		{"short_event_descriptor", append([]byte{0x4d, 12, 'f', 'r', 'a', 4}, append([]byte("Film"), append([]byte{3}, "Bon"...)...)...),
+			EPGEvent{ShortEvents: []ShortEvent{{Language: "fra", Name: "Film", Text: "Bon"}}}},
+		{"extended_event_descriptors followed on", append(extended(0, 1, "eng", director, "The first "), extended(1, 1, "eng", cast, "and second part")...),
+			EPGEvent{ExtendedEvents: []ExtendedEvent{{Language: "eng", Items: []ExtendedEventItem{{Description: "Director", Item: "Some"}, {Description: "Cast", Item: "A B"}},
+				Text: "The first and second part"}}}},
+		{"extended_event_descriptors in 2 languages", append(extended(0, 0, "eng", nil, "English"), extended(0, 0, "deu", cast, "")...),
+			EPGEvent{ExtendedEvents: []ExtendedEvent{{Language: "eng", Text: "English"}, {Language: "deu", Items: []ExtendedEventItem{{Description: "Cast", Item: "A B"}}}}}},
+		{"extended_event_descriptor item cut short", extended(0, 0, "eng", director[:12], "text"),
+			EPGEvent{ExtendedEvents: []ExtendedEvent{{Language: "eng", Text: "text"}}}},
+		{"content_descriptor", []byte{0x54, 4, 0x10, 0, 0x23, 7},
+			EPGEvent{Content: []ContentGenre{{Level1: 1, Level2: 0, Category: "Movie/Drama"}, {Level1: 2, Level2: 3, User: 7, Category: "News/Current affairs"}}}},
+		{"parental_rating_descriptor", []byte{0x55, 8, 'G', 'B', 'R', 0x09, 'F', 'R', 'A', 0x20},
+			EPGEvent{ParentalRatings: []ParentalRating{{Country: "GBR", Rating: 9, MinimumAge: 12}, {Country: "FRA", Rating: 0x20}}}},
+	} {
+		var event EPGEvent
+		if err := event.addDescriptors(test.loop); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !reflect.DeepEqual(event, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, event, test.expected)
+		}
+	}
+}
+
+func TestDecodeMJDTime(t *testing.T) {
+	for _, test := range []struct {
+		data     []byte
+		expected time.Time
+	}{
+		{[]byte{0xc0, 0x79, 0x12, 0x45, 0x00}, time.Date(1993, 10, 13, 12, 45, 0, 0, time.UTC)}, // EN 300 468 annex C
+		{[]byte{0xeb, 0x96, 0x23, 0x59, 0x59}, time.Date(2024, 1, 1, 23, 59, 59, 0, time.UTC)},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff}, time.Time{}},
+	} {
+		if got := decodeMJDTime(test.data); !got.Equal(test.expected) {
+			t.Errorf("%X: %v, expected %v", test.data, got, test.expected)
+		}
+	}
+}
+
+func TestEITMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		section []byte
+	}{
+		{"too short", testLongSection(0x4e, 1, 0, 0, 0, []byte{0, 1, 0})},
+		{"event cut short", testEIT(0x4e, 0, 0, 1, testEITEvent(1, 10, "a")[:8])},
+		{"descriptors_loop_length too long", testEIT(0x4e, 0, 0, 1, append(testEITEvent(1, 10, "a")[:10], 0x80, 0xff, 0x4d, 0))},
+		{"descriptor too long", testEIT(0x4e, 0, 0, 1, append(testEITEvent(1, 10, "a")[:10], 0x80, 2, 0x4d, 9))},
+	} {
+		tables, diagnostics, events := testEITTables()
+		tables.processSection(0x12, test.section)
+		if diagnostics.count(DiagBadTable) != 1 || len(events.eits) != 1 {
+			t.Errorf("%s: %d EIT events, diagnostics %v", test.name, len(events.eits), *diagnostics)
+		}
+	}
+}
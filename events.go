@@ -0,0 +1,138 @@
+package tshelper
+
+// events - things the demux finds, handed to any registered Handler as soon as they are found.
+// Handlers are called on the goroutine doing the demuxing, in the order they were added, and
+// should be quick about it as the demux waits for them.  Event structs, and the slices in them,
+// are made fresh for each call so a handler may keep or change them.  The exception is the Value
+// of a Descriptor, which is shared with the demux and every Report, so treat it as read only
+
+// Handler receives demux events.  Embed NopHandler to only implement the events of interest,
+// that also keeps a handler compiling when new events get added here
+type Handler interface {
+	OnNewPID(event *NewPIDEvent)
+	OnPCR(event *PCREvent)
+	OnContinuityError(event *ContinuityErrorEvent)
+	OnPAT(event *PATEvent)
+	OnPMT(event *PMTEvent)
+	OnSDT(event *SDTEvent)
+	OnNIT(event *NITEvent)
+	OnBAT(event *BATEvent)
+	OnEIT(event *EITEvent)
+	OnTDT(event *TDTEvent)
+	OnCAT(event *CATEvent)
+	OnSCTE35(event *SCTE35Event)
+	OnPrivateTable(event *PrivateTableEvent)
+	OnPES(event *PESEvent)
+	OnCRCError(event *CRCErrorEvent)
+	OnTableVersionChange(event *TableVersionChangeEvent)
+	OnTableComplete(event *TableCompleteEvent)
+}
+
+// NopHandler ignores every event
+type NopHandler struct{}
+
+func (NopHandler) OnNewPID(event *NewPIDEvent)                         {}
+func (NopHandler) OnPCR(event *PCREvent)                               {}
+func (NopHandler) OnContinuityError(event *ContinuityErrorEvent)       {}
+func (NopHandler) OnPAT(event *PATEvent)                               {}
+func (NopHandler) OnPMT(event *PMTEvent)                               {}
+func (NopHandler) OnSDT(event *SDTEvent)                               {}
+func (NopHandler) OnNIT(event *NITEvent)                               {}
+func (NopHandler) OnBAT(event *BATEvent)                               {}
+func (NopHandler) OnEIT(event *EITEvent)                               {}
+func (NopHandler) OnCAT(event *CATEvent)                               {}
+func (NopHandler) OnTDT(event *TDTEvent)                               {}
+func (NopHandler) OnSCTE35(event *SCTE35Event)                         {}
+func (NopHandler) OnPrivateTable(event *PrivateTableEvent)             {}
+func (NopHandler) OnPES(event *PESEvent)                               {}
+func (NopHandler) OnCRCError(event *CRCErrorEvent)                     {}
+func (NopHandler) OnTableVersionChange(event *TableVersionChangeEvent) {}
+func (NopHandler) OnTableComplete(event *TableCompleteEvent)           {}
+
+// NewPIDEvent - the first packet on a PID not seen before
+type NewPIDEvent struct {
+	Position
+}
+
+// PCREvent - a PCR, in 27MHz ticks
+type PCREvent struct {
+	Position
+	PCR           uint64
+	Discontinuity bool // discontinuity_indicator was set in the same adaptation field
+}
+
+// ContinuityErrorEvent - a continuity_counter that wasn't the one expected
+type ContinuityErrorEvent struct {
+	Position
+	Expected uint8
+	Found    uint8
+}
+
+// PATProgram is one entry in the PAT.  Program number 0 is the NIT
+type PATProgram struct {
+	ProgramNumber uint16
+	PID           uint16
+}
+
+// PATEvent - a PAT section has been parsed
+type PATEvent struct {
+	Position
+	TransportStreamID uint16
+	Programs          []PATProgram
+}
+
+// PMTStream is one elementary stream listed in a PMT
+type PMTStream struct {
+	StreamType    uint8
+	PID           uint16
+	CueDescriptor bool           // has an SCTE-35 cue_identifier_descriptor
+	CASystems     []CADescriptor // ECMs for just this stream
+	Descriptors   []Descriptor   // every descriptor in its ES_info loop
+}
+
+// PMTEvent - a PMT section has been parsed
+type PMTEvent struct {
+	Position
+	ProgramNumber uint16
+	PCRPID        uint16
+	HasSCTE35     bool           // program has the CUEI registration descriptor
+	MaxBitrate    uint32         // bits/s from the maximum_bitrate_descriptor, 0 if there isn't one
+	CASystems     []CADescriptor // ECMs for the whole program
+	Descriptors   []Descriptor   // the program_info descriptors
+	Streams       []PMTStream
+}
+
+// SDTService is one service listed in the SDT
+type SDTService struct {
+	ServiceID           uint16       `json:"serviceId"`
+	ServiceType         uint8        `json:"serviceType"`
+	Provider            string       `json:"provider"`
+	Name                string       `json:"name"`
+	EITSchedule         bool         `json:"eitSchedule"`
+	EITPresentFollowing bool         `json:"eitPresentFollowing"`
+	RunningStatus       string       `json:"runningStatus"`
+	FreeCAMode          bool         `json:"freeCaMode"`                   // scrambled
+	PrivateDescriptors  []Descriptor `json:"privateDescriptors,omitempty"` // decoded by a registered DescriptorDecoder
+}
+
+// SDTEvent - an SDT section has been parsed
+type SDTEvent struct {
+	Position
+	Actual            bool // this transport stream (0x42) rather than another (0x46)
+	TransportStreamID uint16
+	OriginalNetworkID uint16
+	Services          []SDTService
+}
+
+// SCTE35Event - a splice_info_section has arrived on an SCTE-35 PID
+type SCTE35Event struct {
+	Position
+	ProgramNumber uint16
+	Section       []byte             // the whole section, table_id through CRC
+	Splice        *SpliceInfoSection // decoded, nil if it could not be
+}
+
+// AddHandler registers a handler for demux events
+func (metaInfo tsdmx) AddHandler(handler Handler) {
+	metaInfo.report.handlers = append(metaInfo.report.handlers, handler)
+}
@@ -0,0 +1,99 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHandlerEvents(t *testing.T) {
+	name := "Channel"
+	service := append([]byte{0x48, uint8(3 + len(name)), 1, 0, uint8(len(name))}, name...)
+	sdt := testLongSection(0x42, 1, 0, 0, 0, append([]byte{0, 2, 0xff, 0, 1, 0xfc, 0x80, uint8(len(service))}, service...))
+
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.section(0x100, testPMT(0, 0x1b, 0x101))
+	stream.section(0x11, sdt)
+	stream.packet(0x101, false, testPCRAdaptation(27000000), make([]byte, 176))
+	stream.packet(0x101, false, nil, make([]byte, 184))
+	stream.data[len(stream.data)-tsPacketSize+3] ^= 0x03 // continuity_counter 1 becomes 2
+
+	demuxer, _ := newTestDemuxer()
+	events := &testEvents{}
+	demuxer.AddHandler(events)
+	feedTestStream(t, demuxer, stream)
+
+	if len(events.pats) != 1 || len(events.pmts) != 1 || len(events.sdts) != 1 || len(events.pcrs) != 1 || len(events.continuityErrors) != 1 {
+		t.Fatalf("%d PAT, %d PMT, %d SDT, %d PCR and %d continuity error events, expected 1 of each",
+			len(events.pats), len(events.pmts), len(events.sdts), len(events.pcrs), len(events.continuityErrors))
+	}
+	var pids []uint16
+	for _, event := range events.newPIDs {
+		pids = append(pids, event.PID)
+	}
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"new PIDs", pids, []uint16{0, 0x100, 0x11, 0x101}},
+		{"PAT programs", events.pats[0].Programs, []PATProgram{{0, 0x10}, {1, 0x100}}},
+		{"PAT transport_stream_id", events.pats[0].TransportStreamID, uint16(1)},
+		{"PMT PCR PID", events.pmts[0].PCRPID, uint16(0x101)},
+		{"PMT streams", events.pmts[0].Streams, []PMTStream{{StreamType: 0x1b, PID: 0x101}}},
+		{"SDT services", events.sdts[0].Services, []SDTService{{ServiceID: 1, ServiceType: 1, Name: name, RunningStatus: "running"}}},
+		{"SDT original_network_id", events.sdts[0].OriginalNetworkID, uint16(2)},
+		{"PCR value", events.pcrs[0].PCR, uint64(27000000)},
+		{"PCR packet", events.pcrs[0].PacketIndex, uint64(3)},
+		{"continuity expected, found", [2]uint8{events.continuityErrors[0].Expected, events.continuityErrors[0].Found}, [2]uint8{1, 2}},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+}
+
+// a handler can change its PMT event, descriptor bodies and CA private data included, without it
+// reaching the demux
+func TestPMTEventCopied(t *testing.T) {
+	programInfo := []byte{0x05, 4, 'C', 'U', 'E', 'I', 0x09, 5, 0x01, 0x00, 0xe4, 0x00, 0xaa}
+	streamInfo := []byte{0x52, 1, 7, 0x09, 5, 0x05, 0x00, 0xe4, 0x01, 0xbb}
+	pmt := append(append([]byte{0xe1, 0x01}, testLoop(programInfo)...), 0x1b, 0xe1, 0x01)
+	pmt = append(pmt, testLoop(streamInfo)...)
+	tables, _, events := testSectionTables()
+	tables.processSection(0, testPAT())
+	tables.processSection(0x100, testLongSection(0x02, 1, 0, 0, 0, pmt))
+	if len(events.pmts) != 1 || len(events.pmts[0].Streams) != 1 {
+		t.Fatalf("PMT events %+v", events.pmts)
+	}
+	event := events.pmts[0]
+	for _, changed := range [][]byte{event.Descriptors[0].Raw, event.CASystems[0].PrivateData,
+		event.Streams[0].Descriptors[0].Raw, event.Streams[0].CASystems[0].PrivateData} {
+		changed[0] = 'X'
+	}
+	event.Descriptors[0].Tag = 0
+	event.Streams[0].CASystems[0].PID = 0
+
+	report := &Report{}
+	tables.addToReport(report)
+	if len(report.Services) != 1 || len(report.Services[0].Components) != 1 || len(report.Services[0].CASystems) != 2 {
+		t.Fatalf("services %+v", report.Services)
+	}
+	service := report.Services[0]
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"registration_descriptor", service.Descriptors[0].Raw, []byte("CUEI")},
+		{"registration_descriptor tag", service.Descriptors[0].Tag, uint8(0x05)},
+		{"stream_identifier_descriptor", service.Components[0].Descriptors[0].Raw, []byte{7}},
+		{"program CA private data", service.CASystems[0].PrivateData, []byte{0xaa}},
+		{"component CA private data", service.CASystems[1].PrivateData, []byte{0xbb}},
+		{"component ECM PID", service.CASystems[1].PID, uint16(0x401)},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+}
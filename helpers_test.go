@@ -0,0 +1,283 @@
+package tshelper
+
+// builders for the test streams - TS packets, long form sections and the handful of tables most
+// tests need
+
+import (
+	"testing"
+)
+
+// a long form section, table_id through CRC
+func testLongSection(tableID uint8, extension uint16, version uint8, sectionNumber, lastSectionNumber uint8, body []byte) []byte {
+	length := 5 + len(body) + 4
+	section := []byte{tableID, 0xb0 | uint8(length>>8), uint8(length), uint8(extension >> 8), uint8(extension), 0xc1 | version<<1, sectionNumber, lastSectionNumber}
+	section = append(section, body...)
+	crc := crc32Mpeg(section)
+	return append(section, uint8(crc>>24), uint8(crc>>16), uint8(crc>>8), uint8(crc))
+}
+
+// a descriptor or SI loop with its 12 bit length in front
+func testLoop(body []byte) []byte {
+	return append([]byte{0xf0 | uint8(len(body)>>8), uint8(len(body))}, body...)
+}
+
+// PAT for transport stream 1, NIT on 0x10 and program 1 with its PMT on 0x100
+func testPAT() []byte {
+	return testLongSection(0x00, 1, 0, 0, 0, []byte{0, 0, 0xe0, 0x10, 0, 1, 0xe1, 0x00})
+}
+
+// builds a stream of 188 byte packets, keeping the continuity counters right
+type testStream struct {
+	continuity map[uint16]uint8
+	data       []byte
+}
+
+func newTestStream() *testStream {
+	return &testStream{continuity: make(map[uint16]uint8)}
+}
+
+// add 1 packet.  adaptation is the adaptation field after its length byte, the packet is stuffed
+// out to 188 bytes with adaptation field stuffing
+func (stream *testStream) packet(pid uint16, pusi bool, adaptation []byte, payload []byte) {
+	packet := make([]byte, tsPacketSize)
+	packet[0] = 0x47
+	packet[1] = uint8(pid >> 8)
+	if pusi {
+		packet[1] |= 0x40
+	}
+	packet[2] = uint8(pid)
+	control := uint8(0)
+	if payload != nil {
+		control |= 1
+	}
+	stuffing := tsPacketSize - 4 - len(payload)
+	if adaptation != nil || stuffing > 0 {
+		control |= 2
+	}
+	continuity := stream.continuity[pid]
+	if payload != nil {
+		stream.continuity[pid] = (continuity + 1) & 0xf
+	}
+	packet[3] = control<<4 | continuity
+	wr := 4
+	if control&2 != 0 {
+		adaptationLength := stuffing - 1
+		packet[4] = uint8(adaptationLength)
+		if adaptationLength > 0 {
+			if adaptation == nil {
+				adaptation = []byte{0}
+			}
+			copy(packet[5:], adaptation)
+			for i := 5 + len(adaptation); i < 5+adaptationLength; i++ {
+				packet[i] = 0xff
+			}
+		}
+		wr = 5 + adaptationLength
+	}
+	copy(packet[wr:], payload)
+	stream.data = append(stream.data, packet...)
+}
+
+// add a section, starting a packet with pointer_field 0 and stuffing out the last one with 0xff
+func (stream *testStream) section(pid uint16, section []byte) {
+	data := append([]byte{0}, section...)
+	for first := true; len(data) > 0; first = false {
+		chunk := make([]byte, 184)
+		for i := range chunk {
+			chunk[i] = 0xff
+		}
+		n := copy(chunk, data)
+		stream.packet(pid, first, nil, chunk)
+		data = data[n:]
+	}
+}
+
+// add null packets, enough for sync to lock on a short stream
+func (stream *testStream) padding(count int) {
+	for i := 0; i < count; i++ {
+		stream.packet(0x1fff, false, nil, make([]byte, 184))
+	}
+}
+
+// adaptation field carrying just a PCR, 27MHz
+func testPCRAdaptation(pcr uint64) []byte {
+	base, extension := pcr/300, pcr%300
+	return []byte{0x10, uint8(base >> 25), uint8(base >> 17), uint8(base >> 9), uint8(base >> 1), uint8(base<<7) | 0x7e | uint8(extension>>8), uint8(extension)}
+}
+
+// PMT for program 1, PCR on 0x101, with the given stream_type / PID pairs and no descriptors
+func testPMT(version uint8, streams ...uint16) []byte {
+	body := []byte{0xe1, 0x01, 0xf0, 0}
+	for i := 0; i+1 < len(streams); i += 2 {
+		body = append(body, uint8(streams[i]), 0xe0|uint8(streams[i+1]>>8), uint8(streams[i+1]), 0xf0, 0)
+	}
+	return testLongSection(0x02, 1, version, 0, 0, body)
+}
+
+// the 5 bytes of a PTS or DTS, with the 4 bit prefix
+func testTimestamp(prefix uint8, timestamp uint64) []byte {
+	return []byte{prefix<<4 | uint8(timestamp>>29)&0x0e | 1, uint8(timestamp >> 22), uint8(timestamp>>14) | 1, uint8(timestamp >> 7), uint8(timestamp<<1) | 1}
+}
+
+// a PES packet with a PTS, and a DTS too if dts isn't 0.  Unbounded ones have PES_packet_length 0
+func testPES(streamID uint8, pts, dts uint64, es []byte, bounded bool) []byte {
+	header := testTimestamp(2, pts)
+	flags := uint8(0x80)
+	if dts != 0 {
+		header = append(testTimestamp(3, pts), testTimestamp(1, dts)...)
+		flags = 0xc0
+	}
+	body := append([]byte{0x80, flags, uint8(len(header))}, header...)
+	body = append(body, es...)
+	length := 0
+	if bounded {
+		length = len(body)
+	}
+	return append([]byte{0, 0, 1, streamID, uint8(length >> 8), uint8(length)}, body...)
+}
+
+// add a PES, split over as many packets as it needs
+func (stream *testStream) pes(pid uint16, data []byte) {
+	for first := true; len(data) > 0; first = false {
+		n := len(data)
+		if n > 184 {
+			n = 184
+		}
+		stream.packet(pid, first, nil, data[:n])
+		data = data[n:]
+	}
+}
+
+// collects every diagnostic raised
+type testDiagnostics []*Diagnostic
+
+func (diagnostics *testDiagnostics) sink(diagnostic *Diagnostic) {
+	*diagnostics = append(*diagnostics, diagnostic)
+}
+
+func (diagnostics testDiagnostics) count(code DiagnosticCode) int {
+	found := 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code == code {
+			found++
+		}
+	}
+	return found
+}
+
+// a Demuxer with a sink collecting its diagnostics
+func newTestDemuxer() (*Demuxer, *testDiagnostics) {
+	demuxer := NewDemuxer()
+	diagnostics := &testDiagnostics{}
+	demuxer.SetDiagnosticSink(diagnostics.sink)
+	return demuxer, diagnostics
+}
+
+// feed a whole stream, failing the test on any error
+func feedTestStream(t *testing.T, demuxer *Demuxer, stream *testStream) {
+	t.Helper()
+	if err := demuxer.Feed(stream.data); err != nil {
+		t.Fatalf("Feed: %v", err)
+	}
+}
+
+// keeps every event a Handler is given, oldest first
+type testEvents struct {
+	NopHandler
+	newPIDs          []*NewPIDEvent
+	pcrs             []*PCREvent
+	continuityErrors []*ContinuityErrorEvent
+	pats             []*PATEvent
+	pmts             []*PMTEvent
+	sdts             []*SDTEvent
+	scte35s          []*SCTE35Event
+	pes              []*PESEvent
+	crcErrors        []*CRCErrorEvent
+	versionChanges   []*TableVersionChangeEvent
+	completeTables   []*TableCompleteEvent
+	nits             []*NITEvent
+	eits             []*EITEvent
+	tdts             []*TDTEvent
+	cats             []*CATEvent
+	bats             []*BATEvent
+	privateTables    []*PrivateTableEvent
+	tableOrder       []string // the table events by name, in the order they came
+}
+
+func (events *testEvents) OnNewPID(event *NewPIDEvent) {
+	events.newPIDs = append(events.newPIDs, event)
+}
+
+func (events *testEvents) OnPCR(event *PCREvent) {
+	events.pcrs = append(events.pcrs, event)
+}
+
+func (events *testEvents) OnContinuityError(event *ContinuityErrorEvent) {
+	events.continuityErrors = append(events.continuityErrors, event)
+}
+
+func (events *testEvents) OnPAT(event *PATEvent) {
+	events.tableOrder = append(events.tableOrder, "PAT")
+	events.pats = append(events.pats, event)
+}
+
+func (events *testEvents) OnPMT(event *PMTEvent) {
+	events.tableOrder = append(events.tableOrder, "PMT")
+	events.pmts = append(events.pmts, event)
+}
+
+func (events *testEvents) OnSDT(event *SDTEvent) {
+	events.tableOrder = append(events.tableOrder, "SDT")
+	events.sdts = append(events.sdts, event)
+}
+
+func (events *testEvents) OnSCTE35(event *SCTE35Event) {
+	events.scte35s = append(events.scte35s, event)
+}
+
+func (events *testEvents) OnPES(event *PESEvent) {
+	events.pes = append(events.pes, event)
+}
+
+func (events *testEvents) OnCRCError(event *CRCErrorEvent) {
+	events.crcErrors = append(events.crcErrors, event)
+}
+
+func (events *testEvents) OnTableVersionChange(event *TableVersionChangeEvent) {
+	events.tableOrder = append(events.tableOrder, "TableVersionChange")
+	events.versionChanges = append(events.versionChanges, event)
+}
+
+func (events *testEvents) OnTableComplete(event *TableCompleteEvent) {
+	events.tableOrder = append(events.tableOrder, "TableComplete")
+	events.completeTables = append(events.completeTables, event)
+}
+
+func (events *testEvents) OnNIT(event *NITEvent) {
+	events.tableOrder = append(events.tableOrder, "NIT")
+	events.nits = append(events.nits, event)
+}
+
+func (events *testEvents) OnEIT(event *EITEvent) {
+	events.tableOrder = append(events.tableOrder, "EIT")
+	events.eits = append(events.eits, event)
+}
+
+func (events *testEvents) OnTDT(event *TDTEvent) {
+	events.tdts = append(events.tdts, event)
+}
+
+func (events *testEvents) OnCAT(event *CATEvent) {
+	events.tableOrder = append(events.tableOrder, "CAT")
+	events.cats = append(events.cats, event)
+}
+
+func (events *testEvents) OnBAT(event *BATEvent) {
+	events.tableOrder = append(events.tableOrder, "BAT")
+	events.bats = append(events.bats, event)
+}
+
+func (events *testEvents) OnPrivateTable(event *PrivateTableEvent) {
+	events.tableOrder = append(events.tableOrder, "PrivateTable")
+	events.privateTables = append(events.privateTables, event)
+}
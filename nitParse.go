@@ -0,0 +1,466 @@
+package tshelper
+
+// Network Information Table (EN 300 468 5.2.1), table_id 0x40 for the network this stream is
+// part of and 0x41 for other networks.  It names the network and lists its transport streams,
+// with how to tune to each (the delivery system descriptors) and what services each carries.
+// The logical channel number descriptors aren't in EN 300 468, they come from the operator specs
+// (EACEM / DTG / NorDig) but are near enough universal in terrestrial and cable networks
+
+import (
+	"fmt"
+)
+
+// NITService is 1 entry of a service_list_descriptor
+type NITService struct {
+	ServiceID   uint16 `json:"serviceId"`
+	ServiceType uint8  `json:"serviceType"`
+}
+
+// LogicalChannel is 1 entry of a logical channel number descriptor.  HDSimulcast is set for the
+// HD simulcast LCN descriptor (0x88), ChannelList names the NorDig channel list (0x87) it came from
+type LogicalChannel struct {
+	ServiceID   uint16 `json:"serviceId"`
+	Number      uint16 `json:"number"`
+	Visible     bool   `json:"visible"`
+	HDSimulcast bool   `json:"hdSimulcast,omitempty"`
+	ChannelList string `json:"channelList,omitempty"`
+}
+
+// SatelliteDelivery is satellite_delivery_system_descriptor (0x43)
+type SatelliteDelivery struct {
+	Frequency        uint64 `json:"frequency"` // Hz
+	OrbitalPosition  string `json:"orbitalPosition"`
+	Polarization     string `json:"polarization"`
+	ModulationSystem string `json:"modulationSystem"`
+	Modulation       string `json:"modulation"`
+	RollOff          string `json:"rollOff,omitempty"` // DVB-S2 only
+	SymbolRate       uint32 `json:"symbolRate"`        // symbols/s
+	FECInner         string `json:"fecInner"`
+}
+
+// CableDelivery is cable_delivery_system_descriptor (0x44)
+type CableDelivery struct {
+	Frequency  uint64 `json:"frequency"` // Hz
+	FECOuter   string `json:"fecOuter"`
+	Modulation string `json:"modulation"`
+	SymbolRate uint32 `json:"symbolRate"` // symbols/s
+	FECInner   string `json:"fecInner"`
+}
+
+// TerrestrialDelivery is terrestrial_delivery_system_descriptor (0x5A)
+type TerrestrialDelivery struct {
+	CentreFrequency  uint64 `json:"centreFrequency"` // Hz
+	Bandwidth        string `json:"bandwidth"`
+	Priority         bool   `json:"priority"`
+	TimeSlicing      bool   `json:"timeSlicing"`
+	MPEFEC           bool   `json:"mpeFec"`
+	Constellation    string `json:"constellation"`
+	Hierarchy        uint8  `json:"hierarchy"`
+	CodeRateHP       string `json:"codeRateHp"`
+	CodeRateLP       string `json:"codeRateLp"`
+	GuardInterval    string `json:"guardInterval"`
+	TransmissionMode string `json:"transmissionMode"`
+	OtherFrequency   bool   `json:"otherFrequency"`
+}
+
+// T2Delivery is T2_delivery_system_descriptor (extension 0x04).  Only PLPID and T2SystemID are
+// always sent, the rest needs the long form of the descriptor
+type T2Delivery struct {
+	PLPID            uint8    `json:"plpId"`
+	T2SystemID       uint16   `json:"t2SystemId"`
+	HasDetails       bool     `json:"hasDetails"`
+	SISOMISO         string   `json:"sisoMiso,omitempty"`
+	Bandwidth        string   `json:"bandwidth,omitempty"`
+	GuardInterval    string   `json:"guardInterval,omitempty"`
+	TransmissionMode string   `json:"transmissionMode,omitempty"`
+	OtherFrequency   bool     `json:"otherFrequency,omitempty"`
+	TFS              bool     `json:"tfs,omitempty"`
+	Frequencies      []uint64 `json:"frequencies,omitempty"` // Hz, centre frequency of every cell
+}
+
+// NITTransportStream is 1 transport stream listed in the NIT, or in a BAT
+type NITTransportStream struct {
+	TransportStreamID  uint16               `json:"transportStreamId"`
+	OriginalNetworkID  uint16               `json:"originalNetworkId"`
+	Satellite          *SatelliteDelivery   `json:"satellite,omitempty"`
+	Cable              *CableDelivery       `json:"cable,omitempty"`
+	Terrestrial        *TerrestrialDelivery `json:"terrestrial,omitempty"`
+	T2                 *T2Delivery          `json:"t2,omitempty"`
+	Services           []NITService         `json:"services,omitempty"`
+	LogicalChannels    []LogicalChannel     `json:"logicalChannels,omitempty"`
+	PrivateDescriptors []Descriptor         `json:"privateDescriptors,omitempty"` // decoded by a registered DescriptorDecoder
+}
+
+// a copy of the transport stream sharing nothing with it but the Value of its PrivateDescriptors
+func (stream *NITTransportStream) clone() NITTransportStream {
+	copied := *stream
+	if stream.Satellite != nil {
+		satellite := *stream.Satellite
+		copied.Satellite = &satellite
+	}
+	if stream.Cable != nil {
+		cable := *stream.Cable
+		copied.Cable = &cable
+	}
+	if stream.Terrestrial != nil {
+		terrestrial := *stream.Terrestrial
+		copied.Terrestrial = &terrestrial
+	}
+	if stream.T2 != nil {
+		t2 := *stream.T2
+		t2.Frequencies = append([]uint64(nil), stream.T2.Frequencies...)
+		copied.T2 = &t2
+	}
+	copied.Services = append([]NITService(nil), stream.Services...)
+	copied.LogicalChannels = append([]LogicalChannel(nil), stream.LogicalChannels...)
+	copied.PrivateDescriptors = copyDescriptors(stream.PrivateDescriptors)
+	return copied
+}
+
+// copies of a list of transport streams, see clone
+func copyTransportStreams(streams []NITTransportStream) []NITTransportStream {
+	if streams == nil {
+		return nil
+	}
+	copied := make([]NITTransportStream, len(streams))
+	for i := range streams {
+		copied[i] = streams[i].clone()
+	}
+	return copied
+}
+
+// NITEvent - a NIT section has been parsed.  A big NIT is split over several sections, each
+// with some of the transport streams
+type NITEvent struct {
+	Position
+	Actual             bool // this stream's network (0x40) rather than another (0x41)
+	NetworkID          uint16
+	NetworkName        string
+	TransportStreams   []NITTransportStream
+	PrivateDescriptors []Descriptor // network_descriptors decoded by a registered DescriptorDecoder
+}
+
+var (
+	polarizationNames    = []string{"linear horizontal", "linear vertical", "circular left", "circular right"}
+	satModulationNames   = []string{"auto", "QPSK", "8PSK", "16-QAM"}
+	rollOffNames         = []string{"0.35", "0.25", "0.20", "reserved"}
+	cableModulationNames = []string{"not defined", "16-QAM", "32-QAM", "64-QAM", "128-QAM", "256-QAM"}
+	fecOuterNames        = []string{"not defined", "none", "RS(204/188)"}
+	fecInnerNames        = []string{"not defined", "1/2", "2/3", "3/4", "5/6", "7/8", "8/9", "3/5", "4/5", "9/10"}
+	terrBandwidthNames   = []string{"8MHz", "7MHz", "6MHz", "5MHz"}
+	constellationNames   = []string{"QPSK", "16-QAM", "64-QAM", "reserved"}
+	terrCodeRateNames    = []string{"1/2", "2/3", "3/4", "5/6", "7/8"}
+	terrGuardNames       = []string{"1/32", "1/16", "1/8", "1/4"}
+	terrModeNames        = []string{"2k", "8k", "4k", "reserved"}
+	t2SISOMISONames      = []string{"SISO", "MISO", "reserved", "reserved"}
+	t2BandwidthNames     = []string{"8MHz", "7MHz", "6MHz", "5MHz", "10MHz", "1.712MHz"}
+	t2GuardNames         = []string{"1/32", "1/16", "1/8", "1/4", "1/128", "19/128", "19/256"}
+	t2TransmissionModes  = []string{"2k", "8k", "4k", "1k", "16k", "32k"}
+)
+
+// name from a table of them, values past the end of the table are reserved
+func valueName(names []string, value uint8) string {
+	if int(value) < len(names) {
+		return names[value]
+	}
+	return fmt.Sprintf("reserved(%d)", value)
+}
+
+func fecInnerName(value uint8) string {
+	if value == 0xf {
+		return "no convolutional coding"
+	}
+	return valueName(fecInnerNames, value)
+}
+
+// symbol_rate is 7 BCD digits in units of 100 symbols/s, FEC_inner takes the last 4 bits
+func symbolRate(data []byte) uint32 {
+	return uint32(bcdValue(data[0:3])*10+uint64(data[3]>>4)) * 100
+}
+
+func parseSatelliteDelivery(body []byte) (*SatelliteDelivery, error) {
+	if len(body) < 11 {
+		return nil, fmt.Errorf("satellite_delivery_system_descriptor of %d bytes, expected 11", len(body))
+	}
+	satellite := &SatelliteDelivery{
+		Frequency:    bcdValue(body[0:4]) * 10000,
+		Polarization: polarizationNames[(body[6]>>5)&0x3],
+		Modulation:   satModulationNames[body[6]&0x3],
+		SymbolRate:   symbolRate(body[7:11]),
+		FECInner:     fecInnerName(body[10] & 0xf),
+	}
+	orbital := bcdValue(body[4:6])
+	eastWest := "W"
+	if body[6]&0x80 != 0 {
+		eastWest = "E"
+	}
+	satellite.OrbitalPosition = fmt.Sprintf("%d.%d%s", orbital/10, orbital%10, eastWest)
+	satellite.ModulationSystem = "DVB-S"
+	if body[6]&0x04 != 0 {
+		satellite.ModulationSystem = "DVB-S2"
+		satellite.RollOff = rollOffNames[(body[6]>>3)&0x3]
+	}
+	return satellite, nil
+}
+
+func parseCableDelivery(body []byte) (*CableDelivery, error) {
+	if len(body) < 11 {
+		return nil, fmt.Errorf("cable_delivery_system_descriptor of %d bytes, expected 11", len(body))
+	}
+	return &CableDelivery{
+		Frequency:  bcdValue(body[0:4]) * 100,
+		FECOuter:   valueName(fecOuterNames, body[5]&0xf),
+		Modulation: valueName(cableModulationNames, body[6]),
+		SymbolRate: symbolRate(body[7:11]),
+		FECInner:   fecInnerName(body[10] & 0xf),
+	}, nil
+}
+
+func parseTerrestrialDelivery(body []byte) (*TerrestrialDelivery, error) {
+	if len(body) < 11 {
+		return nil, fmt.Errorf("terrestrial_delivery_system_descriptor of %d bytes, expected 11", len(body))
+	}
+	frequency := (uint64(body[0]) << 24) | (uint64(body[1]) << 16) | (uint64(body[2]) << 8) | uint64(body[3])
+	return &TerrestrialDelivery{
+		CentreFrequency:  frequency * 10,
+		Bandwidth:        valueName(terrBandwidthNames, body[4]>>5),
+		Priority:         body[4]&0x10 != 0,
+		TimeSlicing:      body[4]&0x08 == 0, // both flags are set for "not used"
+		MPEFEC:           body[4]&0x04 == 0,
+		Constellation:    constellationNames[body[5]>>6],
+		Hierarchy:        (body[5] >> 3) & 0x7,
+		CodeRateHP:       valueName(terrCodeRateNames, body[5]&0x7),
+		CodeRateLP:       valueName(terrCodeRateNames, body[6]>>5),
+		GuardInterval:    terrGuardNames[(body[6]>>3)&0x3],
+		TransmissionMode: terrModeNames[(body[6]>>1)&0x3],
+		OtherFrequency:   body[6]&0x01 != 0,
+	}, nil
+}
+
+// body is the extension descriptor after its descriptor_tag_extension
+func parseT2Delivery(body []byte) (*T2Delivery, error) {
+	if len(body) < 3 {
+		return nil, fmt.Errorf("T2_delivery_system_descriptor of %d bytes is too short", len(body))
+	}
+	t2 := &T2Delivery{PLPID: body[0], T2SystemID: (uint16(body[1]) << 8) | uint16(body[2])}
+	if len(body) == 3 {
+		return t2, nil
+	}
+	if len(body) < 5 {
+		return nil, fmt.Errorf("T2_delivery_system_descriptor of %d bytes is too short for its details", len(body))
+	}
+	t2.HasDetails = true
+	t2.SISOMISO = t2SISOMISONames[body[3]>>6]
+	t2.Bandwidth = valueName(t2BandwidthNames, (body[3]>>2)&0xf)
+	t2.GuardInterval = valueName(t2GuardNames, body[4]>>5)
+	t2.TransmissionMode = valueName(t2TransmissionModes, (body[4]>>2)&0x7)
+	t2.OtherFrequency = body[4]&0x02 != 0
+	t2.TFS = body[4]&0x01 != 0
+
+	frequency := func(data []byte) uint64 {
+		return ((uint64(data[0]) << 24) | (uint64(data[1]) << 16) | (uint64(data[2]) << 8) | uint64(data[3])) * 10
+	}
+	for rd := 5; rd < len(body); {
+		rd += 2 // cell_id
+		if t2.TFS {
+			if rd >= len(body) || rd+1+int(body[rd]) > len(body) {
+				return nil, fmt.Errorf("T2_delivery_system_descriptor frequency loop runs past its end")
+			}
+			for i := rd + 1; i+4 <= rd+1+int(body[rd]); i += 4 {
+				t2.Frequencies = append(t2.Frequencies, frequency(body[i:]))
+			}
+			rd += 1 + int(body[rd])
+		} else {
+			if rd+4 > len(body) {
+				return nil, fmt.Errorf("T2_delivery_system_descriptor cell runs past its end")
+			}
+			t2.Frequencies = append(t2.Frequencies, frequency(body[rd:]))
+			rd += 4
+		}
+		if rd >= len(body) || rd+1+int(body[rd]) > len(body) {
+			return nil, fmt.Errorf("T2_delivery_system_descriptor subcell loop runs past its end")
+		}
+		rd += 1 + int(body[rd]) // subcells are transposers, not wanted
+	}
+	return t2, nil
+}
+
+// service_id, visible_service_flag and a 10 bit LCN, 4 bytes to an entry.  Used by the EACEM /
+// DTG LCN descriptor (0x83), the HD simulcast one (0x88) and inside NorDig channel lists (0x87)
+func parseLogicalChannels(body []byte, hdSimulcast bool, channelList string) []LogicalChannel {
+	var channels []LogicalChannel
+	for rd := 0; rd+4 <= len(body); rd += 4 {
+		channels = append(channels, LogicalChannel{
+			ServiceID:   (uint16(body[rd]) << 8) | uint16(body[rd+1]),
+			Number:      ((uint16(body[rd+2]) << 8) | uint16(body[rd+3])) & 0x03ff,
+			Visible:     body[rd+2]&0x80 != 0,
+			HDSimulcast: hdSimulcast,
+			ChannelList: channelList,
+		})
+	}
+	return channels
+}
+
+// NorDig logical_channel_descriptor version 2 (0x87), a set of named channel lists
+func parseNorDigChannelLists(body []byte) ([]LogicalChannel, error) {
+	var channels []LogicalChannel
+	var textErr error
+	for rd := 0; rd < len(body); {
+		if rd+2 > len(body) || rd+2+int(body[rd+1])+4 > len(body) {
+			return channels, fmt.Errorf("NorDig channel list runs past the end of its descriptor")
+		}
+		nameLength := int(body[rd+1])
+		name, err := decodeDVBText(body[rd+2 : rd+2+nameLength])
+		if err != nil && textErr == nil {
+			textErr = fmt.Errorf("NorDig channel list name: %w", err)
+		}
+		rd += 2 + nameLength + 3 // channel_list_id, the name and country_code
+		listLength := int(body[rd])
+		if rd+1+listLength > len(body) {
+			return channels, fmt.Errorf("NorDig channel list %q runs past the end of its descriptor", name)
+		}
+		channels = append(channels, parseLogicalChannels(body[rd+1:rd+1+listLength], false, name)...)
+		rd += 1 + listLength
+	}
+	return channels, textErr
+}
+
+// decode the transport_descriptors of 1 transport stream in the NIT or BAT
+func (stream *NITTransportStream) addDescriptors(loop []byte, decoders *decoderRegistry) error {
+	var firstErr error
+	keep := func(err error) {
+		firstErr = worseError(firstErr, err)
+	}
+	specifier := AnyPrivateDataSpecifier
+	err := forEachDescriptor(loop, func(tag uint8, body []byte) {
+		descriptor, found, err := decoders.decodeDescriptor(tag, specifier, body)
+		specifier = privateDataSpecifierAfter(tag, body, specifier)
+		if found {
+			stream.PrivateDescriptors = append(stream.PrivateDescriptors, descriptor)
+			if err != nil {
+				keep(err)
+			}
+			return
+		}
+		switch tag {
+		case 0x41:
+			for rd := 0; rd+3 <= len(body); rd += 3 {
+				stream.Services = append(stream.Services, NITService{ServiceID: (uint16(body[rd]) << 8) | uint16(body[rd+1]), ServiceType: body[rd+2]})
+			}
+		case 0x43:
+			stream.Satellite, err = parseSatelliteDelivery(body)
+		case 0x44:
+			stream.Cable, err = parseCableDelivery(body)
+		case 0x5a:
+			stream.Terrestrial, err = parseTerrestrialDelivery(body)
+		case 0x7f:
+			if len(body) > 0 && body[0] == 0x04 {
+				stream.T2, err = parseT2Delivery(body[1:])
+			}
+		case 0x83:
+			stream.LogicalChannels = append(stream.LogicalChannels, parseLogicalChannels(body, false, "")...)
+		case 0x87:
+			var channels []LogicalChannel
+			channels, err = parseNorDigChannelLists(body)
+			stream.LogicalChannels = append(stream.LogicalChannels, channels...)
+		case 0x88:
+			stream.LogicalChannels = append(stream.LogicalChannels, parseLogicalChannels(body, true, "")...)
+		}
+		if err != nil {
+			keep(err)
+		}
+	})
+	if err != nil {
+		keep(err)
+	}
+	return firstErr
+}
+
+// decode 1 whole NIT section, table_id through CRC.  As much as could be decoded is handed back
+// along with any error
+func parseNITSection(section []byte, decoders *decoderRegistry) (*NITEvent, error) {
+	nit := &NITEvent{Actual: section[0] == uint8(nitSectionActualNetwork), NetworkID: (uint16(section[3]) << 8) | uint16(section[4])}
+	networkDescriptors, rest, err := lengthPrefixedLoop(section[8 : len(section)-4])
+	if err != nil {
+		return nit, fmt.Errorf("NIT network_descriptors: %v", err)
+	}
+	var descriptorErr error
+	specifier := AnyPrivateDataSpecifier
+	err = forEachDescriptor(networkDescriptors, func(tag uint8, body []byte) {
+		descriptor, found, err := decoders.decodeDescriptor(tag, specifier, body)
+		specifier = privateDataSpecifierAfter(tag, body, specifier)
+		if found {
+			nit.PrivateDescriptors = append(nit.PrivateDescriptors, descriptor)
+		} else if tag == 0x40 {
+			nit.NetworkName, err = decodeDVBText(body)
+		}
+		descriptorErr = worseError(descriptorErr, err)
+	})
+	if err == nil {
+		err = descriptorErr
+	}
+	if err != nil && !isUndecodableText(err) {
+		return nit, fmt.Errorf("NIT network_descriptors: %w", err)
+	}
+	textErr := err
+
+	nit.TransportStreams, err = parseTransportStreamLoop(rest, decoders)
+	if textErr != nil {
+		err = worseError(fmt.Errorf("network_descriptors: %w", textErr), err)
+	}
+	if err != nil {
+		return nit, fmt.Errorf("NIT %w", err)
+	}
+	return nit, nil
+}
+
+// decode the transport_stream_loop, length and all, that ends a NIT or BAT section.  The
+// transport streams decoded before any error are handed back with it
+func parseTransportStreamLoop(data []byte, decoders *decoderRegistry) ([]NITTransportStream, error) {
+	var transportStreams []NITTransportStream
+	var textErr error
+	streams, _, err := lengthPrefixedLoop(data)
+	if err != nil {
+		return nil, fmt.Errorf("transport_stream_loop: %v", err)
+	}
+	for rd := 0; rd < len(streams); {
+		if rd+4 > len(streams) {
+			return transportStreams, fmt.Errorf("transport stream entry runs past the end of the loop")
+		}
+		stream := NITTransportStream{
+			TransportStreamID: (uint16(streams[rd]) << 8) | uint16(streams[rd+1]),
+			OriginalNetworkID: (uint16(streams[rd+2]) << 8) | uint16(streams[rd+3]),
+		}
+		descriptors, _, err := lengthPrefixedLoop(streams[rd+4:])
+		if err != nil {
+			return transportStreams, fmt.Errorf("transport stream 0x%x: %v", stream.TransportStreamID, err)
+		}
+		err = stream.addDescriptors(descriptors, decoders)
+		transportStreams = append(transportStreams, stream)
+		if isUndecodableText(err) {
+			if textErr == nil {
+				textErr = fmt.Errorf("transport stream 0x%x: %w", stream.TransportStreamID, err)
+			}
+		} else if err != nil {
+			return transportStreams, fmt.Errorf("transport stream 0x%x: %v", stream.TransportStreamID, err)
+		}
+		rd += 4 + 2 + len(descriptors)
+	}
+	return transportStreams, textErr
+}
+
+// parse a NIT section, keep a copy for the report and hand it on
+func (tables tableParser) nitParser(pid uint16, section []byte) {
+	event, err := parseNITSection(section, tables.decoders)
+	if err != nil {
+		tables.report.raise(SeverityWarning, tableErrorCode(err), "%v", err)
+	}
+	event.Position = tables.report.position
+	kept := *event
+	kept.TransportStreams = copyTransportStreams(event.TransportStreams)
+	kept.PrivateDescriptors = copyDescriptors(event.PrivateDescriptors)
+	tables.keepDecoded(pid, section, &kept)
+	for _, handler := range tables.report.handlers {
+		handler.OnNIT(event)
+	}
+}
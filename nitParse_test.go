@@ -0,0 +1,226 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 32 bit big endian, as the terrestrial and T2 frequencies are sent
+func testUint32(value uint32) []byte {
+	return []byte{uint8(value >> 24), uint8(value >> 16), uint8(value >> 8), uint8(value)}
+}
+
+// NIT section for network 0x3001 with the given network descriptors and transport stream loop
+func testNIT(sectionNumber, lastSectionNumber uint8, networkDescriptors []byte, streams []byte) []byte {
+	body := append(testLoop(networkDescriptors), testLoop(streams)...)
+	return testLongSection(0x40, 0x3001, 0, sectionNumber, lastSectionNumber, body)
+}
+
+func TestNIT(t *testing.T) {
+	satellite := []byte{0x43, 11, 0x01, 0x17, 0x27, 0x50, 0x01, 0x92, 0xb6, 0x02, 0x75, 0x00, 0x03}
+	services := []byte{0x41, 6, 0, 1, 0x01, 0, 2, 0x19}
+	lcn := []byte{0x83, 8, 0, 1, 0x80, 5, 0, 2, 0x03, 0xe8}
+	first := append([]byte{0, 1, 0, 2}, testLoop(append(append(satellite, services...), lcn...))...)
+	second := append([]byte{0, 3, 0, 2}, testLoop(nil)...)
+
+	tables, diagnostics, events := testSectionTables()
+	tables.processSection(0x10, testNIT(0, 1, append([]byte{0x40, 3}, "Net"...), first))
+	tables.processSection(0x10, testNIT(1, 1, nil, second))
+	if len(*diagnostics) != 0 {
+		t.Errorf("diagnostics %v", *diagnostics)
+	}
+
+	streamOne := NITTransportStream{TransportStreamID: 1, OriginalNetworkID: 2,
+		Satellite: &SatelliteDelivery{Frequency: 11727500000, OrbitalPosition: "19.2E", Polarization: "linear vertical", ModulationSystem: "DVB-S2",
+			Modulation: "8PSK", RollOff: "0.20", SymbolRate: 27500000, FECInner: "3/4"},
+		Services:        []NITService{{ServiceID: 1, ServiceType: 0x01}, {ServiceID: 2, ServiceType: 0x19}},
+		LogicalChannels: []LogicalChannel{{ServiceID: 1, Number: 5, Visible: true}, {ServiceID: 2, Number: 1000}}}
+	streamThree := NITTransportStream{TransportStreamID: 3, OriginalNetworkID: 2}
+	if len(events.nits) != 2 {
+		t.Fatalf("%d NIT events, expected 2", len(events.nits))
+	}
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"first section", *events.nits[0], NITEvent{Actual: true, NetworkID: 0x3001, NetworkName: "Net", TransportStreams: []NITTransportStream{streamOne}}},
+		{"second section", *events.nits[1], NITEvent{Actual: true, NetworkID: 0x3001, TransportStreams: []NITTransportStream{streamThree}}},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+
+	report := &Report{}
+	tables.addToReport(report)
+	expected := []NetworkReport{{NetworkID: 0x3001, Actual: true, Name: "Net", Complete: true, TransportStreams: []NITTransportStream{streamOne, streamThree}}}
+	if !reflect.DeepEqual(report.Networks, expected) {
+		t.Errorf("networks %+v, expected %+v", report.Networks, expected)
+	}
+}
+
+// each section is decoded once, on arrival, and neither handlers nor report users can change what
+// is kept
+func TestNITDecodedOnce(t *testing.T) {
+	stream := append([]byte{0, 1, 0, 2}, testLoop([]byte{0x41, 3, 0, 1, 0x01, 0x90, 1, 0xaa})...)
+	tables, _, events := testSectionTables()
+	calls := 0
+	tables.decoders.descriptors[descriptorDecoderKey{tag: 0x90, specifier: AnyPrivateDataSpecifier}] = func(tag uint8, body []byte) (interface{}, error) {
+		calls += 1
+		return int(body[0]), nil
+	}
+	tables.processSection(0x10, testNIT(0, 0, append([]byte{0x40, 3}, "Net"...), stream))
+	for _, event := range events.nits {
+		event.NetworkName = "changed"
+		event.TransportStreams[0].Services[0].ServiceID = 0xffff
+		event.TransportStreams[0].PrivateDescriptors[0].Raw[0] = 0
+	}
+
+	expected := []NetworkReport{{NetworkID: 0x3001, Actual: true, Name: "Net", Complete: true, TransportStreams: []NITTransportStream{{
+		TransportStreamID: 1, OriginalNetworkID: 2, Services: []NITService{{ServiceID: 1, ServiceType: 0x01}},
+		PrivateDescriptors: []Descriptor{{Tag: 0x90, Name: "descriptor 0x90", Raw: []byte{0xaa}, Value: 0xaa}}}}}}
+	for i := 0; i < 2; i++ {
+		report := &Report{}
+		tables.addToReport(report)
+		if !reflect.DeepEqual(report.Networks, expected) {
+			t.Fatalf("report %d: networks %+v, expected %+v", i, report.Networks, expected)
+		}
+		report.Networks[0].TransportStreams[0].Services[0].ServiceID = 0xfffe
+		report.Networks[0].TransportStreams[0].PrivateDescriptors[0].Raw[0] = 0
+	}
+	if calls != 1 {
+		t.Errorf("descriptor decoder called %d times, expected once", calls)
+	}
+}
+
+func TestNITMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		body []byte
+	}{
+		{"network_descriptors_length too long", []byte{0xf0, 0x20, 0x40, 1, 'N'}},
+		{"network name descriptor too long", []byte{0xf0, 0x03, 0x40, 9, 'N', 0xf0, 0}},
+		{"no transport_stream_loop", []byte{0xf0, 5, 0x40, 3, 'N', 'e', 't'}},
+		{"transport_stream_loop_length too long", []byte{0xf0, 0, 0xf0, 0x10, 0, 1, 0, 2}},
+		{"transport stream entry cut short", []byte{0xf0, 0, 0xf0, 0x03, 0, 1, 0}},
+		{"transport_descriptors_length too long", []byte{0xf0, 0, 0xf0, 0x06, 0, 1, 0, 2, 0xf0, 0x09}},
+		{"delivery descriptor cut short", []byte{0xf0, 0, 0xf0, 0x0a, 0, 1, 0, 2, 0xf0, 0x04, 0x44, 2, 0x03, 0x46}},
+	} {
+		tables, diagnostics, events := testSectionTables()
+		tables.processSection(0x10, testLongSection(0x40, 0x3001, 0, 0, 0, test.body))
+		if diagnostics.count(DiagBadTable) != 1 || len(events.nits) != 1 {
+			t.Errorf("%s: %d NIT events, diagnostics %v", test.name, len(events.nits), *diagnostics)
+		}
+	}
+}
+
+func TestDeliverySystemDescriptors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		parse    func(body []byte) (interface{}, error)
+		body     []byte
+		expected interface{}
+	}{
+		{"DVB-S2 satellite east", func(body []byte) (interface{}, error) { return parseSatelliteDelivery(body) },
+			[]byte{0x01, 0x17, 0x27, 0x50, 0x01, 0x92, 0xb6, 0x02, 0x75, 0x00, 0x03},
+			&SatelliteDelivery{Frequency: 11727500000, OrbitalPosition: "19.2E", Polarization: "linear vertical", ModulationSystem: "DVB-S2",
+				Modulation: "8PSK", RollOff: "0.20", SymbolRate: 27500000, FECInner: "3/4"}},
+		{"DVB-S satellite west", func(body []byte) (interface{}, error) { return parseSatelliteDelivery(body) },
+			[]byte{0x01, 0x09, 0x53, 0x75, 0x00, 0x30, 0x61, 0x02, 0x20, 0x00, 0x0f},
+			&SatelliteDelivery{Frequency: 10953750000, OrbitalPosition: "3.0W", Polarization: "circular right", ModulationSystem: "DVB-S",
+				Modulation: "QPSK", SymbolRate: 22000000, FECInner: "no convolutional coding"}},
+		{"satellite cut short", func(body []byte) (interface{}, error) { return parseSatelliteDelivery(body) },
+			[]byte{0x01, 0x17, 0x27, 0x50, 0x01, 0x92, 0xb6, 0x02, 0x75, 0x00}, nil},
+		{"cable", func(body []byte) (interface{}, error) { return parseCableDelivery(body) },
+			[]byte{0x03, 0x46, 0x00, 0x00, 0xff, 0xf2, 0x03, 0x00, 0x69, 0x00, 0x0f},
+			&CableDelivery{Frequency: 346000000, FECOuter: "RS(204/188)", Modulation: "64-QAM", SymbolRate: 6900000, FECInner: "no convolutional coding"}},
+		{"cable with reserved values", func(body []byte) (interface{}, error) { return parseCableDelivery(body) },
+			[]byte{0x03, 0x46, 0x00, 0x00, 0xff, 0xf5, 0x09, 0x00, 0x68, 0x75, 0x03},
+			&CableDelivery{Frequency: 346000000, FECOuter: "reserved(5)", Modulation: "reserved(9)", SymbolRate: 6875000, FECInner: "3/4"}},
+		{"cable cut short", func(body []byte) (interface{}, error) { return parseCableDelivery(body) },
+			[]byte{0x03, 0x46, 0x00, 0x00}, nil},
+		{"terrestrial 8MHz", func(body []byte) (interface{}, error) { return parseTerrestrialDelivery(body) },
+			append(testUint32(47400000), 0x1f, 0x82, 0x02, 0xff, 0xff, 0xff, 0xff),
+			&TerrestrialDelivery{CentreFrequency: 474000000, Bandwidth: "8MHz", Priority: true, Constellation: "64-QAM",
+				CodeRateHP: "3/4", CodeRateLP: "1/2", GuardInterval: "1/32", TransmissionMode: "8k"}},
+		{"terrestrial 7MHz hierarchical", func(body []byte) (interface{}, error) { return parseTerrestrialDelivery(body) },
+			append(testUint32(17750000), 0x23, 0x49, 0xff, 0xff, 0xff, 0xff, 0xff),
+			&TerrestrialDelivery{CentreFrequency: 177500000, Bandwidth: "7MHz", TimeSlicing: true, MPEFEC: true, Constellation: "16-QAM", Hierarchy: 1,
+				CodeRateHP: "2/3", CodeRateLP: "reserved(7)", GuardInterval: "1/4", TransmissionMode: "reserved", OtherFrequency: true}},
+		{"terrestrial cut short", func(body []byte) (interface{}, error) { return parseTerrestrialDelivery(body) },
+			testUint32(47400000), nil},
+	} {
+		got, err := test.parse(test.body)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%s: decoded as %+v", test.name, got)
+			}
+		} else if err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: decoded as %+v, %v, expected %+v", test.name, got, err, test.expected)
+		}
+	}
+}
+
+func TestT2Delivery(t *testing.T) {
+	details := []byte{1, 0x80, 0x01, 0x14, 0xb4}
+	cells := append(append([]byte{0, 1}, testUint32(47400000)...), 0)
+	cells = append(append(append(cells, 0, 2), testUint32(48200000)...), 5, 1, 0, 0, 0, 0)
+	tfs := append(append(append([]byte{1, 0x80, 0x01, 0x40, 0x25, 0, 1, 8}, testUint32(47400000)...), testUint32(48200000)...), 0)
+	for _, test := range []struct {
+		name     string
+		body     []byte
+		expected *T2Delivery
+	}{
+		{"short form", []byte{1, 0x80, 0x01}, &T2Delivery{PLPID: 1, T2SystemID: 0x8001}},
+		{"cells", append(append([]byte(nil), details...), cells...),
+			&T2Delivery{PLPID: 1, T2SystemID: 0x8001, HasDetails: true, SISOMISO: "SISO", Bandwidth: "1.712MHz", GuardInterval: "19/128", TransmissionMode: "32k",
+				Frequencies: []uint64{474000000, 482000000}}},
+		{"time frequency slicing", tfs,
+			&T2Delivery{PLPID: 1, T2SystemID: 0x8001, HasDetails: true, SISOMISO: "MISO", Bandwidth: "8MHz", GuardInterval: "1/16", TransmissionMode: "8k",
+				TFS: true, Frequencies: []uint64{474000000, 482000000}}},
+		{"too short", []byte{1, 0x80}, nil},
+		{"details cut short", []byte{1, 0x80, 0x01, 0x10}, nil},
+		{"cell cut short", append(append([]byte(nil), details...), 0, 1, 0x02, 0xd3), nil},
+		{"subcell loop past the end", append(append(append([]byte(nil), details...), cells[:6]...), 5, 1), nil},
+		{"frequency loop past the end", tfs[:12], nil},
+	} {
+		t2, err := parseT2Delivery(test.body)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%s: decoded as %+v", test.name, t2)
+			}
+		} else if err != nil || !reflect.DeepEqual(t2, test.expected) {
+			t.Errorf("%s: decoded as %+v, %v, expected %+v", test.name, t2, err, test.expected)
+		}
+	}
+}
+
+func TestLogicalChannels(t *testing.T) {
+	v1 := parseLogicalChannels([]byte{0, 1, 0x80, 5, 0, 2, 0x7c, 0x0a, 0, 3}, false, "")
+	expected := []LogicalChannel{{ServiceID: 1, Number: 5, Visible: true}, {ServiceID: 2, Number: 10}}
+	if !reflect.DeepEqual(v1, expected) {
+		t.Errorf("version 1 %+v, expected %+v", v1, expected)
+	}
+
+	tv := append(append([]byte{1, 2}, "TV"...), 'N', 'O', 'R', 8, 0, 1, 0x80, 5, 0, 2, 0x80, 6)
+	radio := append(append([]byte{2, 5}, "Radio"...), 'N', 'O', 'R', 4, 0, 3, 0x82, 0x01)
+	for _, test := range []struct {
+		name     string
+		body     []byte
+		expected []LogicalChannel
+		err      bool
+	}{
+		{"version 2, 2 lists", append(append([]byte(nil), tv...), radio...), []LogicalChannel{
+			{ServiceID: 1, Number: 5, Visible: true, ChannelList: "TV"}, {ServiceID: 2, Number: 6, Visible: true, ChannelList: "TV"},
+			{ServiceID: 3, Number: 513, Visible: true, ChannelList: "Radio"}}, false},
+		{"name past the end", []byte{1, 9, 'T', 'V'}, nil, true},
+		{"list past the end", append(append([]byte(nil), tv...), radio[:len(radio)-2]...), []LogicalChannel{
+			{ServiceID: 1, Number: 5, Visible: true, ChannelList: "TV"}, {ServiceID: 2, Number: 6, Visible: true, ChannelList: "TV"}}, true},
+	} {
+		channels, err := parseNorDigChannelLists(test.body)
+		if (err != nil) != test.err || !reflect.DeepEqual(channels, test.expected) {
+			t.Errorf("%s: %+v, %v, expected %+v", test.name, channels, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package tshelper
+
+// TS packets are always 188 bytes, but they don't always arrive 188 bytes apart.
+// Blu-ray / AVCHD .m2ts files put a 4 byte arrival timestamp in front of each packet (192 bytes),
+// and DVB-ASI captures often keep the 16 bytes of Reed-Solomon parity after each one (204 bytes).
+// The sync tracker works out which it is while hunting, or can be told
+
+const tsPacketSize = 188
+
+// PacketFormat is the size and layout of the units the TS packets are carried in
+type PacketFormat uint8
+
+const (
+	PacketFormatAuto  PacketFormat = iota // detect while hunting for sync
+	PacketFormatTS188                     // plain TS packets
+	PacketFormatM2TS                      // 4 byte arrival timestamp then the TS packet (192 bytes)
+	PacketFormatRS204                     // TS packet then 16 bytes of Reed-Solomon parity (204 bytes)
+)
+
+// the formats tried, in order, when detecting.  Smallest first matters - see syncTracker.hunt
+var detectablePacketFormats = []PacketFormat{PacketFormatTS188, PacketFormatM2TS, PacketFormatRS204}
+
+func (format PacketFormat) String() string {
+	switch format {
+	case PacketFormatAuto:
+		return "Auto"
+	case PacketFormatTS188:
+		return "TS188"
+	case PacketFormatM2TS:
+		return "M2TS192"
+	case PacketFormatRS204:
+		return "RS204"
+	}
+	return "unknown"
+}
+
+// number of bytes from the start of one packet to the start of the next
+func (format PacketFormat) unitSize() int {
+	switch format {
+	case PacketFormatM2TS:
+		return 192
+	case PacketFormatRS204:
+		return 204
+	}
+	return tsPacketSize
+}
+
+// where in the unit the TS packet (and so its sync byte) starts
+func (format PacketFormat) syncOffset() int {
+	if format == PacketFormatM2TS {
+		return 4
+	}
+	return 0
+}
+
+// the M2TS TP_extra_header is 2 bits copy_permission_indicator then a 30 bit arrival_time_stamp,
+// counted on a 27MHz clock.  Only the timestamp is kept
+func extractArrivalTimestamp(extraHeader []byte) uint32 {
+	return ((uint32(extraHeader[0]) << 24) |
+		(uint32(extraHeader[1]) << 16) |
+		(uint32(extraHeader[2]) << 8) |
+		(uint32(extraHeader[3]) << 0)) & 0x3fffffff
+}
+
+// SetPacketFormat fixes the packet format rather than detecting it.  PacketFormatAuto (the default)
+// goes back to detecting, which happens again each time sync is lost
+func (metaInfo tsdmx) SetPacketFormat(format PacketFormat) {
+	metaInfo.sync.forcedFormat = format
+	if format != PacketFormatAuto {
+		metaInfo.sync.format = format
+	}
+}
+
+// PacketFormat is the packet format in use - the detected one once locked, or PacketFormatAuto if
+// nothing has been detected yet
+func (metaInfo tsdmx) PacketFormat() PacketFormat {
+	return metaInfo.sync.format
+}
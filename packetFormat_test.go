@@ -0,0 +1,91 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+// every 188 byte packet of a stream given a 4 byte TP_extra_header in front, arrival times
+// starting at first and going up by step
+func testM2TS(stream *testStream, first, step uint32) []byte {
+	var m2ts []byte
+	for rd, arrival := 0, first; rd < len(stream.data); rd, arrival = rd+tsPacketSize, arrival+step {
+		header := arrival | 0xc0000000 // copy_permission_indicator set, which is not part of the timestamp
+		m2ts = append(m2ts, uint8(header>>24), uint8(header>>16), uint8(header>>8), uint8(header))
+		m2ts = append(m2ts, stream.data[rd:rd+tsPacketSize]...)
+	}
+	return m2ts
+}
+
+// every 188 byte packet of a stream followed by 16 bytes of parity
+func testRS204(stream *testStream) []byte {
+	var rs204 []byte
+	for rd := 0; rd < len(stream.data); rd += tsPacketSize {
+		rs204 = append(rs204, stream.data[rd:rd+tsPacketSize]...)
+		rs204 = append(rs204, make([]byte, 16)...)
+	}
+	return rs204
+}
+
+func TestPacketFormatDetection(t *testing.T) {
+	stream := newTestStream()
+	stream.padding(5)
+
+	for _, test := range []struct {
+		name   string
+		data   []byte
+		forced PacketFormat
+		format PacketFormat
+	}{
+		{"TS188", stream.data, PacketFormatAuto, PacketFormatTS188},
+		{"M2TS", testM2TS(stream, 1000, 10), PacketFormatAuto, PacketFormatM2TS},
+		{"RS204", testRS204(stream), PacketFormatAuto, PacketFormatRS204},
+		{"M2TS given", testM2TS(stream, 1000, 10), PacketFormatM2TS, PacketFormatM2TS},
+		{"RS204 given", testRS204(stream), PacketFormatRS204, PacketFormatRS204},
+	} {
+		demuxer := NewDemuxer()
+		demuxer.SetPacketFormat(test.forced)
+		demuxer.Feed(test.data)
+		if format := demuxer.PacketFormat(); format != test.format {
+			t.Errorf("%s detected as %v", test.name, format)
+		}
+		if packets := demuxer.dmx.globalStats.totalPackets; packets != 5 {
+			t.Errorf("%s demuxed %d packets, expected 5", test.name, packets)
+		}
+		if offset := demuxer.Offset(); offset != uint64(len(test.data)) {
+			t.Errorf("%s: offset %d, expected %d", test.name, offset, len(test.data))
+		}
+		if events := demuxer.SyncEvents(); len(events) != 1 || events[0].Kind != SyncAcquired {
+			t.Errorf("%s: sync events %+v", test.name, events)
+		}
+	}
+}
+
+// an M2TS packet's arrival_time_stamp is in the Position of everything it gives rise to
+func TestArrivalTimestampInPosition(t *testing.T) {
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.padding(4)
+
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		arrivals []uint32 // of the PAT packet and the first null packet
+	}{
+		{"M2TS", testM2TS(stream, 1000, 10), []uint32{1000, 1010}},
+		{"TS188", stream.data, []uint32{0, 0}},
+		{"RS204", testRS204(stream), []uint32{0, 0}},
+	} {
+		demuxer := NewDemuxer()
+		events := &testEvents{}
+		demuxer.AddHandler(events)
+		demuxer.Feed(test.data)
+		var arrivals []uint32
+		for _, event := range events.newPIDs {
+			arrivals = append(arrivals, event.ArrivalTimestamp)
+		}
+		if !reflect.DeepEqual(arrivals, test.arrivals) {
+			t.Errorf("%s: arrival_time_stamps %v, expected %v", test.name, arrivals, test.arrivals)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package tshelper
+
+// PES packet reassembly
+// Every PID listed as a component in a PMT (that isn't carrying sections) has its payload gathered
+// up into whole PES packets.  A PES starts in a packet with PUSI set and ends either when
+// PES_packet_length bytes have arrived, or for unbounded PES (PES_packet_length 0, usual for video)
+// when the next one starts.  A continuity error loses the PES being built, as there is no way to
+// know what went missing
+
+import (
+	"errors"
+	"fmt"
+)
+
+// biggest PES we will hold on to, even a 4K intra picture fits easily.  Anything bigger is most
+// likely a stream where the PUSIs have gone missing
+const maxPESSize = 16 * 1024 * 1024
+
+// stream types that carry sections rather than PES, so are left to the table parsers
+var sectionStreamTypes = map[uint8]bool{0x05: true, 0x0b: true, 0x0c: true, 0x0d: true, 0x86: true}
+
+// PESPacket is 1 complete PES packet, with the header broken out.  The flags and header fields
+// are only filled in when HasOptionalHeader is set (ie not padding, private_stream_2, ECM etc)
+type PESPacket struct {
+	StreamID          uint8
+	PacketLength      uint16 // PES_packet_length, 0 for unbounded
+	HasOptionalHeader bool
+	ScramblingControl uint8
+	Priority          bool
+	DataAlignment     bool
+	Copyright         bool
+	Original          bool
+	PTSDTSFlags       uint8 // 2 = PTS only, 3 = PTS and DTS
+	HasPTS            bool
+	PTS               uint64 // 90kHz
+	HasDTS            bool
+	DTS               uint64 // 90kHz
+	ESCRFlag          bool
+	ESRateFlag        bool
+	DSMTrickModeFlag  bool
+	AdditionalCopy    bool
+	CRCFlag           bool
+	ExtensionFlag     bool
+	HeaderDataLength  uint8
+	Header            []byte // the optional fields, header_data_length bytes of them
+	Payload           []byte // the elementary stream data after the header
+}
+
+// PESEvent - a complete PES packet.  The position is that of the packet the PES started in
+type PESEvent struct {
+	Position
+	ProgramNumber uint16
+	StreamType    uint8
+	Packet        *PESPacket
+}
+
+// a PES being put together on one PID
+type pesBuffer struct {
+	start         Position
+	discontinuity bool   // discontinuity_indicator was set in the packet the PES started in
+	data          []byte // nil when not part way through a PES
+	expected      int    // total size including the 6 byte start, 0 if unbounded (or not yet known)
+}
+
+// stream_ids that have no optional PES header (13818-1 2.4.3.7)
+func pesHasOptionalHeader(streamID uint8) bool {
+	switch streamID {
+	case 0xbc, 0xbe, 0xbf, 0xf0, 0xf1, 0xf2, 0xf8, 0xff:
+		return false
+	}
+	return true
+}
+
+// break out the fields of a complete PES packet
+func parsePESPacket(data []byte) (*PESPacket, error) {
+	if len(data) < 6 {
+		return nil, errors.New("PES shorter than its 6 byte start")
+	}
+	if data[0] != 0 || data[1] != 0 || data[2] != 1 {
+		return nil, fmt.Errorf("PES start code prefix is 0x%02x%02x%02x", data[0], data[1], data[2])
+	}
+	pes := new(PESPacket)
+	pes.StreamID = data[3]
+	pes.PacketLength = (uint16(data[4]) << 8) | uint16(data[5])
+	pes.Payload = data[6:]
+	if !pesHasOptionalHeader(pes.StreamID) {
+		return pes, nil
+	}
+	if len(data) < 9 {
+		return nil, errors.New("PES too short for its optional header")
+	}
+	if data[6]&0xc0 != 0x80 {
+		return nil, fmt.Errorf("PES optional header marker bits are %d, expected 2", data[6]>>6)
+	}
+	pes.HasOptionalHeader = true
+	pes.ScramblingControl = (data[6] >> 4) & 0x3
+	pes.Priority = data[6]&0x08 != 0
+	pes.DataAlignment = data[6]&0x04 != 0
+	pes.Copyright = data[6]&0x02 != 0
+	pes.Original = data[6]&0x01 != 0
+	pes.PTSDTSFlags = data[7] >> 6
+	pes.ESCRFlag = data[7]&0x20 != 0
+	pes.ESRateFlag = data[7]&0x10 != 0
+	pes.DSMTrickModeFlag = data[7]&0x08 != 0
+	pes.AdditionalCopy = data[7]&0x04 != 0
+	pes.CRCFlag = data[7]&0x02 != 0
+	pes.ExtensionFlag = data[7]&0x01 != 0
+	pes.HeaderDataLength = data[8]
+	headerEnd := 9 + int(pes.HeaderDataLength)
+	if headerEnd > len(data) {
+		return nil, fmt.Errorf("PES_header_data_length %d runs past the end of the PES", pes.HeaderDataLength)
+	}
+	pes.Header = data[9:headerEnd]
+	pes.Payload = data[headerEnd:]
+	decodePESTimestamps(pes)
+	return pes, nil
+}
+
+// add the payload of 1 TS packet on an elementary stream PID to its PES, handing on any PES completed
+func (metaInfo tsdmx) assemblePES(pid uint16, pusi uint8, ccError bool, discontinuity bool, payload []byte, pidData *pidInfo) {
+	buffer := metaInfo.pes[pid]
+	if buffer == nil {
+		buffer = new(pesBuffer)
+		metaInfo.pes[pid] = buffer
+	}
+
+	if ccError && buffer.data != nil {
+		metaInfo.report.raise(SeverityWarning, DiagPESDiscarded, "continuity error, dropping %d bytes of PES", len(buffer.data))
+		buffer.data = nil
+	}
+
+	if pusi == 1 {
+		if buffer.data != nil {
+			if buffer.expected == 0 {
+				metaInfo.completePES(pid, buffer, pidData) // unbounded, ends where the next one starts
+			} else {
+				metaInfo.report.raise(SeverityWarning, DiagPESDiscarded, "new PES started with only %d of %d bytes of the last", len(buffer.data), buffer.expected)
+			}
+		}
+		buffer.start = metaInfo.report.position
+		buffer.discontinuity = discontinuity
+		buffer.data = make([]byte, 0, len(payload))
+		buffer.expected = 0
+	} else if buffer.data == nil {
+		return // waiting for the start of a PES
+	}
+
+	buffer.data = append(buffer.data, payload...)
+	if buffer.expected == 0 && len(buffer.data) >= 6 {
+		if length := (int(buffer.data[4]) << 8) | int(buffer.data[5]); length != 0 {
+			buffer.expected = 6 + length
+		}
+	}
+
+	if buffer.expected != 0 && len(buffer.data) >= buffer.expected {
+		buffer.data = buffer.data[:buffer.expected] // anything after is stuffing
+		metaInfo.completePES(pid, buffer, pidData)
+	} else if len(buffer.data) > maxPESSize {
+		metaInfo.report.raise(SeverityWarning, DiagPESDiscarded, "PES grew past %d bytes without ending, dropped", maxPESSize)
+		buffer.data = nil
+	}
+}
+
+// parse and hand on a PES that has all arrived, leaving the buffer empty
+func (metaInfo tsdmx) completePES(pid uint16, buffer *pesBuffer, pidData *pidInfo) {
+	data := buffer.data
+	buffer.data = nil
+
+	packet, err := parsePESPacket(data)
+	if err != nil {
+		metaInfo.report.raiseAt(buffer.start, SeverityWarning, DiagBadPESHeader, "%v", err)
+		return
+	}
+	metaInfo.trackTimestamps(packet, pidData, buffer.discontinuity, buffer.start)
+
+	programNumber := metaInfo.tables.elementaryStreams[pid]
+	event := &PESEvent{Position: buffer.start, ProgramNumber: programNumber, Packet: packet}
+	for _, comp := range metaInfo.tables.serviceMap[programNumber].streamComps {
+		if comp.streamPID == pid {
+			event.StreamType = comp.streamType
+		}
+	}
+	metaInfo.tables.checkSpliceCues(programNumber, event.StreamType, packet, buffer.start)
+	for _, handler := range metaInfo.report.handlers {
+		handler.OnPES(event)
+	}
+}
+
+// Flush hands on any unbounded PES still being put together, as at the end of the stream
+// nothing else is going to finish them
+func (metaInfo tsdmx) Flush() {
+	for pid, buffer := range metaInfo.pes {
+		if buffer.data != nil && buffer.expected == 0 {
+			pidData := metaInfo.pidStats[pid]
+			metaInfo.completePES(pid, buffer, &pidData)
+			metaInfo.pidStats[pid] = pidData
+		}
+		buffer.data = nil
+	}
+}
@@ -0,0 +1,102 @@
+package tshelper
+
+import (
+	"bytes"
+	"testing"
+)
+
+// a PAT and a PMT with video on 0x101 and audio on 0x102
+func testPESStream() *testStream {
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.section(0x100, testPMT(0, 0x1b, 0x101, 0x0f, 0x102))
+	return stream
+}
+
+func TestPESReassembly(t *testing.T) {
+	video := bytes.Repeat([]byte{0xaa}, 500) // spans 3 packets
+	audio := bytes.Repeat([]byte{0xbb}, 20)
+
+	stream := testPESStream()
+	stream.pes(0x101, testPES(0xe0, 3600, 0, video, false))
+	stream.pes(0x102, testPES(0xc0, 1800, 0, audio, true))
+	stream.pes(0x101, testPES(0xe0, 7200, 3600, video, false)) // ends the first, unbounded, one
+
+	demuxer, diagnostics := newTestDemuxer()
+	events := &testEvents{}
+	demuxer.AddHandler(events)
+	feedTestStream(t, demuxer, stream)
+	demuxer.Flush()
+
+	if len(events.pes) != 3 {
+		t.Fatalf("%d PES, expected 3 (diagnostics %v)", len(events.pes), *diagnostics)
+	}
+	for i, expected := range []struct {
+		pid        uint16
+		streamID   uint8
+		streamType uint8
+		header     []byte
+		pts, dts   uint64
+		hasDTS     bool
+		payload    []byte
+	}{
+		{0x102, 0xc0, 0x0f, testTimestamp(2, 1800), 1800, 0, false, audio},
+		{0x101, 0xe0, 0x1b, testTimestamp(2, 3600), 3600, 0, false, video},
+		{0x101, 0xe0, 0x1b, append(testTimestamp(3, 7200), testTimestamp(1, 3600)...), 7200, 3600, true, video},
+	} {
+		event := events.pes[i]
+		if event.PID != expected.pid || event.ProgramNumber != 1 || event.StreamType != expected.streamType || event.Packet.StreamID != expected.streamID {
+			t.Errorf("PES %d: PID 0x%x program %d stream_type 0x%x stream_id 0x%x", i, event.PID, event.ProgramNumber, event.StreamType, event.Packet.StreamID)
+		}
+		if !bytes.Equal(event.Packet.Header, expected.header) {
+			t.Errorf("PES %d: optional fields %X, expected %X", i, event.Packet.Header, expected.header)
+		}
+		if packet := event.Packet; !packet.HasPTS || packet.PTS != expected.pts || packet.HasDTS != expected.hasDTS || packet.DTS != expected.dts {
+			t.Errorf("PES %d: PTS %v %d DTS %v %d", i, packet.HasPTS, packet.PTS, packet.HasDTS, packet.DTS)
+		}
+		if !bytes.Equal(event.Packet.Payload, expected.payload) {
+			t.Errorf("PES %d: %d bytes of payload, expected %d", i, len(event.Packet.Payload), len(expected.payload))
+		}
+	}
+}
+
+func TestPESDamage(t *testing.T) {
+	video := bytes.Repeat([]byte{0xaa}, 500)
+	badStart := testPES(0xc0, 1800, 0, []byte{1}, true)
+	badStart[2] = 2
+	badHeaderLength := testPES(0xc0, 1800, 0, []byte{1}, true)
+	badHeaderLength[8] = 50
+
+	for _, test := range []struct {
+		name  string
+		pes   [][]byte
+		ccErr int // packet to break the continuity_counter of, counting from the first PES packet
+		pesOK int
+		code  DiagnosticCode
+	}{
+		{"continuity error part way through", [][]byte{testPES(0xe0, 3600, 0, video, false), testPES(0xe0, 7200, 0, video, false)}, 1, 1, DiagPESDiscarded},
+		{"bounded PES cut short", [][]byte{testPES(0xe0, 3600, 0, video, true)[:184], testPES(0xe0, 7200, 0, video, true)}, -1, 1, DiagPESDiscarded},
+		{"bad start code prefix", [][]byte{badStart}, -1, 0, DiagBadPESHeader},
+		{"PES_header_data_length too long", [][]byte{badHeaderLength}, -1, 0, DiagBadPESHeader},
+	} {
+		stream := testPESStream()
+		start := len(stream.data)
+		for _, pes := range test.pes {
+			stream.pes(0x101, pes)
+		}
+		if test.ccErr >= 0 {
+			stream.data[start+test.ccErr*tsPacketSize+3] ^= 0x04
+		}
+		demuxer, diagnostics := newTestDemuxer()
+		events := &testEvents{}
+		demuxer.AddHandler(events)
+		demuxer.Feed(stream.data)
+		demuxer.Flush()
+		if len(events.pes) != test.pesOK {
+			t.Errorf("%s: %d PES, expected %d", test.name, len(events.pes), test.pesOK)
+		}
+		if diagnostics.count(test.code) != 1 {
+			t.Errorf("%s: diagnostics %v, expected a %v", test.name, *diagnostics, test.code)
+		}
+	}
+}
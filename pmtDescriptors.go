@@ -0,0 +1,422 @@
+package tshelper
+
+// the descriptors found in PMTs, both the program_info loop and each elementary stream's loop.
+// Every descriptor is kept, tag, name and body, and the standard ones (ISO/IEC 13818-1 and
+// EN 300 468) are decoded into Value as well.  The types Value can hold are listed against
+// decodePMTDescriptor, anything else leaves it nil unless a DescriptorDecoder has been registered
+// for it (privateDecoders.go)
+
+import (
+	"fmt"
+)
+
+// Descriptor is 1 descriptor from a PMT, or a private one from another table.  Value is shared
+// with the demux, every Report and every event, see report.go and events.go
+type Descriptor struct {
+	Tag   uint8       `json:"tag"`
+	Name  string      `json:"name"`
+	Raw   []byte      `json:"raw"`             // body, after the tag and length
+	Value interface{} `json:"value,omitempty"` // decoded body, nil if it isn't a descriptor we know
+}
+
+// ISO639Language is 1 entry of an ISO_639_language_descriptor
+type ISO639Language struct {
+	Language      string `json:"language"`
+	AudioType     uint8  `json:"audioType"`
+	AudioTypeName string `json:"audioTypeName"`
+}
+
+// RegistrationDescriptor - the format_identifier (registered with SMPTE) the stream follows
+type RegistrationDescriptor struct {
+	FormatIdentifier uint32 `json:"formatIdentifier"`
+	Format           string `json:"format"` // the identifier as its 4 characters
+	AdditionalInfo   []byte `json:"additionalInfo,omitempty"`
+}
+
+// StreamIdentifierDescriptor - the component_tag other tables use to refer to the stream
+type StreamIdentifierDescriptor struct {
+	ComponentTag uint8 `json:"componentTag"`
+}
+
+// MaximumBitrateDescriptor - bits/s
+type MaximumBitrateDescriptor struct {
+	Bitrate uint32 `json:"bitrate"`
+}
+
+// MultiplexBufferUtilizationDescriptor - the bounds on the LTW offset, in 27MHz / 300 units
+type MultiplexBufferUtilizationDescriptor struct {
+	BoundValid          bool   `json:"boundValid"`
+	LTWOffsetLowerBound uint16 `json:"ltwOffsetLowerBound"`
+	LTWOffsetUpperBound uint16 `json:"ltwOffsetUpperBound"`
+}
+
+// AVCVideoDescriptor - the H.264 profile and level
+type AVCVideoDescriptor struct {
+	ProfileIDC                uint8 `json:"profileIdc"`
+	ConstraintFlags           uint8 `json:"constraintFlags"` // constraint_set0_flag down to the AVC_compatible_flags
+	LevelIDC                  uint8 `json:"levelIdc"`
+	StillPresent              bool  `json:"stillPresent"`
+	Has24HourPicture          bool  `json:"has24HourPicture"`
+	FramePackingSEINotPresent bool  `json:"framePackingSeiNotPresent"`
+}
+
+// HEVCVideoDescriptor - the H.265 profile, tier and level.  The temporal ids are only there with
+// TemporalLayerSubset
+type HEVCVideoDescriptor struct {
+	ProfileSpace              uint8  `json:"profileSpace"`
+	HighTier                  bool   `json:"highTier"`
+	ProfileIDC                uint8  `json:"profileIdc"`
+	ProfileCompatibility      uint32 `json:"profileCompatibility"`
+	Progressive               bool   `json:"progressive"`
+	Interlaced                bool   `json:"interlaced"`
+	NonPacked                 bool   `json:"nonPacked"`
+	FrameOnly                 bool   `json:"frameOnly"`
+	LevelIDC                  uint8  `json:"levelIdc"`
+	TemporalLayerSubset       bool   `json:"temporalLayerSubset"`
+	StillPresent              bool   `json:"stillPresent"`
+	Has24HourPicture          bool   `json:"has24HourPicture"`
+	SubPicHRDParamsNotPresent bool   `json:"subPicHrdParamsNotPresent"`
+	HDRWCGIdc                 uint8  `json:"hdrWcgIdc"`
+	TemporalIDMin             uint8  `json:"temporalIdMin,omitempty"`
+	TemporalIDMax             uint8  `json:"temporalIdMax,omitempty"`
+}
+
+// AC3Descriptor is the DVB AC-3_descriptor (0x6A) and enhanced_AC-3_descriptor (0x7A).  Fields
+// the descriptor leaves out are nil, the substreams and MixInfoExists are E-AC-3 only
+type AC3Descriptor struct {
+	Enhanced       bool   `json:"enhanced"`
+	ComponentType  *uint8 `json:"componentType,omitempty"`
+	BSID           *uint8 `json:"bsid,omitempty"`
+	MainID         *uint8 `json:"mainId,omitempty"`
+	ASVC           *uint8 `json:"asvc,omitempty"`
+	MixInfoExists  bool   `json:"mixInfoExists,omitempty"`
+	Substream1     *uint8 `json:"substream1,omitempty"`
+	Substream2     *uint8 `json:"substream2,omitempty"`
+	Substream3     *uint8 `json:"substream3,omitempty"`
+	AdditionalInfo []byte `json:"additionalInfo,omitempty"`
+}
+
+// AACDescriptor - the DVB AAC_descriptor (0x7C)
+type AACDescriptor struct {
+	ProfileAndLevel uint8  `json:"profileAndLevel"`
+	SAOCDE          bool   `json:"saocDe"`
+	AACType         *uint8 `json:"aacType,omitempty"`
+	AdditionalInfo  []byte `json:"additionalInfo,omitempty"`
+}
+
+// Subtitling is 1 entry of a subtitling_descriptor
+type Subtitling struct {
+	Language          string `json:"language"`
+	SubtitlingType    uint8  `json:"subtitlingType"`
+	CompositionPageID uint16 `json:"compositionPageId"`
+	AncillaryPageID   uint16 `json:"ancillaryPageId"`
+}
+
+// Teletext is 1 entry of a teletext_descriptor or VBI_teletext_descriptor.  Magazine is 1 - 8,
+// Page the 2 hex digits of the page within it, so page 888 is magazine 8 page 0x88
+type Teletext struct {
+	Language     string `json:"language"`
+	TeletextType uint8  `json:"teletextType"`
+	TypeName     string `json:"typeName"`
+	Magazine     uint8  `json:"magazine"`
+	Page         uint8  `json:"page"`
+}
+
+// DataBroadcastIDDescriptor - the data broadcast specification the stream follows
+type DataBroadcastIDDescriptor struct {
+	DataBroadcastID uint16 `json:"dataBroadcastId"`
+	IDSelector      []byte `json:"idSelector,omitempty"`
+}
+
+// PrivateDataSpecifierDescriptor - who defines the private descriptors after it in the same loop
+type PrivateDataSpecifierDescriptor struct {
+	PrivateDataSpecifier uint32 `json:"privateDataSpecifier"`
+}
+
+// CueIdentifierDescriptor - SCTE-35 cue_identifier_descriptor, which kinds of splice_info_section
+// the stream carries
+type CueIdentifierDescriptor struct {
+	CueStreamType uint8 `json:"cueStreamType"`
+}
+
+var pmtDescriptorNames = map[uint8]string{
+	0x02: "video_stream_descriptor",
+	0x03: "audio_stream_descriptor",
+	0x05: "registration_descriptor",
+	0x06: "data_stream_alignment_descriptor",
+	0x09: "CA_descriptor",
+	0x0a: "ISO_639_language_descriptor",
+	0x0c: "multiplex_buffer_utilization_descriptor",
+	0x0e: "maximum_bitrate_descriptor",
+	0x10: "smoothing_buffer_descriptor",
+	0x1c: "MPEG-4_audio_descriptor",
+	0x28: "AVC_video_descriptor",
+	0x2a: "AVC_timing_and_HRD_descriptor",
+	0x38: "HEVC_video_descriptor",
+	0x45: "VBI_data_descriptor",
+	0x46: "VBI_teletext_descriptor",
+	0x52: "stream_identifier_descriptor",
+	0x56: "teletext_descriptor",
+	0x59: "subtitling_descriptor",
+	0x5f: "private_data_specifier_descriptor",
+	0x66: "data_broadcast_id_descriptor",
+	0x6a: "AC-3_descriptor",
+	0x7a: "enhanced_AC-3_descriptor",
+	0x7b: "DTS_descriptor",
+	0x7c: "AAC_descriptor",
+	0x7f: "extension_descriptor",
+	0x81: "ATSC_AC-3_audio_descriptor",
+	0x86: "caption_service_descriptor",
+	0x8a: "cue_identifier_descriptor",
+}
+
+var (
+	audioTypeNames    = []string{"undefined", "clean effects", "hearing impaired", "visual impaired commentary"}
+	teletextTypeNames = []string{"reserved", "initial page", "subtitle page", "additional information page", "programme schedule page", "hearing impaired subtitle page"}
+)
+
+func optionalByte(value uint8) *uint8 {
+	return &value
+}
+
+// the AC-3 and E-AC-3 descriptors start with flags saying which of the 1 byte fields follow
+func parseAC3Descriptor(body []byte, enhanced bool) (*AC3Descriptor, error) {
+	ac3 := &AC3Descriptor{Enhanced: enhanced}
+	if len(body) < 1 {
+		return ac3, fmt.Errorf("AC-3 descriptor with no flags")
+	}
+	flags := body[0]
+	fields := []**uint8{&ac3.ComponentType, &ac3.BSID, &ac3.MainID, &ac3.ASVC}
+	if enhanced {
+		ac3.MixInfoExists = flags&0x08 != 0
+		fields = append(fields, nil, &ac3.Substream1, &ac3.Substream2, &ac3.Substream3)
+	}
+	rd := 1
+	for i, field := range fields {
+		if field == nil || flags&(0x80>>uint(i)) == 0 {
+			continue
+		}
+		if rd >= len(body) {
+			return ac3, fmt.Errorf("AC-3 descriptor flags 0x%02x need more than its %d bytes", flags, len(body))
+		}
+		*field = optionalByte(body[rd])
+		rd += 1
+	}
+	if rd < len(body) {
+		ac3.AdditionalInfo = append([]byte(nil), body[rd:]...)
+	}
+	return ac3, nil
+}
+
+func parseHEVCVideoDescriptor(body []byte) (*HEVCVideoDescriptor, error) {
+	if len(body) < 13 {
+		return nil, fmt.Errorf("HEVC_video_descriptor length %d, needs at least 13", len(body))
+	}
+	hevc := &HEVCVideoDescriptor{
+		ProfileSpace:              body[0] >> 6,
+		HighTier:                  body[0]&0x20 != 0,
+		ProfileIDC:                body[0] & 0x1f,
+		ProfileCompatibility:      (uint32(body[1]) << 24) | (uint32(body[2]) << 16) | (uint32(body[3]) << 8) | uint32(body[4]),
+		Progressive:               body[5]&0x80 != 0,
+		Interlaced:                body[5]&0x40 != 0,
+		NonPacked:                 body[5]&0x20 != 0,
+		FrameOnly:                 body[5]&0x10 != 0,
+		LevelIDC:                  body[11],
+		TemporalLayerSubset:       body[12]&0x80 != 0,
+		StillPresent:              body[12]&0x40 != 0,
+		Has24HourPicture:          body[12]&0x20 != 0,
+		SubPicHRDParamsNotPresent: body[12]&0x10 != 0,
+		HDRWCGIdc:                 body[12] & 0x03,
+	}
+	if hevc.TemporalLayerSubset {
+		if len(body) < 15 {
+			return hevc, fmt.Errorf("HEVC_video_descriptor length %d, needs 15 with temporal_layer_subset_flag", len(body))
+		}
+		hevc.TemporalIDMin = body[13] >> 5
+		hevc.TemporalIDMax = body[14] >> 5
+	}
+	return hevc, nil
+}
+
+// decode the body of 1 PMT descriptor.  Value is one of
+//
+//	CADescriptor, []ISO639Language, *RegistrationDescriptor, *StreamIdentifierDescriptor,
+//	*MaximumBitrateDescriptor, *MultiplexBufferUtilizationDescriptor, *AVCVideoDescriptor,
+//	*HEVCVideoDescriptor, *AC3Descriptor, *AACDescriptor, []Subtitling, []Teletext,
+//	*PrivateDataSpecifierDescriptor, *DataBroadcastIDDescriptor, *CueIdentifierDescriptor
+//
+// or nil for any other tag
+func decodePMTDescriptor(tag uint8, body []byte) (interface{}, error) {
+	name := pmtDescriptorNames[tag]
+	switch tag {
+	case 0x05:
+		if len(body) < 4 {
+			return nil, fmt.Errorf("%s length %d, needs at least 4", name, len(body))
+		}
+		registration := &RegistrationDescriptor{
+			FormatIdentifier: (uint32(body[0]) << 24) | (uint32(body[1]) << 16) | (uint32(body[2]) << 8) | uint32(body[3]),
+			Format:           string(body[0:4]),
+		}
+		if len(body) > 4 {
+			registration.AdditionalInfo = append([]byte(nil), body[4:]...)
+		}
+		return registration, nil
+	case 0x09:
+		ca, err := parseCADescriptor(body)
+		if err != nil {
+			return nil, err
+		}
+		return ca, nil
+	case 0x0a:
+		var languages []ISO639Language
+		for rd := 0; rd+4 <= len(body); rd += 4 {
+			languages = append(languages, ISO639Language{Language: string(body[rd : rd+3]), AudioType: body[rd+3], AudioTypeName: valueName(audioTypeNames, body[rd+3])})
+		}
+		return languages, nil
+	case 0x0c:
+		if len(body) != 4 {
+			return nil, fmt.Errorf("%s length %d, expected 4", name, len(body))
+		}
+		return &MultiplexBufferUtilizationDescriptor{
+			BoundValid:          body[0]&0x80 != 0,
+			LTWOffsetLowerBound: ((uint16(body[0]) << 8) | uint16(body[1])) & 0x7fff,
+			LTWOffsetUpperBound: ((uint16(body[2]) << 8) | uint16(body[3])) & 0x7fff,
+		}, nil
+	case 0x0e:
+		if len(body) != 3 {
+			return nil, fmt.Errorf("%s length %d, expected 3", name, len(body))
+		}
+		// in units of 50 bytes/s
+		return &MaximumBitrateDescriptor{Bitrate: (((uint32(body[0]) << 16) | (uint32(body[1]) << 8) | uint32(body[2])) & 0x3fffff) * 50 * 8}, nil
+	case 0x28:
+		if len(body) < 4 {
+			return nil, fmt.Errorf("%s length %d, needs at least 4", name, len(body))
+		}
+		return &AVCVideoDescriptor{
+			ProfileIDC:                body[0],
+			ConstraintFlags:           body[1],
+			LevelIDC:                  body[2],
+			StillPresent:              body[3]&0x80 != 0,
+			Has24HourPicture:          body[3]&0x40 != 0,
+			FramePackingSEINotPresent: body[3]&0x20 != 0,
+		}, nil
+	case 0x38:
+		return parseHEVCVideoDescriptor(body)
+	case 0x46, 0x56:
+		var pages []Teletext
+		for rd := 0; rd+5 <= len(body); rd += 5 {
+			page := Teletext{Language: string(body[rd : rd+3]), TeletextType: body[rd+3] >> 3, Magazine: body[rd+3] & 0x07, Page: body[rd+4]}
+			page.TypeName = valueName(teletextTypeNames, page.TeletextType)
+			if page.Magazine == 0 {
+				page.Magazine = 8
+			}
+			pages = append(pages, page)
+		}
+		return pages, nil
+	case 0x52:
+		if len(body) != 1 {
+			return nil, fmt.Errorf("%s length %d, expected 1", name, len(body))
+		}
+		return &StreamIdentifierDescriptor{ComponentTag: body[0]}, nil
+	case 0x59:
+		var subtitles []Subtitling
+		for rd := 0; rd+8 <= len(body); rd += 8 {
+			subtitles = append(subtitles, Subtitling{
+				Language:          string(body[rd : rd+3]),
+				SubtitlingType:    body[rd+3],
+				CompositionPageID: (uint16(body[rd+4]) << 8) | uint16(body[rd+5]),
+				AncillaryPageID:   (uint16(body[rd+6]) << 8) | uint16(body[rd+7]),
+			})
+		}
+		return subtitles, nil
+	case 0x5f:
+		if len(body) != 4 {
+			return nil, fmt.Errorf("%s length %d, expected 4", name, len(body))
+		}
+		return &PrivateDataSpecifierDescriptor{PrivateDataSpecifier: privateDataSpecifierAfter(tag, body, 0)}, nil
+	case 0x66:
+		if len(body) < 2 {
+			return nil, fmt.Errorf("%s length %d, needs at least 2", name, len(body))
+		}
+		dataBroadcast := &DataBroadcastIDDescriptor{DataBroadcastID: (uint16(body[0]) << 8) | uint16(body[1])}
+		if len(body) > 2 {
+			dataBroadcast.IDSelector = append([]byte(nil), body[2:]...)
+		}
+		return dataBroadcast, nil
+	case 0x6a, 0x7a:
+		return parseAC3Descriptor(body, tag == 0x7a)
+	case 0x7c:
+		if len(body) < 1 {
+			return nil, fmt.Errorf("%s with no profile_and_level", name)
+		}
+		aac := &AACDescriptor{ProfileAndLevel: body[0]}
+		rd := 1
+		if len(body) > 1 {
+			aac.SAOCDE = body[1]&0x40 != 0
+			rd = 2
+			if body[1]&0x80 != 0 {
+				if len(body) < 3 {
+					return aac, fmt.Errorf("%s has AAC_type_flag set but no AAC_type", name)
+				}
+				aac.AACType = optionalByte(body[2])
+				rd = 3
+			}
+		}
+		if rd < len(body) {
+			aac.AdditionalInfo = append([]byte(nil), body[rd:]...)
+		}
+		return aac, nil
+	case 0x8a:
+		if len(body) < 1 {
+			return nil, fmt.Errorf("%s with no cue_stream_type", name)
+		}
+		return &CueIdentifierDescriptor{CueStreamType: body[0]}, nil
+	}
+	return nil, nil
+}
+
+// decode a PMT descriptor loop.  Every descriptor that fits in the loop is handed back, the first
+// problem with any of them comes back as the error
+func parsePMTDescriptors(loop []byte, decoders *decoderRegistry) ([]Descriptor, error) {
+	descriptors := make([]Descriptor, 0)
+	var firstErr error
+	specifier := AnyPrivateDataSpecifier
+	err := forEachDescriptor(loop, func(tag uint8, body []byte) {
+		descriptor, found, err := decoders.decodeDescriptor(tag, specifier, body)
+		specifier = privateDataSpecifierAfter(tag, body, specifier)
+		if found {
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			descriptors = append(descriptors, descriptor)
+			return
+		}
+		descriptor = Descriptor{Tag: tag, Name: descriptorName(tag), Raw: append([]byte(nil), body...)}
+		value, err := decodePMTDescriptor(tag, body)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err == nil {
+			descriptor.Value = value
+		}
+		descriptors = append(descriptors, descriptor)
+	})
+	if err != nil {
+		return descriptors, err
+	}
+	return descriptors, firstErr
+}
+
+// a copy of a descriptor list, Raw and all.  Value is shared, it is whatever the decoder made of
+// the descriptor
+func copyDescriptors(descriptors []Descriptor) []Descriptor {
+	if len(descriptors) == 0 {
+		return nil
+	}
+	copied := make([]Descriptor, len(descriptors))
+	for i, descriptor := range descriptors {
+		copied[i] = descriptor
+		copied[i].Raw = append([]byte(nil), descriptor.Raw...)
+	}
+	return copied
+}
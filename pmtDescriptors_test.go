@@ -0,0 +1,162 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodePMTDescriptor(t *testing.T) {
+	hevc := []byte{0x61, 0x60, 0x00, 0x00, 0x00, 0xb0, 0, 0, 0, 0, 0, 0x78, 0x32}
+	hevcSubset := append(append([]byte(nil), hevc...), 0x20, 0xc0)
+	hevcSubset[12] |= 0x80
+	for _, test := range []struct {
+		name  string
+		tag   uint8
+		body  []byte
+		value interface{}
+	}{
+		{"registration", 0x05, []byte("CUEI"), &RegistrationDescriptor{FormatIdentifier: cueIdentifier, Format: "CUEI"}},
+		{"registration additional_identification_info", 0x05, []byte("HEVC\x01\x02"), &RegistrationDescriptor{FormatIdentifier: 0x48455643, Format: "HEVC", AdditionalInfo: []byte{1, 2}}},
+		{"CA", 0x09, []byte{0x01, 0x00, 0xe1, 0x23, 0xaa}, CADescriptor{SystemID: 0x0100, Vendor: caSystemName(0x0100), PID: 0x123, PrivateData: []byte{0xaa}}},
+		{"ISO 639 language", 0x0a, []byte{'e', 'n', 'g', 0, 'd', 'e', 'u', 3, 'x'}, []ISO639Language{{"eng", 0, "undefined"}, {"deu", 3, "visual impaired commentary"}}},
+		{"multiplex buffer utilization", 0x0c, []byte{0x81, 0x02, 0x83, 0x04}, &MultiplexBufferUtilizationDescriptor{BoundValid: true, LTWOffsetLowerBound: 0x0102, LTWOffsetUpperBound: 0x0304}},
+		{"maximum bitrate", 0x0e, []byte{0xc0, 0x01, 0x00}, &MaximumBitrateDescriptor{Bitrate: 256 * 50 * 8}},
+		{"AVC video", 0x28, []byte{0x64, 0x0c, 0x28, 0xa0}, &AVCVideoDescriptor{ProfileIDC: 0x64, ConstraintFlags: 0x0c, LevelIDC: 0x28, StillPresent: true, FramePackingSEINotPresent: true}},
+		{"HEVC video", 0x38, hevc, &HEVCVideoDescriptor{ProfileSpace: 1, HighTier: true, ProfileIDC: 1, ProfileCompatibility: 0x60000000,
+			Progressive: true, NonPacked: true, FrameOnly: true, LevelIDC: 0x78, Has24HourPicture: true, SubPicHRDParamsNotPresent: true, HDRWCGIdc: 2}},
+		{"HEVC video temporal_layer_subset", 0x38, hevcSubset, &HEVCVideoDescriptor{ProfileSpace: 1, HighTier: true, ProfileIDC: 1, ProfileCompatibility: 0x60000000,
+			Progressive: true, NonPacked: true, FrameOnly: true, LevelIDC: 0x78, TemporalLayerSubset: true, Has24HourPicture: true, SubPicHRDParamsNotPresent: true, HDRWCGIdc: 2,
+			TemporalIDMin: 1, TemporalIDMax: 6}},
+		{"teletext magazine 0 is 8", 0x56, []byte{'e', 'n', 'g', 0x08, 0x88, 'f', 'r', 'a', 0x11, 0x01}, []Teletext{
+			{Language: "eng", TeletextType: 1, TypeName: "initial page", Magazine: 8, Page: 0x88},
+			{Language: "fra", TeletextType: 2, TypeName: "subtitle page", Magazine: 1, Page: 0x01}}},
+		{"VBI teletext", 0x46, []byte{'e', 'n', 'g', 0x2f, 0x50}, []Teletext{{Language: "eng", TeletextType: 5, TypeName: "hearing impaired subtitle page", Magazine: 7, Page: 0x50}}},
+		{"stream identifier", 0x52, []byte{5}, &StreamIdentifierDescriptor{ComponentTag: 5}},
+		{"subtitling", 0x59, []byte{'e', 'n', 'g', 0x10, 0x00, 0x01, 0x00, 0x02, 'x'}, []Subtitling{{Language: "eng", SubtitlingType: 0x10, CompositionPageID: 1, AncillaryPageID: 2}}},
+		{"data broadcast id", 0x66, []byte{0x01, 0x23}, &DataBroadcastIDDescriptor{DataBroadcastID: 0x0123}},
+		{"data broadcast id selector", 0x66, []byte{0x01, 0x23, 9}, &DataBroadcastIDDescriptor{DataBroadcastID: 0x0123, IDSelector: []byte{9}}},
+		{"AC-3 no fields", 0x6a, []byte{0x00}, &AC3Descriptor{}},
+		{"AC-3 every field", 0x6a, []byte{0xf0, 1, 2, 3, 4, 5}, &AC3Descriptor{ComponentType: optionalByte(1), BSID: optionalByte(2), MainID: optionalByte(3), ASVC: optionalByte(4), AdditionalInfo: []byte{5}}},
+		{"AC-3 bsid only", 0x6a, []byte{0x40, 8}, &AC3Descriptor{BSID: optionalByte(8)}},
+		{"E-AC-3 substreams", 0x7a, []byte{0x4f, 16, 1, 2, 3}, &AC3Descriptor{Enhanced: true, BSID: optionalByte(16), MixInfoExists: true,
+			Substream1: optionalByte(1), Substream2: optionalByte(2), Substream3: optionalByte(3)}},
+		{"E-AC-3 component type and substream 2", 0x7a, []byte{0x82, 0x44, 7}, &AC3Descriptor{Enhanced: true, ComponentType: optionalByte(0x44), Substream2: optionalByte(7)}},
+		{"AAC profile only", 0x7c, []byte{0x58}, &AACDescriptor{ProfileAndLevel: 0x58}},
+		{"AAC SAOC_DE", 0x7c, []byte{0x58, 0x40}, &AACDescriptor{ProfileAndLevel: 0x58, SAOCDE: true}},
+		{"AAC_type_flag", 0x7c, []byte{0x58, 0x80, 0x03, 0xee}, &AACDescriptor{ProfileAndLevel: 0x58, AACType: optionalByte(3), AdditionalInfo: []byte{0xee}}},
+		{"cue identifier", 0x8a, []byte{cueStreamTypeAllCommands}, &CueIdentifierDescriptor{CueStreamType: cueStreamTypeAllCommands}},
+		{"not decoded", 0x7b, []byte{1, 2}, nil},
+	} {
+		value, err := decodePMTDescriptor(test.tag, test.body)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(value, test.value) {
+			t.Errorf("%s: %#v, expected %#v", test.name, value, test.value)
+		}
+	}
+}
+
+func TestDecodePMTDescriptorMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		tag  uint8
+		body []byte
+	}{
+		{"registration too short", 0x05, []byte("CUE")},
+		{"CA too short", 0x09, []byte{0x01, 0x00, 0xe1}},
+		{"multiplex buffer utilization too short", 0x0c, []byte{0x81, 0x02, 0x83}},
+		{"multiplex buffer utilization too long", 0x0c, []byte{0x81, 0x02, 0x83, 0x04, 0}},
+		{"maximum bitrate too short", 0x0e, []byte{0xc0, 0x01}},
+		{"AVC video too short", 0x28, []byte{0x64, 0x0c, 0x28}},
+		{"HEVC video too short", 0x38, make([]byte, 12)},
+		{"HEVC video temporal_layer_subset cut short", 0x38, append(make([]byte, 12), 0x80, 0x20)},
+		{"stream identifier too long", 0x52, []byte{5, 6}},
+		{"data broadcast id too short", 0x66, []byte{0x01}},
+		{"AC-3 no flags", 0x6a, nil},
+		{"AC-3 flags past the end", 0x6a, []byte{0xc0, 1}},
+		{"E-AC-3 substream past the end", 0x7a, []byte{0x01}},
+		{"AAC no profile", 0x7c, nil},
+		{"AAC_type_flag with no AAC_type", 0x7c, []byte{0x58, 0x80}},
+		{"cue identifier empty", 0x8a, nil},
+	} {
+		if _, err := decodePMTDescriptor(test.tag, test.body); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+// every descriptor is kept, with the value only when it decodes, and the first error comes back
+func TestParsePMTDescriptors(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		loop        []byte
+		descriptors []Descriptor
+		fails       bool
+	}{
+		{"empty", nil, []Descriptor{}, false},
+		{"known and unknown", []byte{0x52, 1, 5, 0xf3, 1, 9}, []Descriptor{
+			{Tag: 0x52, Name: "stream_identifier_descriptor", Raw: []byte{5}, Value: &StreamIdentifierDescriptor{ComponentTag: 5}},
+			{Tag: 0xf3, Name: "descriptor 0xf3", Raw: []byte{9}}}, false},
+		{"bad length kept without a value", []byte{0x52, 2, 5, 6, 0x8a, 1, 1}, []Descriptor{
+			{Tag: 0x52, Name: "stream_identifier_descriptor", Raw: []byte{5, 6}},
+			{Tag: 0x8a, Name: "cue_identifier_descriptor", Raw: []byte{1}, Value: &CueIdentifierDescriptor{CueStreamType: 1}}}, true},
+		{"runs past the loop", []byte{0x52, 1, 5, 0x0a, 4, 'e'}, []Descriptor{
+			{Tag: 0x52, Name: "stream_identifier_descriptor", Raw: []byte{5}, Value: &StreamIdentifierDescriptor{ComponentTag: 5}}}, true},
+	} {
+		descriptors, err := parsePMTDescriptors(test.loop, newDecoderRegistry())
+		if (err != nil) != test.fails {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		if !reflect.DeepEqual(descriptors, test.descriptors) {
+			t.Errorf("%s: %+v, expected %+v", test.name, descriptors, test.descriptors)
+		}
+	}
+}
+
+// the PMT's descriptors reach its event and the report, and a bad one is a diagnostic
+func TestPMTDescriptorsReported(t *testing.T) {
+	body := []byte{0xe1, 0x01, 0xf0, 5, 0x0e, 3, 0xc0, 0x01, 0x00,
+		0x1b, 0xe1, 0x01, 0xf0, 3, 0x52, 1, 7,
+		0x0f, 0xe1, 0x02, 0xf0, 8, 0x0a, 4, 'e', 'n', 'g', 0, 0x7c, 0}
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.section(0x100, testLongSection(0x02, 1, 0, 0, 0, body))
+	stream.padding(3)
+	demuxer, diagnostics := newTestDemuxer()
+	events := &testEvents{}
+	demuxer.AddHandler(events)
+	feedTestStream(t, demuxer, stream)
+
+	bitrate := Descriptor{Tag: 0x0e, Name: "maximum_bitrate_descriptor", Raw: []byte{0xc0, 0x01, 0x00}, Value: &MaximumBitrateDescriptor{Bitrate: 102400}}
+	video := Descriptor{Tag: 0x52, Name: "stream_identifier_descriptor", Raw: []byte{7}, Value: &StreamIdentifierDescriptor{ComponentTag: 7}}
+	audio := []Descriptor{
+		{Tag: 0x0a, Name: "ISO_639_language_descriptor", Raw: []byte{'e', 'n', 'g', 0}, Value: []ISO639Language{{"eng", 0, "undefined"}}},
+		{Tag: 0x7c, Name: "AAC_descriptor"},
+	}
+	if len(events.pmts) != 1 || len(events.pmts[0].Streams) != 2 {
+		t.Fatalf("PMT events %+v", events.pmts)
+	}
+	services := demuxer.Report().Services
+	if len(services) != 1 || len(services[0].Components) != 2 {
+		t.Fatalf("services %+v", services)
+	}
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"event program_info", events.pmts[0].Descriptors, []Descriptor{bitrate}},
+		{"event maximum bitrate", events.pmts[0].MaxBitrate, uint32(102400)},
+		{"event video", events.pmts[0].Streams[0].Descriptors, []Descriptor{video}},
+		{"event audio", events.pmts[0].Streams[1].Descriptors, audio},
+		{"report program_info", services[0].Descriptors, []Descriptor{bitrate}},
+		{"report video", services[0].Components[0].Descriptors, []Descriptor{video}},
+		{"report audio", services[0].Components[1].Descriptors, audio},
+		{"bad descriptors", diagnostics.count(DiagBadDescriptor), 1},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+}
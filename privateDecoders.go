@@ -0,0 +1,171 @@
+package tshelper
+
+// decoders for private descriptors and private tables, registered by the user of the package for
+// the things the built in parsers will never know about.
+// A descriptor decoder is keyed on descriptor tag, and optionally on the private_data_specifier
+// (EN 300 468 6.2.31, allocated in ETSI TS 101 162) in force for it - a private_data_specifier
+// _descriptor (0x5F) in a loop applies to the descriptors after it in the same loop.  One for the
+// specifier in force is used in preference to one registered for any specifier.  The PMT, SDT and
+// NIT (and BAT transport stream) descriptor loops all look for them, and a registered decoder
+// takes the place of the built in one for that tag.  The exceptions are the registration, CA and
+// maximum_bitrate descriptors, which the demux needs decoded its own way to spot SCTE-35 and the
+// CA systems and bitrate of each service, so decoders for those tags are refused.
+// A table decoder is keyed on table_id and PID, or table_id on any PID that carries sections.
+// Registering one for a PID is enough for that PID's sections to be put together.  It sees each
+// new section of a long form table (the version tracking in tableVersions.go still applies), or
+// every short form section, and the built in parsers still get theirs.
+// Decoders are called with the demux's lock held, the same as handlers, so they should be quick.
+// Each is called once for each new section, and what a descriptor decoder hands back is kept as
+// it is for every Report made after, so it shouldn't be changed once handed back
+
+import (
+	"fmt"
+)
+
+// AnyPrivateDataSpecifier registers a descriptor decoder for its tag whatever the
+// private_data_specifier, including none at all.  0 is reserved in TS 101 162 so is never sent
+const AnyPrivateDataSpecifier uint32 = 0
+
+// AnyPID registers a table decoder for its table_id on every PID that carries sections
+const AnyPID uint16 = 0xffff
+
+// DescriptorDecoder decodes the body (after the tag and length) of a private descriptor.  What it
+// hands back becomes the Descriptor's Value, an error is raised as a BadDescriptor diagnostic
+type DescriptorDecoder func(tag uint8, body []byte) (interface{}, error)
+
+// TableDecoder decodes 1 whole private section, table_id through CRC (already checked).  What it
+// hands back goes in the PrivateTableEvent, an error is raised as a BadTable diagnostic
+type TableDecoder func(pid uint16, section []byte) (interface{}, error)
+
+// PrivateTableEvent - a registered TableDecoder has been given a section
+type PrivateTableEvent struct {
+	Position
+	TableID uint8
+	Section []byte      // the whole section, table_id through CRC
+	Value   interface{} // from the decoder, nil if it failed
+}
+
+type descriptorDecoderKey struct {
+	tag       uint8
+	specifier uint32
+}
+
+type tableDecoderKey struct {
+	pid     uint16
+	tableID uint8
+}
+
+// shared (by pointer) between the tsdmx, which registers decoders, and the tableParser
+type decoderRegistry struct {
+	descriptors map[descriptorDecoderKey]DescriptorDecoder
+	tables      map[tableDecoderKey]TableDecoder
+}
+
+func newDecoderRegistry() *decoderRegistry {
+	return &decoderRegistry{
+		descriptors: make(map[descriptorDecoderKey]DescriptorDecoder),
+		tables:      make(map[tableDecoderKey]TableDecoder),
+	}
+}
+
+// the decoder for a descriptor, nil if none has been registered
+func (decoders *decoderRegistry) descriptorDecoder(tag uint8, specifier uint32) DescriptorDecoder {
+	if decoder, found := decoders.descriptors[descriptorDecoderKey{tag: tag, specifier: specifier}]; found {
+		return decoder
+	}
+	return decoders.descriptors[descriptorDecoderKey{tag: tag, specifier: AnyPrivateDataSpecifier}]
+}
+
+// the decoder for a section, nil if none has been registered
+func (decoders *decoderRegistry) tableDecoder(pid uint16, tableID uint8) TableDecoder {
+	if decoder, found := decoders.tables[tableDecoderKey{pid: pid, tableID: tableID}]; found {
+		return decoder
+	}
+	return decoders.tables[tableDecoderKey{pid: AnyPID, tableID: tableID}]
+}
+
+// the private_data_specifier in force after a descriptor, the one before it unless this is a
+// private_data_specifier_descriptor
+func privateDataSpecifierAfter(tag uint8, body []byte, specifier uint32) uint32 {
+	if tag != 0x5f || len(body) < 4 {
+		return specifier
+	}
+	return (uint32(body[0]) << 24) | (uint32(body[1]) << 16) | (uint32(body[2]) << 8) | uint32(body[3])
+}
+
+// descriptors the demux relies on its own decoding of, see pmtParser
+var builtInDescriptorTags = map[uint8]bool{0x05: true, 0x09: true, 0x0e: true}
+
+func descriptorName(tag uint8) string {
+	if name, known := pmtDescriptorNames[tag]; known {
+		return name
+	}
+	return fmt.Sprintf("descriptor 0x%02x", tag)
+}
+
+// decode a descriptor with the decoder registered for it.  found is false if there isn't one,
+// otherwise the descriptor comes back with Value set unless the decoder failed
+func (decoders *decoderRegistry) decodeDescriptor(tag uint8, specifier uint32, body []byte) (descriptor Descriptor, found bool, err error) {
+	decoder := decoders.descriptorDecoder(tag, specifier)
+	if decoder == nil {
+		return Descriptor{}, false, nil
+	}
+	descriptor = Descriptor{Tag: tag, Name: descriptorName(tag), Raw: append([]byte(nil), body...)}
+	value, err := decoder(tag, body)
+	if err != nil {
+		return descriptor, true, fmt.Errorf("%s: %v", descriptor.Name, err)
+	}
+	descriptor.Value = value
+	return descriptor, true, nil
+}
+
+// hand a section to the decoder registered for it, if there is one
+func (tables tableParser) privateTableParser(pid uint16, section []byte) {
+	decoder := tables.decoders.tableDecoder(pid, section[0])
+	if decoder == nil {
+		return
+	}
+	event := &PrivateTableEvent{Position: tables.report.position, TableID: section[0]}
+	event.Section = append([]byte(nil), section...)
+	value, err := decoder(pid, event.Section)
+	if err != nil {
+		tables.report.raise(SeverityWarning, DiagBadTable, "private table 0x%x: %v", section[0], err)
+	} else {
+		event.Value = value
+	}
+	for _, handler := range tables.report.handlers {
+		handler.OnPrivateTable(event)
+	}
+}
+
+// RegisterDescriptorDecoder sets the decoder for descriptor tag when privateDataSpecifier is in
+// force, or for any private_data_specifier with AnyPrivateDataSpecifier.  A nil decoder removes it.
+// Tags the demux decodes itself (0x05, 0x09 and 0x0E) are an error
+func (metaInfo tsdmx) RegisterDescriptorDecoder(tag uint8, privateDataSpecifier uint32, decoder DescriptorDecoder) error {
+	if builtInDescriptorTags[tag] {
+		return fmt.Errorf("%s (tag 0x%02x) is decoded by the demux itself, a decoder can't be registered for it", descriptorName(tag), tag)
+	}
+	key := descriptorDecoderKey{tag: tag, specifier: privateDataSpecifier}
+	if decoder == nil {
+		delete(metaInfo.tables.decoders.descriptors, key)
+		return nil
+	}
+	metaInfo.tables.decoders.descriptors[key] = decoder
+	return nil
+}
+
+// RegisterTableDecoder sets the decoder for table_id on pid, or on every PID carrying sections
+// with AnyPID.  A PID that isn't already known to carry sections is treated as one from now on.
+// A nil decoder removes it
+func (metaInfo tsdmx) RegisterTableDecoder(pid uint16, tableID uint8, decoder TableDecoder) {
+	key := tableDecoderKey{pid: pid, tableID: tableID}
+	if decoder == nil {
+		delete(metaInfo.tables.decoders.tables, key)
+		return
+	}
+	metaInfo.tables.decoders.tables[key] = decoder
+	if _, isTable := metaInfo.tables.tablesMap[pid]; pid != AnyPID && !isTable {
+		metaInfo.tables.tablesMap[pid] = tablesMapEntry{tabletype: privateTable}
+		metaInfo.tables.refreshElementaryStreams()
+	}
+}
@@ -0,0 +1,222 @@
+package tshelper
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// a descriptor decoder that hands back its name and the body
+func testDescriptorDecoder(name string) DescriptorDecoder {
+	return func(tag uint8, body []byte) (interface{}, error) {
+		return fmt.Sprintf("%s %x", name, body), nil
+	}
+}
+
+func failingDescriptorDecoder(tag uint8, body []byte) (interface{}, error) {
+	return nil, fmt.Errorf("can't decode")
+}
+
+// 0x88 before and after private_data_specifier 0x28 goes to a different decoder, whichever table
+// it is in, and one registered for a standard tag takes the place of the built in decoder
+func TestDescriptorDecoders(t *testing.T) {
+	loop := []byte{0x88, 1, 1, 0x5f, 4, 0, 0, 0, 0x28, 0x88, 1, 2}
+	streamLoop := []byte{0x5f, 4, 0, 0, 0, 0x28, 0x88, 1, 3}
+	pmt := append(append([]byte{0xe1, 0x01}, testLoop(loop)...), 0x1b, 0xe1, 0x01, 0xf0, 3, 0x52, 1, 7)
+	sdtService := append([]byte{0, 1, 0xfd}, testLoop(loop)...)
+	transportStream := append([]byte{0, 1, 0, 2}, testLoop(streamLoop)...)
+
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.section(0x100, testLongSection(0x02, 1, 0, 0, 0, pmt))
+	stream.section(0x11, testSDT(0x42, 1, 2, sdtService))
+	stream.section(0x10, testNIT(0, 0, loop, transportStream))
+	stream.section(0x11, testBAT(0, 0, nil, transportStream))
+	stream.padding(3)
+	demuxer, diagnostics := newTestDemuxer()
+	demuxer.RegisterDescriptorDecoder(0x88, AnyPrivateDataSpecifier, testDescriptorDecoder("any"))
+	demuxer.RegisterDescriptorDecoder(0x88, 0x28, testDescriptorDecoder("specific"))
+	demuxer.RegisterDescriptorDecoder(0x52, AnyPrivateDataSpecifier, testDescriptorDecoder("replaced"))
+	demuxer.RegisterDescriptorDecoder(0x89, AnyPrivateDataSpecifier, testDescriptorDecoder("removed"))
+	demuxer.RegisterDescriptorDecoder(0x89, AnyPrivateDataSpecifier, nil)
+	events := &testEvents{}
+	demuxer.AddHandler(events)
+	feedTestStream(t, demuxer, stream)
+	if diagnostics.count(DiagBadTable) != 0 || diagnostics.count(DiagBadDescriptor) != 0 {
+		t.Errorf("diagnostics %v", *diagnostics)
+	}
+	if len(events.pmts) != 1 || len(events.sdts) != 1 || len(events.nits) != 1 || len(events.bats) != 1 {
+		t.Fatalf("%d PMT, %d SDT, %d NIT and %d BAT events, expected 1 of each", len(events.pmts), len(events.sdts), len(events.nits), len(events.bats))
+	}
+	report := demuxer.Report()
+	if len(report.Services) != 1 || len(report.SDTs) != 1 || len(report.Networks) != 1 || len(report.Bouquets) != 1 {
+		t.Fatalf("report %+v", report)
+	}
+
+	before := Descriptor{Tag: 0x88, Name: "descriptor 0x88", Raw: []byte{1}, Value: "any 01"}
+	after := Descriptor{Tag: 0x88, Name: "descriptor 0x88", Raw: []byte{2}, Value: "specific 02"}
+	specifier := Descriptor{Tag: 0x5f, Name: "private_data_specifier_descriptor", Raw: []byte{0, 0, 0, 0x28}, Value: &PrivateDataSpecifierDescriptor{PrivateDataSpecifier: 0x28}}
+	inStream := []Descriptor{{Tag: 0x88, Name: "descriptor 0x88", Raw: []byte{3}, Value: "specific 03"}}
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"PMT program_info", events.pmts[0].Descriptors, []Descriptor{before, specifier, after}},
+		{"PMT replaced", events.pmts[0].Streams[0].Descriptors, []Descriptor{{Tag: 0x52, Name: "stream_identifier_descriptor", Raw: []byte{7}, Value: "replaced 07"}}},
+		{"SDT", events.sdts[0].Services[0].PrivateDescriptors, []Descriptor{before, after}},
+		{"NIT network_descriptors", events.nits[0].PrivateDescriptors, []Descriptor{before, after}},
+		{"NIT transport_descriptors", events.nits[0].TransportStreams[0].PrivateDescriptors, inStream},
+		{"BAT transport_descriptors", events.bats[0].TransportStreams[0].PrivateDescriptors, inStream},
+		{"report service", report.Services[0].Descriptors, []Descriptor{before, specifier, after}},
+		{"report SDT", report.SDTs[0].Services[0].PrivateDescriptors, []Descriptor{before, after}},
+		{"report network", report.Networks[0].PrivateDescriptors, []Descriptor{before, after}},
+		{"report network transport stream", report.Networks[0].TransportStreams[0].PrivateDescriptors, inStream},
+		{"report bouquet transport stream", report.Bouquets[0].TransportStreams[0].PrivateDescriptors, inStream},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+}
+
+// a decoder's error is raised against the table the descriptor is in, and the descriptor kept
+func TestDescriptorDecoderFails(t *testing.T) {
+	failing := []byte{0x89, 1, 0}
+	pmt := append(append([]byte{0xe1, 0x01}, testLoop(failing)...), 0x1b, 0xe1, 0x01, 0xf0, 0)
+	for _, test := range []struct {
+		name    string
+		pid     uint16
+		section []byte
+		code    DiagnosticCode
+	}{
+		{"PMT", 0x100, testLongSection(0x02, 1, 0, 0, 0, pmt), DiagBadDescriptor},
+		{"SDT", 0x11, testSDT(0x42, 1, 2, append([]byte{0, 1, 0xfd}, testLoop(failing)...)), DiagBadTable},
+		{"NIT network_descriptors", 0x10, testNIT(0, 0, failing, nil), DiagBadTable},
+		{"NIT transport_descriptors", 0x10, testNIT(0, 0, nil, append([]byte{0, 1, 0, 2}, testLoop(failing)...)), DiagBadTable},
+	} {
+		tables, diagnostics, events := testSectionTables()
+		tables.tablesMap[0x100] = tablesMapEntry{tabletype: pmtTable, programNumber: 1}
+		tables.decoders.descriptors[descriptorDecoderKey{tag: 0x89, specifier: AnyPrivateDataSpecifier}] = failingDescriptorDecoder
+		tables.processSection(test.pid, test.section)
+		if diagnostics.count(test.code) != 1 {
+			t.Errorf("%s: diagnostics %v", test.name, *diagnostics)
+		}
+		var kept []Descriptor
+		switch {
+		case len(events.pmts) == 1:
+			kept = events.pmts[0].Descriptors
+		case len(events.sdts) == 1 && len(events.sdts[0].Services) == 1:
+			kept = events.sdts[0].Services[0].PrivateDescriptors
+		case len(events.nits) == 1 && len(events.nits[0].TransportStreams) == 1:
+			kept = events.nits[0].TransportStreams[0].PrivateDescriptors
+		case len(events.nits) == 1:
+			kept = events.nits[0].PrivateDescriptors
+		}
+		if expected := []Descriptor{{Tag: 0x89, Name: "descriptor 0x89", Raw: []byte{0}}}; !reflect.DeepEqual(kept, expected) {
+			t.Errorf("%s: descriptors %+v, expected %+v", test.name, kept, expected)
+		}
+	}
+}
+
+// table decoders see each new long section, every short one, and the built in parsers still get theirs
+func TestTableDecoders(t *testing.T) {
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.section(0x700, testLongSection(0x90, 1, 0, 0, 0, []byte{1, 2}))
+	stream.section(0x700, testLongSection(0x90, 1, 0, 0, 0, []byte{1, 2}))
+	stream.section(0x700, []byte{0x91, 0x70, 3, 'a', 'b', 'c'})
+	stream.section(0x700, testLongSection(0x92, 1, 0, 0, 0, nil))
+	stream.section(0x700, testLongSection(0x93, 1, 0, 0, 0, nil))
+	stream.padding(3)
+	demuxer, diagnostics := newTestDemuxer()
+	length := func(pid uint16, section []byte) (interface{}, error) { return len(section), nil }
+	demuxer.RegisterTableDecoder(0, 0x00, length)
+	demuxer.RegisterTableDecoder(0x700, 0x90, length)
+	demuxer.RegisterTableDecoder(AnyPID, 0x91, length)
+	demuxer.RegisterTableDecoder(0x700, 0x92, func(pid uint16, section []byte) (interface{}, error) { return nil, fmt.Errorf("can't decode") })
+	demuxer.RegisterTableDecoder(0x700, 0x93, length)
+	demuxer.RegisterTableDecoder(0x700, 0x93, nil)
+	events := &testEvents{}
+	demuxer.AddHandler(events)
+	feedTestStream(t, demuxer, stream)
+
+	type decoded struct {
+		tableID uint8
+		value   interface{}
+	}
+	var got []decoded
+	for _, event := range events.privateTables {
+		got = append(got, decoded{event.TableID, event.Value})
+	}
+	expected := []decoded{{0x00, 20}, {0x90, 14}, {0x91, 6}, {0x92, nil}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("private tables %+v, expected %+v", got, expected)
+	}
+	if len(events.pats) != 1 || diagnostics.count(DiagBadTable) != 1 {
+		t.Errorf("%d PAT events, diagnostics %v", len(events.pats), *diagnostics)
+	}
+}
+
+// the registration, CA and maximum_bitrate descriptors can't be taken over, the demux still needs
+// them to spot SCTE-35 and the service's CA systems
+func TestDescriptorDecoderRefused(t *testing.T) {
+	dmx := Newtsdmx()
+	for _, test := range []struct {
+		tag     uint8
+		refused bool
+	}{
+		{0x05, true},
+		{0x09, true},
+		{0x0e, true},
+		{0x52, false},
+		{0x88, false},
+	} {
+		if err := dmx.RegisterDescriptorDecoder(test.tag, AnyPrivateDataSpecifier, testDescriptorDecoder("replaced")); (err != nil) != test.refused {
+			t.Errorf("tag 0x%02x: error %v", test.tag, err)
+		}
+	}
+
+	programInfo := []byte{0x05, 4, 'C', 'U', 'E', 'I', 0x09, 4, 0x01, 0x00, 0xe2, 0x00}
+	pmt := append(append([]byte{0xe1, 0x01}, testLoop(programInfo)...), 0x86, 0xe1, 0x02, 0xf0, 0)
+	dmx.tables.tablesMap[0x100] = tablesMapEntry{tabletype: pmtTable, programNumber: 1}
+	dmx.tables.processSection(0x100, testLongSection(0x02, 1, 0, 0, 0, pmt))
+	service := dmx.tables.serviceMap[1]
+	if !service.programHasSCTE35 || len(service.caSystems) != 1 || service.caSystems[0].SystemID != 0x0100 || service.caSystems[0].PID != 0x200 {
+		t.Errorf("SCTE-35 %v, CA systems %+v", service.programHasSCTE35, service.caSystems)
+	}
+}
+
+// a report has copies of the descriptor bodies and CA private data, only Value is shared
+func TestReportDescriptorsCopied(t *testing.T) {
+	programInfo := []byte{0x05, 4, 'C', 'U', 'E', 'I', 0x09, 5, 0x01, 0x00, 0xe4, 0x00, 0xaa}
+	streamInfo := []byte{0x52, 1, 7, 0x09, 5, 0x05, 0x00, 0xe4, 0x01, 0xbb}
+	pmt := append(append([]byte{0xe1, 0x01}, testLoop(programInfo)...), 0x1b, 0xe1, 0x01)
+	pmt = append(pmt, testLoop(streamInfo)...)
+	tables, _, _ := testSectionTables()
+	tables.processSection(0, testPAT())
+	tables.processSection(0x100, testLongSection(0x02, 1, 0, 0, 0, pmt))
+	for i := 0; i < 2; i++ {
+		report := &Report{}
+		tables.addToReport(report)
+		if len(report.Services) != 1 || len(report.Services[0].Components) != 1 || len(report.Services[0].CASystems) != 2 {
+			t.Fatalf("report %d: services %+v", i, report.Services)
+		}
+		service := report.Services[0]
+		for _, test := range []struct {
+			name     string
+			got      []byte
+			expected string
+		}{
+			{"registration_descriptor", service.Descriptors[0].Raw, "CUEI"},
+			{"stream_identifier_descriptor", service.Components[0].Descriptors[0].Raw, "\x07"},
+			{"program CA private data", service.CASystems[0].PrivateData, "\xaa"},
+			{"component CA private data", service.CASystems[1].PrivateData, "\xbb"},
+		} {
+			if string(test.got) != test.expected {
+				t.Errorf("report %d: %s %q, expected %q", i, test.name, test.got, test.expected)
+			}
+			test.got[0] = 'X'
+		}
+	}
+}
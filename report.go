@@ -0,0 +1,288 @@
+package tshelper
+
+// Report - a snapshot of everything found so far, as plain exported structs that marshal
+// straight to JSON.  Nothing in a Report is shared with the demux, so it can be kept,
+// changed or handed to another goroutine once made.  The one exception is the Value of each
+// Descriptor, which is what its decoder (built in or registered) made of it when the table
+// arrived.  That is handed to every Report as it is, so treat it as read only
+
+import (
+	"sort"
+)
+
+// Report is what the demux has found, PIDs, services and tables all in ascending order
+type Report struct {
+	TotalPackets  uint64               `json:"totalPackets"`
+	BytesConsumed uint64               `json:"bytesConsumed"`
+	PacketFormat  string               `json:"packetFormat"`
+	SyncEvents    []SyncEvent          `json:"syncEvents"`
+	PIDs          []PIDReport          `json:"pids"`
+	Services      []ServiceReport      `json:"services"`
+	Tables        []TableReport        `json:"tables"`
+	TableVersions []TableVersionReport `json:"tableVersions"`
+	CRCErrors     []CRCErrorCount      `json:"crcErrors"`
+	SpliceCues    []SpliceCueReport    `json:"spliceCues"` // see spliceTimeline.go
+	Networks      []NetworkReport      `json:"networks"`
+	SDTs          []SDTReport          `json:"sdts"`            // actual and other, see sdtParse.go
+	Bouquets      []BouquetReport      `json:"bouquets"`        // see batParse.go
+	Clock         *ClockReport         `json:"clock,omitempty"` // only once a TDT / TOT is seen
+	CASystems     []CASystemReport     `json:"caSystems"`       // see caParse.go
+}
+
+// PIDReport is what has been seen on 1 PID
+type PIDReport struct {
+	PID                  uint16           `json:"pid"`
+	Packets              uint64           `json:"packets"`
+	ContinuityErrors     uint64           `json:"continuityErrors"`
+	Bitrate              uint64           `json:"bitrate"`                        // bits/s over the last bitrate slice
+	LastArrivalTimestamp uint32           `json:"lastArrivalTimestamp,omitempty"` // M2TS only, 27MHz
+	Timestamps           *TimestampReport `json:"timestamps,omitempty"`           // only for PIDs carrying PES with timestamps
+}
+
+// TimestampReport is the PTS / DTS tracking for 1 PID, all times in 90kHz ticks.  DTS values are
+// decode times, so the PTS for streams that don't send a DTS
+type TimestampReport struct {
+	FirstPTS          uint64 `json:"firstPts"`
+	LastPTS           uint64 `json:"lastPts"`
+	FirstDTS          uint64 `json:"firstDts"`
+	LastDTS           uint64 `json:"lastDts"`
+	PTSWraps          uint64 `json:"ptsWraps"`
+	PTSJumps          uint64 `json:"ptsJumps"`
+	NonMonotonicDTS   uint64 `json:"nonMonotonicDts"`
+	MissingTimestamps uint64 `json:"missingTimestamps"`
+}
+
+// ServiceReport is 1 service (program) built up from the PAT, PMT, SDT and EIT
+type ServiceReport struct {
+	ProgramNumber uint16            `json:"programNumber"`
+	Name          string            `json:"name"`
+	PCRPID        uint16            `json:"pcrPid"`
+	HasSCTE35     bool              `json:"hasScte35"`
+	MaxBitrate    uint32            `json:"maxBitrate,omitempty"`
+	Components    []ComponentReport `json:"components"`
+	Present       *EPGEvent         `json:"present,omitempty"` // from the EIT, see eitParse.go
+	Following     *EPGEvent         `json:"following,omitempty"`
+	Schedule      []EPGEvent        `json:"schedule,omitempty"`    // in start time order
+	CASystems     []ServiceCASystem `json:"caSystems,omitempty"`   // from the PMT, see caParse.go
+	Descriptors   []Descriptor      `json:"descriptors,omitempty"` // program_info loop, see pmtDescriptors.go
+}
+
+// ComponentReport is 1 elementary stream of a service
+type ComponentReport struct {
+	PID            uint16       `json:"pid"`
+	StreamType     uint8        `json:"streamType"`
+	StreamTypeName string       `json:"streamTypeName,omitempty"`
+	CueDescriptor  bool         `json:"cueDescriptor"`
+	Descriptors    []Descriptor `json:"descriptors,omitempty"` // see pmtDescriptors.go
+}
+
+// TableReport is 1 PID known to carry tables
+type TableReport struct {
+	PID           uint16 `json:"pid"`
+	Type          string `json:"type"`
+	ProgramNumber uint16 `json:"programNumber"`
+	LatestVersion uint8  `json:"latestVersion"`
+	VersionsSeen  uint64 `json:"versionsSeen"`
+	TablesSeen    uint64 `json:"tablesSeen"` // whole tables, repeats included
+}
+
+// TableVersionReport is the current version of 1 table (table_id + extension on 1 PID), with how
+// many of its sections have arrived.  Complete is only set once every section is in
+type TableVersionReport struct {
+	PID               uint16 `json:"pid"`
+	TableID           uint8  `json:"tableId"`
+	TableIDExtension  uint16 `json:"tableIdExtension"`
+	TransportStreamID uint16 `json:"transportStreamId,omitempty"` // EIT only
+	OriginalNetworkID uint16 `json:"originalNetworkId,omitempty"` // SDT and EIT only
+	Version           uint8  `json:"version"`
+	LastSectionNumber uint8  `json:"lastSectionNumber"`
+	SectionsSeen      int    `json:"sectionsSeen"`
+	Complete          bool   `json:"complete"`
+	Repeats           uint64 `json:"repeats"`
+}
+
+// NetworkReport is the current version of the NIT for 1 network, all its sections put together
+type NetworkReport struct {
+	NetworkID          uint16               `json:"networkId"`
+	Actual             bool                 `json:"actual"` // the network this stream is part of
+	Name               string               `json:"name"`
+	Version            uint8                `json:"version"`
+	Complete           bool                 `json:"complete"`
+	TransportStreams   []NITTransportStream `json:"transportStreams"`
+	PrivateDescriptors []Descriptor         `json:"privateDescriptors,omitempty"` // network_descriptors decoded by a registered DescriptorDecoder
+}
+
+// CRCErrorCount is how many sections with 1 table_id on 1 PID have been dropped for a bad CRC
+type CRCErrorCount struct {
+	PID     uint16 `json:"pid"`
+	TableID uint8  `json:"tableId"`
+	Count   uint64 `json:"count"`
+}
+
+// Report takes a snapshot of what has been found so far
+func (metaInfo tsdmx) Report() *Report {
+	report := &Report{
+		TotalPackets:  metaInfo.globalStats.totalPackets,
+		BytesConsumed: metaInfo.globalStats.bytesConsumed,
+		PacketFormat:  metaInfo.sync.format.String(),
+		SyncEvents:    metaInfo.SyncEvents(),
+		PIDs:          make([]PIDReport, 0, len(metaInfo.pidStats)),
+	}
+	for pid, info := range metaInfo.pidStats {
+		pidReport := PIDReport{
+			PID:                  pid,
+			Packets:              info.packetCount,
+			ContinuityErrors:     info.contCountErrors,
+			Bitrate:              info.bitrate,
+			LastArrivalTimestamp: info.lastArrivalTimestamp,
+		}
+		if info.haveTimestamps || info.missingTimestamps != 0 {
+			pidReport.Timestamps = &TimestampReport{
+				FirstPTS:          info.firstPTS,
+				LastPTS:           info.lastPTS,
+				FirstDTS:          info.firstDTS,
+				LastDTS:           info.lastDTS,
+				PTSWraps:          info.ptsWraps,
+				PTSJumps:          info.ptsJumps,
+				NonMonotonicDTS:   info.dtsNonMonotonic,
+				MissingTimestamps: info.missingTimestamps,
+			}
+		}
+		report.PIDs = append(report.PIDs, pidReport)
+	}
+	sort.Slice(report.PIDs, func(i, j int) bool { return report.PIDs[i].PID < report.PIDs[j].PID })
+
+	metaInfo.tables.addToReport(report)
+	metaInfo.tables.timeline.addToReport(report)
+	metaInfo.tables.clock.addToReport(report)
+	return report
+}
+
+// fill in the service and table parts of a report
+func (tables tableParser) addToReport(report *Report) {
+	report.Services = make([]ServiceReport, 0, len(tables.serviceMap))
+	for _, service := range tables.serviceMap {
+		serviceReport := ServiceReport{
+			ProgramNumber: service.programNumber,
+			Name:          service.serviceName,
+			PCRPID:        service.pcrPID,
+			HasSCTE35:     service.programHasSCTE35,
+			MaxBitrate:    service.definedMaxBitrate,
+			Components:    make([]ComponentReport, 0, len(service.streamComps)),
+			Schedule:      service.scheduleByTime(),
+			CASystems:     service.serviceCASystems(),
+			Descriptors:   copyDescriptors(service.descriptors),
+		}
+		if service.presentEvent != nil {
+			present := service.presentEvent.clone()
+			serviceReport.Present = &present
+		}
+		if service.followingEvent != nil {
+			following := service.followingEvent.clone()
+			serviceReport.Following = &following
+		}
+		for _, comp := range service.streamComps {
+			serviceReport.Components = append(serviceReport.Components, ComponentReport{
+				PID:            comp.streamPID,
+				StreamType:     comp.streamType,
+				StreamTypeName: streamTypeStringMapping[comp.streamType],
+				CueDescriptor:  comp.cueDescriptor,
+				Descriptors:    copyDescriptors(comp.descriptors),
+			})
+		}
+		report.Services = append(report.Services, serviceReport)
+	}
+	sort.Slice(report.Services, func(i, j int) bool { return report.Services[i].ProgramNumber < report.Services[j].ProgramNumber })
+
+	report.Tables = make([]TableReport, 0, len(tables.tablesMap))
+	for pid, entry := range tables.tablesMap {
+		report.Tables = append(report.Tables, TableReport{
+			PID:           pid,
+			Type:          entry.tabletype.String(),
+			ProgramNumber: entry.programNumber,
+			LatestVersion: entry.latestVersion,
+			VersionsSeen:  entry.versionsSeen,
+			TablesSeen:    entry.numberTablesSeen,
+		})
+	}
+	sort.Slice(report.Tables, func(i, j int) bool { return report.Tables[i].PID < report.Tables[j].PID })
+
+	report.TableVersions = make([]TableVersionReport, 0, len(tables.versions))
+	for key, state := range tables.versions {
+		versionReport := TableVersionReport{
+			PID:               key.pid,
+			TableID:           key.tableID,
+			TableIDExtension:  key.tableIDExtension,
+			TransportStreamID: key.transportStreamID,
+			OriginalNetworkID: key.originalNetworkID,
+			Version:           state.version,
+			LastSectionNumber: state.lastSectionNumber,
+			Complete:          state.complete,
+			Repeats:           state.repeats,
+		}
+		for _, section := range state.sections {
+			if section != nil {
+				versionReport.SectionsSeen += 1
+			}
+		}
+		report.TableVersions = append(report.TableVersions, versionReport)
+	}
+	sort.Slice(report.TableVersions, func(i, j int) bool {
+		a, b := report.TableVersions[i], report.TableVersions[j]
+		if a.PID != b.PID {
+			return a.PID < b.PID
+		}
+		if a.TableID != b.TableID {
+			return a.TableID < b.TableID
+		}
+		if a.TableIDExtension != b.TableIDExtension {
+			return a.TableIDExtension < b.TableIDExtension
+		}
+		if a.OriginalNetworkID != b.OriginalNetworkID {
+			return a.OriginalNetworkID < b.OriginalNetworkID
+		}
+		return a.TransportStreamID < b.TransportStreamID
+	})
+
+	report.Networks = make([]NetworkReport, 0)
+	for key, state := range tables.versions {
+		if key.tableID != uint8(nitSectionActualNetwork) && key.tableID != uint8(nitSectionOtherNetwork) {
+			continue
+		}
+		network := NetworkReport{NetworkID: key.tableIDExtension, Actual: key.tableID == uint8(nitSectionActualNetwork), Version: state.version, Complete: state.complete}
+		network.TransportStreams = make([]NITTransportStream, 0)
+		for _, decoded := range state.decoded {
+			nit, isNIT := decoded.(*NITEvent)
+			if !isNIT {
+				continue
+			}
+			if nit.NetworkName != "" {
+				network.Name = nit.NetworkName
+			}
+			network.PrivateDescriptors = append(network.PrivateDescriptors, copyDescriptors(nit.PrivateDescriptors)...)
+			network.TransportStreams = append(network.TransportStreams, copyTransportStreams(nit.TransportStreams)...)
+		}
+		report.Networks = append(report.Networks, network)
+	}
+	sort.Slice(report.Networks, func(i, j int) bool {
+		if report.Networks[i].Actual != report.Networks[j].Actual {
+			return report.Networks[i].Actual
+		}
+		return report.Networks[i].NetworkID < report.Networks[j].NetworkID
+	})
+
+	tables.addSDTToReport(report)
+	tables.addBATToReport(report)
+	tables.addCAToReport(report)
+
+	report.CRCErrors = make([]CRCErrorCount, 0, len(tables.crcErrors))
+	for key, count := range tables.crcErrors {
+		report.CRCErrors = append(report.CRCErrors, CRCErrorCount{PID: key.pid, TableID: key.tableID, Count: count})
+	}
+	sort.Slice(report.CRCErrors, func(i, j int) bool {
+		if report.CRCErrors[i].PID != report.CRCErrors[j].PID {
+			return report.CRCErrors[i].PID < report.CRCErrors[j].PID
+		}
+		return report.CRCErrors[i].TableID < report.CRCErrors[j].TableID
+	})
+}
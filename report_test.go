@@ -0,0 +1,71 @@
+package tshelper
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	name := "Channel"
+	service := append([]byte{0x48, uint8(3 + len(name)), 1, 0, uint8(len(name))}, name...)
+	sdt := testLongSection(0x42, 1, 0, 0, 0, append([]byte{0, 2, 0xff, 0, 1, 0xfc, 0xf0, uint8(len(service))}, service...))
+
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.section(0x100, testPMT(0, 0x1b, 0x101, 0x0f, 0x102))
+	stream.section(0x11, sdt)
+	stream.padding(2)
+	demuxer, _ := newTestDemuxer()
+	feedTestStream(t, demuxer, stream)
+	report := demuxer.Report()
+
+	var pmt TableReport
+	for _, table := range report.Tables {
+		if table.PID == 0x100 {
+			pmt = table
+		}
+	}
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"packets", report.TotalPackets, uint64(5)},
+		{"bytes", report.BytesConsumed, uint64(5 * tsPacketSize)},
+		{"packet format", report.PacketFormat, "TS188"},
+		{"PIDs", len(report.PIDs), 4},
+		{"null packets", report.PIDs[3], PIDReport{PID: 0x1fff, Packets: 2}},
+		{"services", report.Services, []ServiceReport{{
+			ProgramNumber: 1,
+			Name:          name,
+			PCRPID:        0x101,
+			Components: []ComponentReport{
+				{PID: 0x101, StreamType: 0x1b, StreamTypeName: streamTypeStringMapping[0x1b]},
+				{PID: 0x102, StreamType: 0x0f, StreamTypeName: streamTypeStringMapping[0x0f]},
+			},
+		}}},
+		{"PMT table", pmt, TableReport{PID: 0x100, Type: "pmtTable", ProgramNumber: 1, VersionsSeen: 1, TablesSeen: 1}},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+
+	// a report is a copy, changing it changes nothing in the next
+	report.Services[0].Components[0].PID = 0
+	if again := demuxer.Report(); again.Services[0].Components[0].PID != 0x101 {
+		t.Errorf("report shares its components")
+	}
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	for _, key := range []string{`"totalPackets":5`, `"programNumber":1`, `"pcrPid":257`, `"streamType":27`} {
+		if !strings.Contains(string(encoded), key) {
+			t.Errorf("%s not in %s", key, encoded)
+		}
+	}
+}
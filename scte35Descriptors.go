@@ -0,0 +1,355 @@
+package tshelper
+
+// SCTE-35 splice descriptors (SCTE 35 2022 section 10)
+// Each splice descriptor starts with a 32 bit identifier, "CUEI" for the ones SCTE-35 defines.
+// Descriptors with any other identifier are private and left as bytes.  The segmentation_descriptor
+// is the one that matters for ad decisioning, it says what kind of segment starts or ends (break,
+// placement opportunity, program...) and carries a UPID naming the content or the opportunity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// identifier of the descriptors SCTE-35 itself defines
+const cueIdentifier = 0x43554549 // "CUEI"
+
+// SpliceDescriptor is 1 entry in the splice descriptor loop.  At most 1 of the decoded forms is
+// set, and only when Identifier is "CUEI".  Private is whatever followed the identifier
+type SpliceDescriptor struct {
+	Tag          uint8
+	Identifier   uint32
+	Private      []byte
+	Avail        *AvailDescriptor
+	DTMF         *DTMFDescriptor
+	Segmentation *SegmentationDescriptor
+	Time         *TimeDescriptor
+}
+
+// AvailDescriptor is avail_descriptor, tag 0x00
+type AvailDescriptor struct {
+	ProviderAvailID uint32
+}
+
+// DTMFDescriptor is DTMF_descriptor, tag 0x01
+type DTMFDescriptor struct {
+	Preroll uint8  // tenths of a second before the splice to send the tones
+	Chars   string // the DTMF characters to send
+}
+
+// TimeDescriptor is time_descriptor, tag 0x03.  TAI time, and the UTC offset to go with it
+type TimeDescriptor struct {
+	TAISeconds     uint64
+	TAINanoseconds uint32
+	UTCOffset      uint16
+}
+
+// SegmentationComponent is 1 component of a component mode segmentation_descriptor
+type SegmentationComponent struct {
+	ComponentTag uint8
+	PTSOffset    uint64
+}
+
+// SegmentationDescriptor is segmentation_descriptor, tag 0x02.  When CancelIndicator is set only
+// the event id is sent.  The delivery restriction flags are only meaningful when
+// DeliveryNotRestricted is clear
+type SegmentationDescriptor struct {
+	EventID               uint32
+	CancelIndicator       bool
+	EventIDCompliance     bool
+	ProgramSegmentation   bool
+	DeliveryNotRestricted bool
+	WebDeliveryAllowed    bool
+	NoRegionalBlackout    bool
+	ArchiveAllowed        bool
+	DeviceRestrictions    uint8
+	Components            []SegmentationComponent
+	HasDuration           bool
+	Duration              uint64 // 90kHz
+	UPID                  SegmentationUPID
+	TypeID                uint8
+	TypeName              string
+	SegmentNum            uint8
+	SegmentsExpected      uint8
+	HasSubSegments        bool
+	SubSegmentNum         uint8
+	SubSegmentsExpected   uint8
+}
+
+// SegmentationUPID is segmentation_upid().  Value is the UPID in its usual written form, text for
+// the character based types, hex for the binary ones.  MID (type 0x0d) holds other UPIDs in
+// Parts instead.  MPU (0x0c) has its format_identifier split out
+type SegmentationUPID struct {
+	Type             uint8
+	TypeName         string
+	Raw              []byte
+	Value            string
+	FormatIdentifier uint32
+	Parts            []SegmentationUPID
+}
+
+var segmentationUPIDTypeNames = map[uint8]string{
+	0x00: "Not Used",
+	0x01: "User Defined",
+	0x02: "ISCI",
+	0x03: "Ad-ID",
+	0x04: "UMID",
+	0x05: "ISAN (deprecated)",
+	0x06: "ISAN",
+	0x07: "TID",
+	0x08: "TI",
+	0x09: "ADI",
+	0x0a: "EIDR",
+	0x0b: "ATSC Content Identifier",
+	0x0c: "MPU",
+	0x0d: "MID",
+	0x0e: "ADS Information",
+	0x0f: "URI",
+	0x10: "UUID",
+	0x11: "SCR",
+}
+
+// fixed UPID lengths, types not listed are variable
+var segmentationUPIDLengths = map[uint8]int{
+	0x00: 0, 0x02: 8, 0x03: 12, 0x04: 32, 0x05: 8, 0x06: 12, 0x07: 12, 0x08: 8, 0x0a: 12, 0x10: 16,
+}
+
+var segmentationTypeNames = map[uint8]string{
+	0x00: "Not Indicated",
+	0x01: "Content Identification",
+	0x10: "Program Start",
+	0x11: "Program End",
+	0x12: "Program Early Termination",
+	0x13: "Program Breakaway",
+	0x14: "Program Resumption",
+	0x15: "Program Runover Planned",
+	0x16: "Program Runover Unplanned",
+	0x17: "Program Overlap Start",
+	0x18: "Program Blackout Override",
+	0x19: "Program Join",
+	0x20: "Chapter Start",
+	0x21: "Chapter End",
+	0x22: "Break Start",
+	0x23: "Break End",
+	0x24: "Opening Credit Start",
+	0x25: "Opening Credit End",
+	0x26: "Closing Credit Start",
+	0x27: "Closing Credit End",
+	0x30: "Provider Advertisement Start",
+	0x31: "Provider Advertisement End",
+	0x32: "Distributor Advertisement Start",
+	0x33: "Distributor Advertisement End",
+	0x34: "Provider Placement Opportunity Start",
+	0x35: "Provider Placement Opportunity End",
+	0x36: "Distributor Placement Opportunity Start",
+	0x37: "Distributor Placement Opportunity End",
+	0x38: "Provider Overlay Placement Opportunity Start",
+	0x39: "Provider Overlay Placement Opportunity End",
+	0x3a: "Distributor Overlay Placement Opportunity Start",
+	0x3b: "Distributor Overlay Placement Opportunity End",
+	0x3c: "Provider Promo Start",
+	0x3d: "Provider Promo End",
+	0x3e: "Distributor Promo Start",
+	0x3f: "Distributor Promo End",
+	0x40: "Unscheduled Event Start",
+	0x41: "Unscheduled Event End",
+	0x42: "Alternate Content Opportunity Start",
+	0x43: "Alternate Content Opportunity End",
+	0x44: "Provider Ad Block Start",
+	0x45: "Provider Ad Block End",
+	0x46: "Distributor Ad Block Start",
+	0x47: "Distributor Ad Block End",
+	0x50: "Network Start",
+	0x51: "Network End",
+}
+
+// segmentation types that go on to give sub_segment_num and sub_segments_expected
+func segmentationHasSubSegments(typeID uint8) bool {
+	return typeID == 0x34 || typeID == 0x36 || typeID == 0x38 || typeID == 0x3a
+}
+
+// decode the whole splice descriptor loop, stopping at the first descriptor that doesn't make sense
+func parseSpliceDescriptors(loop []byte) ([]SpliceDescriptor, error) {
+	var descriptors []SpliceDescriptor
+	for rd := 0; rd < len(loop); {
+		if rd+2 > len(loop) || rd+2+int(loop[rd+1]) > len(loop) {
+			return descriptors, fmt.Errorf("splice descriptor 0x%02x runs past the end of the descriptor loop", loop[rd])
+		}
+		tag := loop[rd]
+		body := loop[rd+2 : rd+2+int(loop[rd+1])]
+		rd += 2 + len(body)
+		if len(body) < 4 {
+			return descriptors, fmt.Errorf("splice descriptor 0x%02x is too short for its identifier", tag)
+		}
+
+		descriptor := SpliceDescriptor{Tag: tag}
+		reader := &spliceReader{data: body}
+		descriptor.Identifier = reader.u32()
+		descriptor.Private = append([]byte(nil), body[4:]...)
+		if descriptor.Identifier == cueIdentifier {
+			switch tag {
+			case 0x00:
+				descriptor.Avail = &AvailDescriptor{ProviderAvailID: reader.u32()}
+			case 0x01:
+				descriptor.DTMF = reader.dtmfDescriptor()
+			case 0x02:
+				descriptor.Segmentation = reader.segmentationDescriptor()
+			case 0x03:
+				descriptor.Time = reader.timeDescriptor()
+			}
+			if reader.err != nil {
+				return descriptors, fmt.Errorf("splice descriptor 0x%02x: %v", tag, reader.err)
+			}
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors, nil
+}
+
+func (reader *spliceReader) dtmfDescriptor() *DTMFDescriptor {
+	dtmf := &DTMFDescriptor{Preroll: reader.u8()}
+	count := int(reader.u8() >> 5)
+	dtmf.Chars = string(reader.bytes(count))
+	return dtmf
+}
+
+func (reader *spliceReader) timeDescriptor() *TimeDescriptor {
+	seconds := reader.bytes(6)
+	descriptor := new(TimeDescriptor)
+	for _, b := range seconds {
+		descriptor.TAISeconds = (descriptor.TAISeconds << 8) | uint64(b)
+	}
+	descriptor.TAINanoseconds = reader.u32()
+	descriptor.UTCOffset = reader.u16()
+	return descriptor
+}
+
+func (reader *spliceReader) segmentationDescriptor() *SegmentationDescriptor {
+	segmentation := &SegmentationDescriptor{EventID: reader.u32()}
+	flags := reader.u8()
+	segmentation.CancelIndicator = flags&0x80 != 0
+	segmentation.EventIDCompliance = flags&0x40 != 0
+	if segmentation.CancelIndicator {
+		return segmentation
+	}
+
+	flags = reader.u8()
+	segmentation.ProgramSegmentation = flags&0x80 != 0
+	segmentation.HasDuration = flags&0x40 != 0
+	segmentation.DeliveryNotRestricted = flags&0x20 != 0
+	if !segmentation.DeliveryNotRestricted {
+		segmentation.WebDeliveryAllowed = flags&0x10 != 0
+		segmentation.NoRegionalBlackout = flags&0x08 != 0
+		segmentation.ArchiveAllowed = flags&0x04 != 0
+		segmentation.DeviceRestrictions = flags & 0x03
+	}
+	if !segmentation.ProgramSegmentation {
+		componentCount := int(reader.u8())
+		for i := 0; i < componentCount && reader.err == nil; i++ {
+			tag := reader.u8()
+			_, offset := reader.u33()
+			segmentation.Components = append(segmentation.Components, SegmentationComponent{ComponentTag: tag, PTSOffset: offset})
+		}
+	}
+	if segmentation.HasDuration {
+		duration := reader.bytes(5)
+		for _, b := range duration {
+			segmentation.Duration = (segmentation.Duration << 8) | uint64(b)
+		}
+	}
+
+	upidType := reader.u8()
+	upidLength := int(reader.u8())
+	segmentation.UPID = decodeSegmentationUPID(upidType, reader.bytes(upidLength))
+	segmentation.TypeID = reader.u8()
+	segmentation.TypeName = segmentationTypeNames[segmentation.TypeID]
+	segmentation.SegmentNum = reader.u8()
+	segmentation.SegmentsExpected = reader.u8()
+	// sub segments came in with the 2016 edition, earlier streams stop here
+	if segmentationHasSubSegments(segmentation.TypeID) && reader.rd+2 <= len(reader.data) {
+		segmentation.HasSubSegments = true
+		segmentation.SubSegmentNum = reader.u8()
+		segmentation.SubSegmentsExpected = reader.u8()
+	}
+	return segmentation
+}
+
+// put a UPID into the form people write it in
+func decodeSegmentationUPID(upidType uint8, data []byte) SegmentationUPID {
+	upid := SegmentationUPID{Type: upidType, TypeName: segmentationUPIDTypeNames[upidType], Raw: append([]byte(nil), data...)}
+	if fixed, isFixed := segmentationUPIDLengths[upidType]; isFixed && fixed != len(data) {
+		upid.Value = fmt.Sprintf("%X", data) // wrong length, hex is all that can be trusted
+		return upid
+	}
+	switch upidType {
+	case 0x02, 0x03, 0x07, 0x09, 0x0e, 0x0f, 0x11:
+		upid.Value = string(data)
+	case 0x05, 0x06:
+		upid.Value = formatISAN(data)
+	case 0x0a:
+		upid.Value = formatEIDR(data)
+	case 0x0b:
+		upid.Value = formatATSCContentID(data)
+	case 0x0c:
+		if len(data) >= 4 {
+			upid.FormatIdentifier = (uint32(data[0]) << 24) | (uint32(data[1]) << 16) | (uint32(data[2]) << 8) | uint32(data[3])
+			upid.Value = fmt.Sprintf("%X", data[4:])
+		}
+	case 0x0d:
+		for rd := 0; rd+2 <= len(data) && rd+2+int(data[rd+1]) <= len(data); rd += 2 + int(data[rd+1]) {
+			upid.Parts = append(upid.Parts, decodeSegmentationUPID(data[rd], data[rd+2:rd+2+int(data[rd+1])]))
+		}
+	case 0x10:
+		upid.Value = fmt.Sprintf("%X-%X-%X-%X-%X", data[0:4], data[4:6], data[6:8], data[8:10], data[10:16])
+	default:
+		upid.Value = fmt.Sprintf("%X", data)
+	}
+	return upid
+}
+
+// ISAN is written as groups of 4 hex digits, 8 bytes for the root and episode, 12 with the version
+func formatISAN(data []byte) string {
+	groups := make([]string, 0, len(data)/2)
+	for i := 0; i+2 <= len(data); i += 2 {
+		groups = append(groups, fmt.Sprintf("%02X%02X", data[i], data[i+1]))
+	}
+	return strings.Join(groups, "-")
+}
+
+// EIDR is sent as the 16 bit DOI sub prefix then the 80 bit suffix, and written as
+// 10.<prefix>/XXXX-XXXX-XXXX-XXXX-XXXX-C where C is the ISO 7064 Mod 37,36 check character
+func formatEIDR(data []byte) string {
+	prefix := (int(data[0]) << 8) | int(data[1])
+	suffix := fmt.Sprintf("%X", data[2:])
+	groups := make([]string, 0, 6)
+	for i := 0; i < len(suffix); i += 4 {
+		groups = append(groups, suffix[i:i+4])
+	}
+	groups = append(groups, string(mod3736CheckChar(suffix)))
+	return fmt.Sprintf("10.%d/%s", prefix, strings.Join(groups, "-"))
+}
+
+const mod3736Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+func mod3736CheckChar(text string) byte {
+	product := 36
+	for _, char := range text {
+		sum := (product + strings.IndexRune(mod3736Alphabet, char)) % 36
+		if sum == 0 {
+			sum = 36
+		}
+		product = (sum * 2) % 37
+	}
+	return mod3736Alphabet[(37-product)%36]
+}
+
+// ATSC A/57B content_identifier: TSID, end_of_day and unique_for then the content id itself
+func formatATSCContentID(data []byte) string {
+	if len(data) < 4 {
+		return fmt.Sprintf("%X", data)
+	}
+	tsid := (int(data[0]) << 8) | int(data[1])
+	endOfDay := (data[2] >> 1) & 0x1f
+	uniqueFor := ((int(data[2]) & 0x1) << 8) | int(data[3])
+	return fmt.Sprintf("TSID %d end_of_day %d unique_for %d content_id %q", tsid, endOfDay, uniqueFor, data[4:])
+}
@@ -0,0 +1,335 @@
+package tshelper
+
+// SCTE-35 splice_info_section encoding, the reverse of scte35Parse.go and scte35Descriptors.go
+// Times are written from PTSTime, which is the value before pts_adjustment, so a section decoded
+// here encodes back to the same bytes.  Reserved bits are written as 1s, as the spec asks
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// writes splice_info_section fields in order, the reverse of spliceReader
+type spliceWriter struct {
+	data []byte
+}
+
+func (writer *spliceWriter) u8(value uint8) {
+	writer.data = append(writer.data, value)
+}
+
+func (writer *spliceWriter) u16(value uint16) {
+	writer.data = append(writer.data, byte(value>>8), byte(value))
+}
+
+func (writer *spliceWriter) u32(value uint32) {
+	writer.data = append(writer.data, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+// 33 bit value in the bottom of 5 bytes, with top7 in the bits above it
+func (writer *spliceWriter) u33(top7 uint8, value uint64) {
+	writer.data = append(writer.data, top7<<1|byte(value>>32)&0x1, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+func boolBit(value bool, bit uint8) uint8 {
+	if value {
+		return bit
+	}
+	return 0
+}
+
+func (writer *spliceWriter) spliceTime(spliceTime *SpliceTime) {
+	if spliceTime == nil || !spliceTime.Specified {
+		writer.u8(0x7f)
+		return
+	}
+	writer.u33(0x7f, spliceTime.PTSTime)
+}
+
+func (writer *spliceWriter) breakDuration(duration *BreakDuration) {
+	writer.u33(boolBit(duration.AutoReturn, 0x40)|0x3f, duration.Duration)
+}
+
+func (writer *spliceWriter) spliceInsert(insert *SpliceInsert) {
+	writer.u32(insert.SpliceEventID)
+	writer.u8(boolBit(insert.CancelIndicator, 0x80) | 0x7f)
+	if insert.CancelIndicator {
+		return
+	}
+	writer.u8(boolBit(insert.OutOfNetwork, 0x80) | boolBit(insert.ProgramSplice, 0x40) | boolBit(insert.BreakDuration != nil, 0x20) |
+		boolBit(insert.SpliceImmediate, 0x10) | 0x0f)
+	if insert.ProgramSplice && !insert.SpliceImmediate {
+		writer.spliceTime(insert.Time)
+	}
+	if !insert.ProgramSplice {
+		writer.u8(uint8(len(insert.Components)))
+		for _, component := range insert.Components {
+			writer.u8(component.ComponentTag)
+			if !insert.SpliceImmediate {
+				writer.spliceTime(component.Time)
+			}
+		}
+	}
+	if insert.BreakDuration != nil {
+		writer.breakDuration(insert.BreakDuration)
+	}
+	writer.u16(insert.UniqueProgramID)
+	writer.u8(insert.AvailNum)
+	writer.u8(insert.AvailsExpected)
+}
+
+func (writer *spliceWriter) spliceSchedule(schedule *SpliceSchedule) {
+	writer.u8(uint8(len(schedule.Splices)))
+	for _, splice := range schedule.Splices {
+		writer.u32(splice.SpliceEventID)
+		writer.u8(boolBit(splice.CancelIndicator, 0x80) | 0x7f)
+		if splice.CancelIndicator {
+			continue
+		}
+		writer.u8(boolBit(splice.OutOfNetwork, 0x80) | boolBit(splice.ProgramSplice, 0x40) | boolBit(splice.BreakDuration != nil, 0x20) | 0x1f)
+		if splice.ProgramSplice {
+			writer.u32(splice.UTCSpliceTime)
+		} else {
+			writer.u8(uint8(len(splice.Components)))
+			for _, component := range splice.Components {
+				writer.u8(component.ComponentTag)
+				writer.u32(component.UTCSpliceTime)
+			}
+		}
+		if splice.BreakDuration != nil {
+			writer.breakDuration(splice.BreakDuration)
+		}
+		writer.u16(splice.UniqueProgramID)
+		writer.u8(splice.AvailNum)
+		writer.u8(splice.AvailsExpected)
+	}
+}
+
+// the bytes of a UPID.  Raw if it's there, otherwise MIDs are built from their parts and
+// everything else from Value, read back from the form decodeSegmentationUPID writes it in.  A
+// Value that isn't in that form, or is the wrong length for the type, is an error
+func encodeSegmentationUPID(upid SegmentationUPID) ([]byte, error) {
+	if upid.Raw != nil {
+		return upid.Raw, nil
+	}
+	var data []byte
+	var err error
+	switch upid.Type {
+	case 0x00:
+	case 0x02, 0x03, 0x07, 0x09, 0x0e, 0x0f, 0x11:
+		data = []byte(upid.Value)
+	case 0x05, 0x06, 0x10:
+		data, err = hex.DecodeString(strings.Replace(upid.Value, "-", "", -1))
+	case 0x0a:
+		data, err = parseEIDR(upid.Value)
+	case 0x0b:
+		data, err = parseATSCContentID(upid.Value)
+	case 0x0c:
+		data, err = hex.DecodeString(upid.Value)
+		data = append([]byte{uint8(upid.FormatIdentifier >> 24), uint8(upid.FormatIdentifier >> 16), uint8(upid.FormatIdentifier >> 8), uint8(upid.FormatIdentifier)}, data...)
+	case 0x0d:
+		for _, part := range upid.Parts {
+			partData, err := encodeSegmentationUPID(part)
+			if err != nil {
+				return nil, fmt.Errorf("MID: %v", err)
+			}
+			if len(partData) > 255 {
+				return nil, fmt.Errorf("MID: %s UPID of %d bytes is too long", part.TypeName, len(partData))
+			}
+			data = append(data, part.Type, byte(len(partData)))
+			data = append(data, partData...)
+		}
+	default:
+		data, err = hex.DecodeString(upid.Value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("segmentation UPID type 0x%02x %q: %v", upid.Type, upid.Value, err)
+	}
+	if fixed, isFixed := segmentationUPIDLengths[upid.Type]; isFixed && fixed != len(data) {
+		return nil, fmt.Errorf("segmentation UPID type 0x%02x %q is %d bytes, needs %d", upid.Type, upid.Value, len(data), fixed)
+	}
+	return data, nil
+}
+
+// EIDR back from 10.<prefix>/XXXX-XXXX-XXXX-XXXX-XXXX-C, checking the check character
+func parseEIDR(text string) ([]byte, error) {
+	slash := strings.Index(text, "/")
+	if !strings.HasPrefix(text, "10.") || slash < 0 {
+		return nil, errors.New("not of the form 10.<prefix>/<suffix>")
+	}
+	prefix, err := strconv.ParseUint(text[3:slash], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("DOI prefix: %v", err)
+	}
+	suffix := strings.ToUpper(strings.Replace(text[slash+1:], "-", "", -1))
+	if len(suffix) != 21 {
+		return nil, fmt.Errorf("suffix has %d characters, needs 20 and a check character", len(suffix))
+	}
+	if check := mod3736CheckChar(suffix[:20]); check != suffix[20] {
+		return nil, fmt.Errorf("check character %c, expected %c", suffix[20], check)
+	}
+	data, err := hex.DecodeString(suffix[:20])
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{uint8(prefix >> 8), uint8(prefix)}, data...), nil
+}
+
+// ATSC content_identifier back from the form formatATSCContentID writes
+func parseATSCContentID(text string) ([]byte, error) {
+	var tsid, endOfDay, uniqueFor uint
+	var contentID string
+	if _, err := fmt.Sscanf(text, "TSID %d end_of_day %d unique_for %d content_id %q", &tsid, &endOfDay, &uniqueFor, &contentID); err != nil {
+		if data, hexErr := hex.DecodeString(text); hexErr == nil && len(data) < 4 {
+			return data, nil // too short to split up, so it was written as hex
+		}
+		return nil, err
+	}
+	if tsid > 0xffff || endOfDay > 0x1f || uniqueFor > 0x1ff {
+		return nil, errors.New("TSID, end_of_day or unique_for out of range")
+	}
+	data := []byte{uint8(tsid >> 8), uint8(tsid), 0xc0 | uint8(endOfDay)<<1 | uint8(uniqueFor>>8), uint8(uniqueFor)}
+	return append(data, contentID...), nil
+}
+
+func (writer *spliceWriter) segmentationDescriptor(segmentation *SegmentationDescriptor) error {
+	writer.u32(segmentation.EventID)
+	writer.u8(boolBit(segmentation.CancelIndicator, 0x80) | boolBit(segmentation.EventIDCompliance, 0x40) | 0x3f)
+	if segmentation.CancelIndicator {
+		return nil
+	}
+	flags := boolBit(segmentation.ProgramSegmentation, 0x80) | boolBit(segmentation.HasDuration, 0x40) | boolBit(segmentation.DeliveryNotRestricted, 0x20)
+	if segmentation.DeliveryNotRestricted {
+		flags |= 0x1f
+	} else {
+		flags |= boolBit(segmentation.WebDeliveryAllowed, 0x10) | boolBit(segmentation.NoRegionalBlackout, 0x08) |
+			boolBit(segmentation.ArchiveAllowed, 0x04) | segmentation.DeviceRestrictions&0x3
+	}
+	writer.u8(flags)
+	if !segmentation.ProgramSegmentation {
+		writer.u8(uint8(len(segmentation.Components)))
+		for _, component := range segmentation.Components {
+			writer.u8(component.ComponentTag)
+			writer.u33(0x7f, component.PTSOffset)
+		}
+	}
+	if segmentation.HasDuration {
+		duration := segmentation.Duration
+		writer.data = append(writer.data, byte(duration>>32), byte(duration>>24), byte(duration>>16), byte(duration>>8), byte(duration))
+	}
+	upid, err := encodeSegmentationUPID(segmentation.UPID)
+	if err != nil {
+		return err
+	}
+	if len(upid) > 255 {
+		return fmt.Errorf("segmentation UPID of %d bytes is too long", len(upid))
+	}
+	writer.u8(segmentation.UPID.Type)
+	writer.u8(uint8(len(upid)))
+	writer.data = append(writer.data, upid...)
+	writer.u8(segmentation.TypeID)
+	writer.u8(segmentation.SegmentNum)
+	writer.u8(segmentation.SegmentsExpected)
+	if segmentation.HasSubSegments {
+		writer.u8(segmentation.SubSegmentNum)
+		writer.u8(segmentation.SubSegmentsExpected)
+	}
+	return nil
+}
+
+func (writer *spliceWriter) spliceDescriptor(descriptor *SpliceDescriptor) error {
+	body := &spliceWriter{}
+	switch {
+	case descriptor.Avail != nil:
+		body.u32(cueIdentifier)
+		body.u32(descriptor.Avail.ProviderAvailID)
+	case descriptor.DTMF != nil:
+		body.u32(cueIdentifier)
+		body.u8(descriptor.DTMF.Preroll)
+		body.u8(uint8(len(descriptor.DTMF.Chars))<<5 | 0x1f)
+		body.data = append(body.data, descriptor.DTMF.Chars...)
+	case descriptor.Segmentation != nil:
+		body.u32(cueIdentifier)
+		if err := body.segmentationDescriptor(descriptor.Segmentation); err != nil {
+			return err
+		}
+	case descriptor.Time != nil:
+		body.u32(cueIdentifier)
+		seconds := descriptor.Time.TAISeconds
+		body.data = append(body.data, byte(seconds>>40), byte(seconds>>32), byte(seconds>>24), byte(seconds>>16), byte(seconds>>8), byte(seconds))
+		body.u32(descriptor.Time.TAINanoseconds)
+		body.u16(descriptor.Time.UTCOffset)
+	default:
+		body.u32(descriptor.Identifier)
+		body.data = append(body.data, descriptor.Private...)
+	}
+	if len(body.data) > 255 {
+		return fmt.Errorf("splice descriptor 0x%02x of %d bytes is too long", descriptor.Tag, len(body.data))
+	}
+	writer.u8(descriptor.Tag)
+	writer.u8(uint8(len(body.data)))
+	writer.data = append(writer.data, body.data...)
+	return nil
+}
+
+// Encode builds the splice_info_section, table_id through CRC.  The command written is the one
+// for CommandType, and the descriptor loop comes from Descriptors (DescriptorLoop is ignored).
+// Encrypted sections can't be made
+func (splice *SpliceInfoSection) Encode() ([]byte, error) {
+	if splice.Encrypted {
+		return nil, errors.New("can't encode an encrypted splice_info_section")
+	}
+	command := &spliceWriter{}
+	switch splice.CommandType {
+	case SpliceCommandNull, SpliceCommandBandwidthReservation:
+	case SpliceCommandSchedule:
+		if splice.Schedule == nil {
+			return nil, errors.New("splice_schedule with no Schedule")
+		}
+		command.spliceSchedule(splice.Schedule)
+	case SpliceCommandInsert:
+		if splice.Insert == nil {
+			return nil, errors.New("splice_insert with no Insert")
+		}
+		command.spliceInsert(splice.Insert)
+	case SpliceCommandTimeSignal:
+		command.spliceTime(splice.TimeSignal)
+	case SpliceCommandPrivate:
+		if splice.Private == nil {
+			return nil, errors.New("private_command with no Private")
+		}
+		command.u32(splice.Private.Identifier)
+		command.data = append(command.data, splice.Private.Bytes...)
+	default:
+		return nil, fmt.Errorf("can't encode %v", splice.CommandType)
+	}
+
+	descriptors := &spliceWriter{}
+	for i := range splice.Descriptors {
+		if err := descriptors.spliceDescriptor(&splice.Descriptors[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// section_length counts from protocol_version to the end of the CRC
+	sectionLength := 11 + len(command.data) + 2 + len(descriptors.data) + 4
+	if sectionLength > maxSectionLength {
+		return nil, fmt.Errorf("splice_info_section_length %d is more than the %d allowed", sectionLength, maxSectionLength)
+	}
+	section := &spliceWriter{}
+	section.u8(uint8(scte35SpliceInfoSection))
+	section.u16((uint16(splice.SAPType&0x3) << 12) | uint16(sectionLength))
+	section.u8(0) // protocol_version
+	section.u33(splice.EncryptionAlgorithm&0x3f, splice.PTSAdjustment)
+	section.u8(splice.CWIndex)
+	section.data = append(section.data, byte(splice.Tier>>4), byte(splice.Tier<<4)|byte(len(command.data)>>8), byte(len(command.data)))
+	section.u8(uint8(splice.CommandType))
+	section.data = append(section.data, command.data...)
+	section.u16(uint16(len(descriptors.data)))
+	section.data = append(section.data, descriptors.data...)
+	section.u32(crc32Mpeg(section.data))
+	return section.data, nil
+}
@@ -0,0 +1,314 @@
+package tshelper
+
+// SCTE-35 splice_info_section decoding (SCTE 35 2022 section 9)
+// The section carries 1 splice command, then a loop of splice descriptors.  Times in the commands
+// are PTS values on the program's clock before pts_adjustment is added, which is how a splicer can
+// move a cue without rewriting every time in it, so the adjusted values are worked out here too.
+// Encrypted sections only have their header decoded, the rest is no use without the key
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SpliceCommandType is splice_command_type
+type SpliceCommandType uint8
+
+const (
+	SpliceCommandNull                 SpliceCommandType = 0x00
+	SpliceCommandSchedule             SpliceCommandType = 0x04
+	SpliceCommandInsert               SpliceCommandType = 0x05
+	SpliceCommandTimeSignal           SpliceCommandType = 0x06
+	SpliceCommandBandwidthReservation SpliceCommandType = 0x07
+	SpliceCommandPrivate              SpliceCommandType = 0xff
+)
+
+func (commandType SpliceCommandType) String() string {
+	switch commandType {
+	case SpliceCommandNull:
+		return "splice_null"
+	case SpliceCommandSchedule:
+		return "splice_schedule"
+	case SpliceCommandInsert:
+		return "splice_insert"
+	case SpliceCommandTimeSignal:
+		return "time_signal"
+	case SpliceCommandBandwidthReservation:
+		return "bandwidth_reservation"
+	case SpliceCommandPrivate:
+		return "private_command"
+	}
+	return fmt.Sprintf("reserved(0x%02x)", uint8(commandType))
+}
+
+// SpliceInfoSection is a decoded splice_info_section.  Only the field for CommandType is set,
+// splice_null and bandwidth_reservation have no fields at all
+type SpliceInfoSection struct {
+	ProtocolVersion     uint8
+	SAPType             uint8
+	Encrypted           bool
+	EncryptionAlgorithm uint8
+	PTSAdjustment       uint64 // 90kHz, added to every PTS in the section
+	CWIndex             uint8
+	Tier                uint16
+	CommandType         SpliceCommandType
+	Schedule            *SpliceSchedule
+	Insert              *SpliceInsert
+	TimeSignal          *SpliceTime
+	Private             *PrivateCommand
+	DescriptorLoop      []byte             // the splice descriptors as sent
+	Descriptors         []SpliceDescriptor // and decoded, see scte35Descriptors.go
+}
+
+// SpliceTime is splice_time().  PTSTime is as sent, PTS has the pts_adjustment added
+type SpliceTime struct {
+	Specified bool // time_specified_flag, when clear there is no time
+	PTSTime   uint64
+	PTS       uint64
+}
+
+// BreakDuration is break_duration(), in 90kHz ticks
+type BreakDuration struct {
+	AutoReturn bool
+	Duration   uint64
+}
+
+// SpliceComponent is 1 component of a component mode splice_insert.  Time is only
+// set when the splice isn't immediate
+type SpliceComponent struct {
+	ComponentTag uint8
+	Time         *SpliceTime
+}
+
+// SpliceInsert is a splice_insert() command
+type SpliceInsert struct {
+	SpliceEventID   uint32
+	CancelIndicator bool // when set nothing below is sent
+	OutOfNetwork    bool
+	ProgramSplice   bool // whole program splices at Time, otherwise each of Components does
+	SpliceImmediate bool
+	Time            *SpliceTime // program splice that isn't immediate
+	Components      []SpliceComponent
+	BreakDuration   *BreakDuration // only when duration_flag is set
+	UniqueProgramID uint16
+	AvailNum        uint8
+	AvailsExpected  uint8
+}
+
+// ScheduledSpliceComponent is 1 component of a component mode splice_schedule event
+type ScheduledSpliceComponent struct {
+	ComponentTag  uint8
+	UTCSpliceTime uint32 // seconds since 1980-01-06 00:00 UTC (GPS epoch)
+}
+
+// ScheduledSplice is 1 event of a splice_schedule() command
+type ScheduledSplice struct {
+	SpliceEventID   uint32
+	CancelIndicator bool
+	OutOfNetwork    bool
+	ProgramSplice   bool
+	UTCSpliceTime   uint32 // program splice only, seconds since the GPS epoch
+	Components      []ScheduledSpliceComponent
+	BreakDuration   *BreakDuration
+	UniqueProgramID uint16
+	AvailNum        uint8
+	AvailsExpected  uint8
+}
+
+// SpliceSchedule is a splice_schedule() command
+type SpliceSchedule struct {
+	Splices []ScheduledSplice
+}
+
+// PrivateCommand is a private_command()
+type PrivateCommand struct {
+	Identifier uint32 // registered with SMPTE, as for the registration_descriptor
+	Bytes      []byte
+}
+
+var errSpliceShort = errors.New("splice_info_section ends part way through a field")
+
+// reads the splice_info_section fields in order, they don't fall on neat byte boundaries.  Once a
+// read runs off the end err is set and every later read gives 0
+type spliceReader struct {
+	data []byte
+	rd   int
+	err  error
+}
+
+func (reader *spliceReader) bytes(count int) []byte {
+	if reader.err != nil || reader.rd+count > len(reader.data) {
+		reader.err = errSpliceShort
+		return make([]byte, count)
+	}
+	out := reader.data[reader.rd : reader.rd+count]
+	reader.rd += count
+	return out
+}
+
+func (reader *spliceReader) u8() uint8 {
+	return reader.bytes(1)[0]
+}
+
+func (reader *spliceReader) u16() uint16 {
+	data := reader.bytes(2)
+	return (uint16(data[0]) << 8) | uint16(data[1])
+}
+
+func (reader *spliceReader) u32() uint32 {
+	data := reader.bytes(4)
+	return (uint32(data[0]) << 24) | (uint32(data[1]) << 16) | (uint32(data[2]) << 8) | uint32(data[3])
+}
+
+// 33 bit value in the bottom of 5 bytes, as used for PTS and durations
+func (reader *spliceReader) u33() (top7 uint8, value uint64) {
+	data := reader.bytes(5)
+	value = (uint64(data[0]&0x1) << 32) | (uint64(data[1]) << 24) | (uint64(data[2]) << 16) | (uint64(data[3]) << 8) | uint64(data[4])
+	return data[0] >> 1, value
+}
+
+func (reader *spliceReader) spliceTime(ptsAdjustment uint64) *SpliceTime {
+	spliceTime := new(SpliceTime)
+	if reader.rd < len(reader.data) && reader.data[reader.rd]&0x80 == 0 {
+		reader.u8() // reserved bits only
+		return spliceTime
+	}
+	_, spliceTime.PTSTime = reader.u33()
+	spliceTime.Specified = true
+	spliceTime.PTS = (spliceTime.PTSTime + ptsAdjustment) & timestampMask
+	return spliceTime
+}
+
+func (reader *spliceReader) breakDuration() *BreakDuration {
+	flags, duration := reader.u33()
+	return &BreakDuration{AutoReturn: flags&0x40 != 0, Duration: duration}
+}
+
+func (reader *spliceReader) spliceInsert(ptsAdjustment uint64) *SpliceInsert {
+	insert := new(SpliceInsert)
+	insert.SpliceEventID = reader.u32()
+	insert.CancelIndicator = reader.u8()&0x80 != 0
+	if insert.CancelIndicator {
+		return insert
+	}
+	flags := reader.u8()
+	insert.OutOfNetwork = flags&0x80 != 0
+	insert.ProgramSplice = flags&0x40 != 0
+	durationFlag := flags&0x20 != 0
+	insert.SpliceImmediate = flags&0x10 != 0
+	if insert.ProgramSplice && !insert.SpliceImmediate {
+		insert.Time = reader.spliceTime(ptsAdjustment)
+	}
+	if !insert.ProgramSplice {
+		componentCount := int(reader.u8())
+		for i := 0; i < componentCount && reader.err == nil; i++ {
+			component := SpliceComponent{ComponentTag: reader.u8()}
+			if !insert.SpliceImmediate {
+				component.Time = reader.spliceTime(ptsAdjustment)
+			}
+			insert.Components = append(insert.Components, component)
+		}
+	}
+	if durationFlag {
+		insert.BreakDuration = reader.breakDuration()
+	}
+	insert.UniqueProgramID = reader.u16()
+	insert.AvailNum = reader.u8()
+	insert.AvailsExpected = reader.u8()
+	return insert
+}
+
+func (reader *spliceReader) spliceSchedule() *SpliceSchedule {
+	schedule := new(SpliceSchedule)
+	spliceCount := int(reader.u8())
+	for i := 0; i < spliceCount && reader.err == nil; i++ {
+		splice := ScheduledSplice{SpliceEventID: reader.u32()}
+		splice.CancelIndicator = reader.u8()&0x80 != 0
+		if !splice.CancelIndicator {
+			flags := reader.u8()
+			splice.OutOfNetwork = flags&0x80 != 0
+			splice.ProgramSplice = flags&0x40 != 0
+			durationFlag := flags&0x20 != 0
+			if splice.ProgramSplice {
+				splice.UTCSpliceTime = reader.u32()
+			} else {
+				componentCount := int(reader.u8())
+				for j := 0; j < componentCount && reader.err == nil; j++ {
+					splice.Components = append(splice.Components, ScheduledSpliceComponent{ComponentTag: reader.u8(), UTCSpliceTime: reader.u32()})
+				}
+			}
+			if durationFlag {
+				splice.BreakDuration = reader.breakDuration()
+			}
+			splice.UniqueProgramID = reader.u16()
+			splice.AvailNum = reader.u8()
+			splice.AvailsExpected = reader.u8()
+		}
+		schedule.Splices = append(schedule.Splices, splice)
+	}
+	return schedule
+}
+
+// decode a whole splice_info_section, table_id through CRC.  The CRC has already been checked
+func parseSpliceInfoSection(section []byte) (*SpliceInfoSection, error) {
+	if len(section) < 3+11+2+4 {
+		return nil, fmt.Errorf("splice_info_section of %d bytes is too short", len(section))
+	}
+	splice := new(SpliceInfoSection)
+	splice.SAPType = (section[1] >> 4) & 0x3
+	reader := &spliceReader{data: section[:len(section)-4], rd: 3}
+	splice.ProtocolVersion = reader.u8()
+	flags, ptsAdjustment := reader.u33()
+	splice.Encrypted = flags&0x40 != 0
+	splice.EncryptionAlgorithm = flags & 0x3f
+	splice.PTSAdjustment = ptsAdjustment
+	splice.CWIndex = reader.u8()
+	tierAndLength := reader.bytes(3)
+	splice.Tier = (uint16(tierAndLength[0]) << 4) | uint16(tierAndLength[1]>>4)
+	commandLength := (int(tierAndLength[1]&0x0f) << 8) | int(tierAndLength[2])
+	splice.CommandType = SpliceCommandType(reader.u8())
+	if splice.ProtocolVersion != 0 {
+		return splice, fmt.Errorf("splice_info_section protocol_version %d not understood", splice.ProtocolVersion)
+	}
+	if splice.Encrypted {
+		return splice, nil
+	}
+
+	commandStart := reader.rd
+	switch splice.CommandType {
+	case SpliceCommandNull, SpliceCommandBandwidthReservation:
+	case SpliceCommandSchedule:
+		splice.Schedule = reader.spliceSchedule()
+	case SpliceCommandInsert:
+		splice.Insert = reader.spliceInsert(ptsAdjustment)
+	case SpliceCommandTimeSignal:
+		splice.TimeSignal = reader.spliceTime(ptsAdjustment)
+	case SpliceCommandPrivate:
+		if commandLength == 0xfff || commandLength < 4 {
+			return splice, errors.New("private_command needs a splice_command_length")
+		}
+		splice.Private = &PrivateCommand{Identifier: reader.u32()}
+		splice.Private.Bytes = append([]byte(nil), reader.bytes(commandLength-4)...)
+	default:
+		if commandLength == 0xfff {
+			return splice, fmt.Errorf("can't skip %v with no splice_command_length", splice.CommandType)
+		}
+		reader.bytes(commandLength)
+	}
+	if reader.err != nil {
+		return splice, fmt.Errorf("%v: %v", splice.CommandType, reader.err)
+	}
+	// 0xfff is the legacy "not given", otherwise the length should agree with what was decoded
+	if commandLength != 0xfff && reader.rd-commandStart != commandLength {
+		return splice, fmt.Errorf("%v is %d bytes, splice_command_length says %d", splice.CommandType, reader.rd-commandStart, commandLength)
+	}
+
+	loopLength := int(reader.u16())
+	splice.DescriptorLoop = append([]byte(nil), reader.bytes(loopLength)...)
+	if reader.err != nil {
+		return splice, fmt.Errorf("descriptor_loop_length %d: %v", loopLength, reader.err)
+	}
+	descriptors, err := parseSpliceDescriptors(splice.DescriptorLoop)
+	splice.Descriptors = descriptors
+	return splice, err
+}
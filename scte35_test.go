@@ -0,0 +1,386 @@
+package tshelper
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// a clear splice_info_section, tier 0xfff, with the given command and descriptor loop
+func testSpliceSection(ptsAdjustment uint64, commandType SpliceCommandType, command []byte, descriptors []byte) []byte {
+	section := []byte{0xfc, 0, 0, 0, uint8(ptsAdjustment >> 32), uint8(ptsAdjustment >> 24), uint8(ptsAdjustment >> 16), uint8(ptsAdjustment >> 8), uint8(ptsAdjustment),
+		0, 0xff, 0xf0 | uint8(len(command)>>8), uint8(len(command)), uint8(commandType)}
+	section = append(section, command...)
+	section = append(section, uint8(len(descriptors)>>8), uint8(len(descriptors)))
+	section = append(section, descriptors...)
+	length := len(section) - 3 + 4
+	section[1], section[2] = uint8(length>>8), uint8(length)
+	crc := crc32Mpeg(section)
+	return append(section, uint8(crc>>24), uint8(crc>>16), uint8(crc>>8), uint8(crc))
+}
+
+func TestSpliceInfoSection(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		section  []byte
+		expected *SpliceInfoSection
+	}{
+		{"splice_null", testSpliceSection(0, SpliceCommandNull, nil, nil),
+			&SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandNull}},
+		{"program splice_insert with a break_duration", testSpliceSection(900, SpliceCommandInsert, []byte{
+			0, 0, 0x12, 0x34, 0x7f, 0xef, 0xfe, 0x00, 0x7b, 0x98, 0xa0, 0xfe, 0x00, 0x29, 0x32, 0xe0, 0, 7, 1, 2}, nil),
+			&SpliceInfoSection{PTSAdjustment: 900, Tier: 0xfff, CommandType: SpliceCommandInsert, Insert: &SpliceInsert{
+				SpliceEventID: 0x1234, OutOfNetwork: true, ProgramSplice: true,
+				Time:            &SpliceTime{Specified: true, PTSTime: 8100000, PTS: 8100900},
+				BreakDuration:   &BreakDuration{AutoReturn: true, Duration: 2700000},
+				UniqueProgramID: 7, AvailNum: 1, AvailsExpected: 2}}},
+		{"component splice_insert", testSpliceSection(0, SpliceCommandInsert, []byte{
+			0, 0, 0, 1, 0x7f, 0x0f, 2, 1, 0xfe, 0, 0, 0, 10, 2, 0x7f, 0, 0, 0, 0}, nil),
+			&SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandInsert, Insert: &SpliceInsert{
+				SpliceEventID: 1, Components: []SpliceComponent{{ComponentTag: 1, Time: &SpliceTime{Specified: true, PTSTime: 10, PTS: 10}}, {ComponentTag: 2, Time: &SpliceTime{}}}}}},
+		{"immediate component splice_insert", testSpliceSection(0, SpliceCommandInsert, []byte{0, 0, 0, 1, 0x7f, 0x9f, 2, 1, 2, 0, 0, 0, 0}, nil),
+			&SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandInsert, Insert: &SpliceInsert{
+				SpliceEventID: 1, OutOfNetwork: true, SpliceImmediate: true, Components: []SpliceComponent{{ComponentTag: 1}, {ComponentTag: 2}}}}},
+		{"cancelled splice_insert", testSpliceSection(0, SpliceCommandInsert, []byte{0, 0, 0, 5, 0xff}, nil),
+			&SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandInsert, Insert: &SpliceInsert{SpliceEventID: 5, CancelIndicator: true}}},
+		{"time_signal with no time", testSpliceSection(0, SpliceCommandTimeSignal, []byte{0x7f}, nil),
+			&SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandTimeSignal, TimeSignal: &SpliceTime{}}},
+		{"time_signal adjusted past the 33 bit wrap", testSpliceSection(900, SpliceCommandTimeSignal, []byte{0xff, 0xff, 0xff, 0xff, 0xff}, nil),
+			&SpliceInfoSection{PTSAdjustment: 900, Tier: 0xfff, CommandType: SpliceCommandTimeSignal, TimeSignal: &SpliceTime{Specified: true, PTSTime: 0x1ffffffff, PTS: 899}}},
+		{"component splice_schedule", testSpliceSection(0, SpliceCommandSchedule, []byte{
+			1, 0, 0, 0, 9, 0x7f, 0x9f, 1, 3, 0x12, 0x34, 0x56, 0x78, 0, 1, 0, 0}, nil),
+			&SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandSchedule, Schedule: &SpliceSchedule{Splices: []ScheduledSplice{{
+				SpliceEventID: 9, OutOfNetwork: true, Components: []ScheduledSpliceComponent{{ComponentTag: 3, UTCSpliceTime: 0x12345678}}, UniqueProgramID: 1}}}}},
+		{"private_command", testSpliceSection(0, SpliceCommandPrivate, []byte{'A', 'B', 'C', 'D', 1, 2}, nil),
+			&SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandPrivate, Private: &PrivateCommand{Identifier: 0x41424344, Bytes: []byte{1, 2}}}},
+		{"reserved command skipped", testSpliceSection(0, 0x10, []byte{1, 2, 3}, []byte{0xf0, 4, 'A', 'B', 'C', 'D'}),
+			&SpliceInfoSection{Tier: 0xfff, CommandType: 0x10, DescriptorLoop: []byte{0xf0, 4, 'A', 'B', 'C', 'D'},
+				Descriptors: []SpliceDescriptor{{Tag: 0xf0, Identifier: 0x41424344}}}},
+	} {
+		splice, err := parseSpliceInfoSection(test.section)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !reflect.DeepEqual(splice, test.expected) {
+			t.Errorf("%s: decoded as %+v, expected %+v", test.name, splice, test.expected)
+		}
+	}
+}
+
+// malformed splice_info_sections are errors, never a panic
+func TestSpliceInfoSectionMalformed(t *testing.T) {
+	insert := testSpliceSection(0, SpliceCommandInsert, []byte{0, 0, 0, 1, 0x7f, 0x5f, 0, 0, 0, 0}, nil)
+	encrypted := append([]byte(nil), insert...)
+	encrypted[4] |= 0x80
+	for _, test := range []struct {
+		name   string
+		offset int
+		value  byte
+	}{
+		{"protocol_version 1", 3, 1},
+		{"splice_command_length too long", 12, 0xff},
+		{"splice_command_length too short", 12, 5},
+		{"descriptor_loop_length too long", 14 + 10 + 1, 0xff},
+	} {
+		bad := append([]byte(nil), insert...)
+		bad[test.offset] = test.value
+		if _, err := parseSpliceInfoSection(bad); err == nil {
+			t.Errorf("%s: decoded", test.name)
+		}
+	}
+	for length := 0; length < len(insert)-4; length++ {
+		if _, err := parseSpliceInfoSection(insert[:length]); err == nil {
+			t.Errorf("%d of %d bytes decoded", length, len(insert))
+		}
+	}
+
+	// encrypted sections only have their header decoded
+	splice, err := parseSpliceInfoSection(encrypted)
+	if err != nil || !splice.Encrypted || splice.Insert != nil {
+		t.Errorf("encrypted section decoded as %+v, %v", splice, err)
+	}
+}
+
+// sections on a PID the PMT marks with a cue_identifier_descriptor come out decoded in SCTE35Events
+func TestSCTE35Events(t *testing.T) {
+	good := testSpliceSection(0, SpliceCommandTimeSignal, []byte{0x7f}, nil)
+	bad := testSpliceSection(0, SpliceCommandTimeSignal, []byte{0x7f}, nil)
+	bad[3] = 1 // protocol_version
+	crc := crc32Mpeg(bad[:len(bad)-4])
+	copy(bad[len(bad)-4:], []byte{uint8(crc >> 24), uint8(crc >> 16), uint8(crc >> 8), uint8(crc)})
+
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	// CUEI registration_descriptor for the program, cue_identifier_descriptor on 0x102
+	pmt := []byte{0xe1, 0x01, 0xf0, 6, 0x05, 4, 'C', 'U', 'E', 'I', 0x86, 0xe1, 0x02, 0xf0, 3, 0x8a, 1, 0}
+	stream.section(0x100, testLongSection(0x02, 1, 0, 0, 0, pmt))
+	stream.section(0x102, good)
+	stream.section(0x102, bad)
+	demuxer, diagnostics := newTestDemuxer()
+	events := &testEvents{}
+	demuxer.AddHandler(events)
+	feedTestStream(t, demuxer, stream)
+
+	if len(events.scte35s) != 2 {
+		t.Fatalf("%d SCTE35 events, expected 2", len(events.scte35s))
+	}
+	if event := events.scte35s[0]; event.ProgramNumber != 1 || event.Splice == nil || event.Splice.TimeSignal == nil {
+		t.Errorf("first event %+v, expected program 1 with a time_signal", event)
+	}
+	if event := events.scte35s[1]; event.Splice != nil || diagnostics.count(DiagBadSpliceInfo) != 1 {
+		t.Errorf("second event %+v with %d BadSpliceInfo, expected no splice and 1", event, diagnostics.count(DiagBadSpliceInfo))
+	}
+}
+
+func TestSpliceDescriptors(t *testing.T) {
+	cuei := []byte{'C', 'U', 'E', 'I'}
+	descriptor := func(tag uint8, body ...byte) []byte {
+		body = append(append([]byte(nil), cuei...), body...)
+		return append([]byte{tag, uint8(len(body))}, body...)
+	}
+	for _, test := range []struct {
+		name     string
+		loop     []byte
+		expected SpliceDescriptor
+	}{
+		{"avail_descriptor", descriptor(0x00, 0, 0, 0, 99),
+			SpliceDescriptor{Tag: 0x00, Identifier: cueIdentifier, Private: []byte{0, 0, 0, 99}, Avail: &AvailDescriptor{ProviderAvailID: 99}}},
+		{"DTMF_descriptor", descriptor(0x01, 50, 3<<5|0x1f, '1', '2', '#'),
+			SpliceDescriptor{Tag: 0x01, Identifier: cueIdentifier, Private: []byte{50, 3<<5 | 0x1f, '1', '2', '#'}, DTMF: &DTMFDescriptor{Preroll: 50, Chars: "12#"}}},
+		{"time_descriptor", descriptor(0x03, 0, 0, 0x65, 0x4b, 0x9c, 0x00, 0, 0, 0, 5, 0, 37),
+			SpliceDescriptor{Tag: 0x03, Identifier: cueIdentifier, Private: []byte{0, 0, 0x65, 0x4b, 0x9c, 0x00, 0, 0, 0, 5, 0, 37},
+				Time: &TimeDescriptor{TAISeconds: 0x654b9c00, TAINanoseconds: 5, UTCOffset: 37}}},
+		{"program segmentation_descriptor with sub segments", descriptor(0x02, 0, 0, 0, 42, 0x7f, 0xff, 0, 0, 0x01, 0x5f, 0x90,
+			0x09, 10, 'S', 'I', 'G', 'N', 'A', 'L', ':', 'a', 'b', 'c', 0x34, 1, 2, 1, 3),
+			SpliceDescriptor{Tag: 0x02, Identifier: cueIdentifier, Segmentation: &SegmentationDescriptor{
+				EventID: 42, EventIDCompliance: true, ProgramSegmentation: true, DeliveryNotRestricted: true, HasDuration: true, Duration: 90000,
+				UPID:   SegmentationUPID{Type: 0x09, TypeName: "ADI", Raw: []byte("SIGNAL:abc"), Value: "SIGNAL:abc"},
+				TypeID: 0x34, TypeName: "Provider Placement Opportunity Start", SegmentNum: 1, SegmentsExpected: 2,
+				HasSubSegments: true, SubSegmentNum: 1, SubSegmentsExpected: 3}}},
+		{"component segmentation_descriptor with delivery restrictions", descriptor(0x02, 0, 0, 0, 7, 0x3f, 0x1e, 1, 5, 0xfe, 0, 0, 0, 10, 0x00, 0, 0x10, 0, 0),
+			SpliceDescriptor{Tag: 0x02, Identifier: cueIdentifier, Segmentation: &SegmentationDescriptor{
+				EventID: 7, WebDeliveryAllowed: true, NoRegionalBlackout: true, ArchiveAllowed: true, DeviceRestrictions: 2,
+				Components: []SegmentationComponent{{ComponentTag: 5, PTSOffset: 10}},
+				UPID:       SegmentationUPID{Type: 0x00, TypeName: "Not Used"}, TypeID: 0x10, TypeName: "Program Start"}}},
+		{"cancelled segmentation_descriptor", descriptor(0x02, 0, 0, 0, 7, 0xff),
+			SpliceDescriptor{Tag: 0x02, Identifier: cueIdentifier, Segmentation: &SegmentationDescriptor{EventID: 7, CancelIndicator: true, EventIDCompliance: true}}},
+		{"private identifier", []byte{0x00, 6, 'A', 'B', 'C', 'D', 1, 2},
+			SpliceDescriptor{Tag: 0x00, Identifier: 0x41424344, Private: []byte{1, 2}}},
+	} {
+		descriptors, err := parseSpliceDescriptors(test.loop)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		// segmentation bodies aren't worth spelling out twice
+		if len(descriptors) == 1 && descriptors[0].Segmentation != nil {
+			test.expected.Private = descriptors[0].Private
+		}
+		if len(descriptors) != 1 || !reflect.DeepEqual(descriptors[0], test.expected) {
+			t.Errorf("%s: decoded as %+v, expected %+v", test.name, descriptors, test.expected)
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		loop []byte
+	}{
+		{"runs past the loop", []byte{0x00, 10, 'C', 'U', 'E', 'I'}},
+		{"too short for its identifier", []byte{0x00, 2, 'C', 'U'}},
+		{"avail_descriptor cut short", descriptor(0x00, 0, 0)},
+		{"DTMF_descriptor with fewer chars than its count", descriptor(0x01, 50, 3<<5|0x1f, '1')},
+		{"time_descriptor cut short", descriptor(0x03, 0, 0, 0, 0)},
+		{"segmentation_descriptor with the UPID cut short", descriptor(0x02, 0, 0, 0, 7, 0x3f, 0xff, 0x09, 10, 'S')},
+	} {
+		if _, err := parseSpliceDescriptors(test.loop); err == nil {
+			t.Errorf("%s: decoded", test.name)
+		}
+	}
+
+	// and from a whole section
+	splice, err := parseSpliceInfoSection(testSpliceSection(0, SpliceCommandNull, nil, descriptor(0x00, 0, 0, 0, 99)))
+	if err != nil || len(splice.Descriptors) != 1 || splice.Descriptors[0].Avail == nil {
+		t.Errorf("section descriptors %+v, %v", splice.Descriptors, err)
+	}
+}
+
+func TestSegmentationUPID(t *testing.T) {
+	for _, test := range []struct {
+		upidType uint8
+		data     []byte
+		value    string
+		parts    []string
+	}{
+		{0x01, []byte{1, 2}, "0102", nil},
+		{0x02, []byte("ABCD1234"), "ABCD1234", nil},
+		{0x02, []byte("ABC"), "414243", nil}, // wrong length for ISCI
+		{0x06, []byte{0, 0, 0, 0, 0x3d, 0x4e, 0, 0, 0x12, 0x34, 0x56, 0x78}, "0000-0000-3D4E-0000-1234-5678", nil},
+		{0x0a, []byte{0x14, 0x78, 0x77, 0x91, 0x85, 0x34, 0x2c, 0x23, 0x90, 0x30, 0x86, 0x10}, "10.5240/7791-8534-2C23-9030-8610-5", nil},
+		{0x0b, append([]byte{0x12, 0x34, 0xc0 | 5<<1 | 1, 0x20}, "ep"...), `TSID 4660 end_of_day 5 unique_for 288 content_id "ep"`, nil},
+		{0x0c, []byte{'C', 'U', 'E', 'I', 1, 2, 3}, "010203", nil},
+		{0x0d, append([]byte{0x09, 3, 'a', 'b', 'c', 0x02, 8}, "ABCD1234"...), "", []string{"abc", "ABCD1234"}},
+		{0x10, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, "00010203-0405-0607-0809-0A0B0C0D0E0F", nil},
+	} {
+		upid := decodeSegmentationUPID(test.upidType, test.data)
+		var parts []string
+		for _, part := range upid.Parts {
+			parts = append(parts, part.Value)
+		}
+		if upid.Value != test.value || !reflect.DeepEqual(parts, test.parts) {
+			t.Errorf("UPID type 0x%02x %X: %q %q, expected %q %q", test.upidType, test.data, upid.Value, parts, test.value, test.parts)
+		}
+	}
+}
+
+// what Encode writes, parseSpliceInfoSection reads back as it was
+func TestSpliceInfoSectionRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		splice *SpliceInfoSection
+	}{
+		{"splice_null", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandNull}},
+		{"bandwidth_reservation", &SpliceInfoSection{SAPType: 3, Tier: 0x123, CommandType: SpliceCommandBandwidthReservation}},
+		{"program splice_insert with an avail_descriptor", &SpliceInfoSection{PTSAdjustment: 900, CWIndex: 2, Tier: 0xfff, CommandType: SpliceCommandInsert,
+			Insert: &SpliceInsert{SpliceEventID: 0x1234, OutOfNetwork: true, ProgramSplice: true,
+				Time:            &SpliceTime{Specified: true, PTSTime: 8100000, PTS: 8100900},
+				BreakDuration:   &BreakDuration{AutoReturn: true, Duration: 30 * 90000},
+				UniqueProgramID: 7, AvailNum: 1, AvailsExpected: 2},
+			Descriptors: []SpliceDescriptor{{Tag: 0x00, Identifier: cueIdentifier, Avail: &AvailDescriptor{ProviderAvailID: 99}}}}},
+		{"component splice_insert", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandInsert,
+			Insert: &SpliceInsert{SpliceEventID: 2, Components: []SpliceComponent{
+				{ComponentTag: 1, Time: &SpliceTime{Specified: true, PTSTime: 90000, PTS: 90000}}, {ComponentTag: 2, Time: &SpliceTime{}}}}}},
+		{"cancelled splice_insert", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandInsert, Insert: &SpliceInsert{SpliceEventID: 3, CancelIndicator: true}}},
+		{"program splice_schedule", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandSchedule, Schedule: &SpliceSchedule{Splices: []ScheduledSplice{
+			{SpliceEventID: 4, OutOfNetwork: true, ProgramSplice: true, UTCSpliceTime: 1300000000, BreakDuration: &BreakDuration{Duration: 90000}, AvailNum: 1, AvailsExpected: 1},
+			{SpliceEventID: 5, CancelIndicator: true}}}}},
+		{"component splice_schedule", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandSchedule, Schedule: &SpliceSchedule{Splices: []ScheduledSplice{
+			{SpliceEventID: 6, Components: []ScheduledSpliceComponent{{ComponentTag: 1, UTCSpliceTime: 1300000000}, {ComponentTag: 2, UTCSpliceTime: 1300000010}}, UniqueProgramID: 9}}}}},
+		{"time_signal with a DTMF_descriptor", &SpliceInfoSection{PTSAdjustment: 100, Tier: 0xfff, CommandType: SpliceCommandTimeSignal,
+			TimeSignal:  &SpliceTime{Specified: true, PTSTime: timestampMask, PTS: 99},
+			Descriptors: []SpliceDescriptor{{Tag: 0x01, Identifier: cueIdentifier, DTMF: &DTMFDescriptor{Preroll: 50, Chars: "123*#"}}}}},
+		{"time_signal with a time_descriptor", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandTimeSignal, TimeSignal: &SpliceTime{},
+			Descriptors: []SpliceDescriptor{{Tag: 0x03, Identifier: cueIdentifier, Time: &TimeDescriptor{TAISeconds: 0xabcdef012345, TAINanoseconds: 999999999, UTCOffset: 37}}}}},
+		{"time_signal with a segmentation_descriptor", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandTimeSignal, TimeSignal: &SpliceTime{Specified: true, PTSTime: 450000, PTS: 450000},
+			Descriptors: []SpliceDescriptor{{Tag: 0x02, Identifier: cueIdentifier, Segmentation: &SegmentationDescriptor{
+				EventID: 42, ProgramSegmentation: true, DeliveryNotRestricted: true, HasDuration: true, Duration: 90000,
+				UPID:   SegmentationUPID{Type: 0x09, TypeName: "ADI", Raw: []byte("SIGNAL:abc"), Value: "SIGNAL:abc"},
+				TypeID: 0x34, TypeName: "Provider Placement Opportunity Start", SegmentNum: 1, SegmentsExpected: 2,
+				HasSubSegments: true, SubSegmentNum: 1, SubSegmentsExpected: 3}}}}},
+		{"component segmentation_descriptor with delivery restrictions", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandTimeSignal, TimeSignal: &SpliceTime{},
+			Descriptors: []SpliceDescriptor{{Tag: 0x02, Identifier: cueIdentifier, Segmentation: &SegmentationDescriptor{
+				EventID: 7, WebDeliveryAllowed: true, ArchiveAllowed: true, DeviceRestrictions: 1,
+				Components: []SegmentationComponent{{ComponentTag: 5, PTSOffset: 10}},
+				UPID:       SegmentationUPID{Type: 0x00, TypeName: "Not Used"}, TypeID: 0x10, TypeName: "Program Start"}}}}},
+		{"private_command with a private descriptor", &SpliceInfoSection{Tier: 0xfff, CommandType: SpliceCommandPrivate,
+			Private:     &PrivateCommand{Identifier: 0x41424344, Bytes: []byte{1, 2, 3}},
+			Descriptors: []SpliceDescriptor{{Tag: 0xf0, Identifier: 0x41424344, Private: []byte{4, 5}}}}},
+	} {
+		section, err := test.splice.Encode()
+		if err != nil {
+			t.Errorf("%s: Encode: %v", test.name, err)
+			continue
+		}
+		decoded, err := parseSpliceInfoSection(section)
+		if err != nil {
+			t.Errorf("%s: decoding what was encoded: %v", test.name, err)
+			continue
+		}
+		// the loop as sent, and the bytes behind each decoded descriptor, are Encode's to work out
+		decoded.DescriptorLoop = nil
+		for i := range decoded.Descriptors {
+			if decoded.Descriptors[i].Identifier == cueIdentifier {
+				decoded.Descriptors[i].Private = nil
+			}
+		}
+		if !reflect.DeepEqual(decoded, test.splice) {
+			t.Errorf("%s: decoded as %+v, expected %+v", test.name, decoded, test.splice)
+		}
+	}
+}
+
+// a time_signal with a segmentation_descriptor carrying upid, encoded then decoded
+func testSegmentationRoundTrip(t *testing.T, upid SegmentationUPID) *SegmentationDescriptor {
+	t.Helper()
+	splice := &SpliceInfoSection{
+		CommandType: SpliceCommandTimeSignal,
+		TimeSignal:  &SpliceTime{Specified: true, PTSTime: 450000},
+		Descriptors: []SpliceDescriptor{{Tag: 0x02, Identifier: cueIdentifier, Segmentation: &SegmentationDescriptor{
+			EventID: 42, ProgramSegmentation: true, DeliveryNotRestricted: true, UPID: upid, TypeID: 0x30, SegmentNum: 1, SegmentsExpected: 1,
+		}}},
+	}
+	section, err := splice.Encode()
+	if err != nil {
+		t.Fatalf("UPID type 0x%02x: Encode: %v", upid.Type, err)
+	}
+	decoded, err := parseSpliceInfoSection(section)
+	if err != nil || len(decoded.Descriptors) != 1 || decoded.Descriptors[0].Segmentation == nil {
+		t.Fatalf("UPID type 0x%02x: decoded as %+v, %v", upid.Type, decoded, err)
+	}
+	return decoded.Descriptors[0].Segmentation
+}
+
+// a UPID given only as the text the decoder writes encodes to the same bytes as its Raw
+func TestSegmentationUPIDRoundTrip(t *testing.T) {
+	eidr := []byte{0x14, 0x78, 0x77, 0x91, 0x85, 0x34, 0x2c, 0x23, 0x90, 0x30, 0x86, 0x10}
+	for _, test := range []struct {
+		upidType uint8
+		raw      []byte
+	}{
+		{0x00, nil},
+		{0x01, []byte{1, 2}},
+		{0x02, []byte("ABCD1234")},
+		{0x05, []byte{0, 0, 0, 0, 0x3d, 0x4e, 0, 0}},
+		{0x06, []byte{0, 0, 0, 0, 0x3d, 0x4e, 0, 0, 0x12, 0x34, 0x56, 0x78}},
+		{0x09, []byte("SIGNAL:abc")},
+		{0x0a, eidr},
+		{0x0b, append([]byte{0x12, 0x34, 0xc0 | 5<<1 | 1, 0x20}, "episode 7"...)},
+		{0x0c, []byte{'C', 'U', 'E', 'I', 1, 2, 3}},
+		{0x0d, append(append([]byte{0x0a, 12}, eidr...), 0x09, 3, 'a', 'b', 'c')},
+		{0x10, []byte("0123456789abcdef")},
+	} {
+		first := testSegmentationRoundTrip(t, SegmentationUPID{Type: test.upidType, Raw: test.raw})
+		text := first.UPID
+		text.Raw = nil
+		text.Parts = append([]SegmentationUPID(nil), text.Parts...)
+		for i := range text.Parts {
+			text.Parts[i].Raw = nil
+		}
+		second := testSegmentationRoundTrip(t, text)
+		if !bytes.Equal(second.UPID.Raw, test.raw) || !reflect.DeepEqual(second.UPID, first.UPID) {
+			t.Errorf("UPID type 0x%02x: %q encoded as %X, expected %X", test.upidType, first.UPID.Value, second.UPID.Raw, test.raw)
+		}
+	}
+}
+
+func TestSpliceInfoSectionEncodeErrors(t *testing.T) {
+	upid := func(upid SegmentationUPID) *SpliceInfoSection {
+		return &SpliceInfoSection{CommandType: SpliceCommandTimeSignal, TimeSignal: &SpliceTime{}, Descriptors: []SpliceDescriptor{{Tag: 0x02,
+			Identifier: cueIdentifier, Segmentation: &SegmentationDescriptor{ProgramSegmentation: true, UPID: upid}}}}
+	}
+	for _, test := range []struct {
+		name   string
+		splice *SpliceInfoSection
+	}{
+		{"encrypted", &SpliceInfoSection{Encrypted: true, CommandType: SpliceCommandNull}},
+		{"splice_insert with no Insert", &SpliceInfoSection{CommandType: SpliceCommandInsert}},
+		{"splice_schedule with no Schedule", &SpliceInfoSection{CommandType: SpliceCommandSchedule}},
+		{"private_command with no Private", &SpliceInfoSection{CommandType: SpliceCommandPrivate}},
+		{"reserved command", &SpliceInfoSection{CommandType: 0x10}},
+		{"descriptor too long", &SpliceInfoSection{CommandType: SpliceCommandNull, Descriptors: []SpliceDescriptor{{Tag: 0xf0, Private: make([]byte, 252)}}}},
+		{"UPID too long", &SpliceInfoSection{CommandType: SpliceCommandTimeSignal, TimeSignal: &SpliceTime{}, Descriptors: []SpliceDescriptor{{Tag: 0x02,
+			Segmentation: &SegmentationDescriptor{ProgramSegmentation: true, UPID: SegmentationUPID{Type: 0x01, Raw: make([]byte, 256)}}}}}},
+		{"section too long", &SpliceInfoSection{CommandType: SpliceCommandPrivate, Private: &PrivateCommand{Bytes: make([]byte, 4096)}}},
+		// a Value that can't be the bytes of its type is an error, never written as ASCII
+		{"ISCI the wrong length", upid(SegmentationUPID{Type: 0x02, Value: "TOO SHORT"})},
+		{"TID not hex", upid(SegmentationUPID{Type: 0x05, Value: "not hex"})},
+		{"TI the wrong length", upid(SegmentationUPID{Type: 0x06, Value: "0000-0000"})},
+		{"EIDR with the wrong check character", upid(SegmentationUPID{Type: 0x0a, Value: "10.5240/7791-8534-2C23-9030-8610-X"})},
+		{"EIDR not a DOI", upid(SegmentationUPID{Type: 0x0a, Value: "an EIDR"})},
+		{"ATSC TSID out of range", upid(SegmentationUPID{Type: 0x0b, Value: `TSID 70000 end_of_day 1 unique_for 1 content_id "x"`})},
+		{"MID with a bad part", upid(SegmentationUPID{Type: 0x0d, Parts: []SegmentationUPID{{Type: 0x10, Value: "short"}}})},
+		{"UUID the wrong length", upid(SegmentationUPID{Type: 0x10, Value: "0123"})},
+	} {
+		if _, err := test.splice.Encode(); err == nil {
+			t.Errorf("%s: encoded", test.name)
+		}
+	}
+}
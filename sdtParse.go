@@ -0,0 +1,171 @@
+package tshelper
+
+// Service Description Table (EN 300 468 5.2.3), on PID 0x11.  0x42 describes the services in
+// this transport stream and names the services in serviceMap, 0x46 describes the services in
+// other transport streams of the network.  Those are kept apart from serviceMap, the report
+// picks them up from what was kept of each section, 1 SDT per original_network_id /
+// transport_stream_id
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SDTReport is the current version of the SDT for 1 transport stream, all its sections put together
+type SDTReport struct {
+	OriginalNetworkID uint16       `json:"originalNetworkId"`
+	TransportStreamID uint16       `json:"transportStreamId"`
+	Actual            bool         `json:"actual"` // this transport stream
+	Version           uint8        `json:"version"`
+	Complete          bool         `json:"complete"`
+	Services          []SDTService `json:"services"`
+}
+
+// copies of a list of services, sharing nothing but the Value of their PrivateDescriptors
+func copySDTServices(services []SDTService) []SDTService {
+	if services == nil {
+		return nil
+	}
+	copied := make([]SDTService, len(services))
+	for i, service := range services {
+		copied[i] = service
+		copied[i].PrivateDescriptors = copyDescriptors(service.PrivateDescriptors)
+	}
+	return copied
+}
+
+// decode the service_descriptor (0x48)
+func (service *SDTService) addServiceDescriptor(body []byte) error {
+	if len(body) < 3 || 3+int(body[1]) > len(body) {
+		return fmt.Errorf("service_descriptor for service 0x%x is too short", service.ServiceID)
+	}
+	providerLength := int(body[1])
+	if 3+providerLength+int(body[2+providerLength]) > len(body) {
+		return fmt.Errorf("service_descriptor for service 0x%x has a name longer than itself", service.ServiceID)
+	}
+	service.ServiceType = body[0]
+	var providerErr, nameErr error
+	service.Provider, providerErr = decodeDVBText(body[2 : 2+providerLength])
+	service.Name, nameErr = decodeDVBText(body[3+providerLength : 3+providerLength+int(body[2+providerLength])])
+	if nameErr != nil {
+		return fmt.Errorf("service_descriptor name: %w", nameErr)
+	}
+	if providerErr != nil {
+		return fmt.Errorf("service_descriptor provider: %w", providerErr)
+	}
+	return nil
+}
+
+// decode 1 whole SDT section (actual or other), table_id through CRC.  As much as could be
+// decoded is handed back along with any error
+func parseSDTSection(section []byte, decoders *decoderRegistry) (*SDTEvent, error) {
+	sdt := &SDTEvent{
+		Actual:            section[0] == uint8(sdtSectionActualTransportStream),
+		TransportStreamID: (uint16(section[3]) << 8) | uint16(section[4]),
+	}
+	body := section[8 : len(section)-4]
+	if len(body) < 3 {
+		return sdt, fmt.Errorf("SDT section of %d bytes is too short", len(section))
+	}
+	sdt.OriginalNetworkID = (uint16(body[0]) << 8) | uint16(body[1])
+
+	var textErr error
+	for rd := 3; rd < len(body); {
+		if rd+5 > len(body) {
+			return sdt, fmt.Errorf("SDT service entry runs past the end of the section")
+		}
+		service := SDTService{
+			ServiceID:           (uint16(body[rd]) << 8) | uint16(body[rd+1]),
+			EITSchedule:         body[rd+2]&0x02 != 0,
+			EITPresentFollowing: body[rd+2]&0x01 != 0,
+			RunningStatus:       valueName(runningStatusNames, body[rd+3]>>5),
+			FreeCAMode:          body[rd+3]&0x10 != 0,
+		}
+		descriptors, _, err := lengthPrefixedLoop(body[rd+3:])
+		if err != nil {
+			return sdt, fmt.Errorf("SDT service 0x%x: %v", service.ServiceID, err)
+		}
+		var descriptorErr error
+		specifier := AnyPrivateDataSpecifier
+		err = forEachDescriptor(descriptors, func(tag uint8, body []byte) {
+			descriptor, found, err := decoders.decodeDescriptor(tag, specifier, body)
+			specifier = privateDataSpecifierAfter(tag, body, specifier)
+			if found {
+				service.PrivateDescriptors = append(service.PrivateDescriptors, descriptor)
+			} else if tag == 0x48 {
+				err = service.addServiceDescriptor(body)
+			}
+			descriptorErr = worseError(descriptorErr, err)
+		})
+		sdt.Services = append(sdt.Services, service)
+		if err == nil {
+			err = descriptorErr
+		}
+		if isUndecodableText(err) {
+			if textErr == nil {
+				textErr = fmt.Errorf("SDT service 0x%x: %w", service.ServiceID, err)
+			}
+		} else if err != nil {
+			return sdt, fmt.Errorf("SDT service 0x%x: %v", service.ServiceID, err)
+		}
+		rd += 5 + len(descriptors)
+	}
+	return sdt, textErr
+}
+
+// parse an SDT section, name the services in serviceMap if it's for this transport stream, keep
+// a copy for the report and hand it on
+func (tables tableParser) sdtParser(pid uint16, section []byte) {
+	event, err := parseSDTSection(section, tables.decoders)
+	if err != nil {
+		tables.report.raise(SeverityWarning, tableErrorCode(err), "%v", err)
+	}
+	event.Position = tables.report.position
+	kept := *event
+	kept.Services = copySDTServices(event.Services)
+	tables.keepDecoded(pid, section, &kept)
+
+	if event.Actual {
+		for _, service := range event.Services {
+			if service.Name == "" {
+				continue
+			}
+			serviceEntry := tables.serviceMap[service.ServiceID]
+			serviceEntry.programNumber = service.ServiceID
+			serviceEntry.serviceName = service.Name
+			tables.serviceMap[service.ServiceID] = serviceEntry
+		}
+	}
+
+	for _, handler := range tables.report.handlers {
+		handler.OnSDT(event)
+	}
+}
+
+// the SDT part of a report, put back together from what was kept of each section
+func (tables tableParser) addSDTToReport(report *Report) {
+	report.SDTs = make([]SDTReport, 0)
+	for key, state := range tables.versions {
+		if key.tableID != uint8(sdtSectionActualTransportStream) && key.tableID != uint8(sdtSectionOtherTransportStream) {
+			continue
+		}
+		sdtReport := SDTReport{OriginalNetworkID: key.originalNetworkID, TransportStreamID: key.tableIDExtension, Actual: key.tableID == uint8(sdtSectionActualTransportStream), Version: state.version, Complete: state.complete}
+		sdtReport.Services = make([]SDTService, 0)
+		for _, decoded := range state.decoded {
+			if sdt, isSDT := decoded.(*SDTEvent); isSDT {
+				sdtReport.Services = append(sdtReport.Services, copySDTServices(sdt.Services)...)
+			}
+		}
+		report.SDTs = append(report.SDTs, sdtReport)
+	}
+	sort.Slice(report.SDTs, func(i, j int) bool {
+		a, b := report.SDTs[i], report.SDTs[j]
+		if a.Actual != b.Actual {
+			return a.Actual
+		}
+		if a.OriginalNetworkID != b.OriginalNetworkID {
+			return a.OriginalNetworkID < b.OriginalNetworkID
+		}
+		return a.TransportStreamID < b.TransportStreamID
+	})
+}
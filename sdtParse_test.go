@@ -0,0 +1,157 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 1 running SDT service entry, present/following EIT on, with a digital TV service_descriptor
+func testSDTService(serviceID uint16, provider, name string) []byte {
+	descriptor := append([]byte{0x48, uint8(3 + len(provider) + len(name)), 0x01, uint8(len(provider))}, provider...)
+	descriptor = append(append(descriptor, uint8(len(name))), name...)
+	loop := testLoop(descriptor)
+	loop[0] = 0x80 | loop[0]&0x0f
+	return append([]byte{uint8(serviceID >> 8), uint8(serviceID), 0xfd}, loop...)
+}
+
+func testSDT(tableID uint8, transportStreamID, originalNetworkID uint16, services ...[]byte) []byte {
+	body := []byte{uint8(originalNetworkID >> 8), uint8(originalNetworkID), 0xff}
+	for _, service := range services {
+		body = append(body, service...)
+	}
+	return testLongSection(tableID, transportStreamID, 0, 0, 0, body)
+}
+
+func TestSDT(t *testing.T) {
+	one := SDTService{ServiceID: 1, ServiceType: 1, Provider: "P", Name: "One", EITPresentFollowing: true, RunningStatus: "running"}
+	two := SDTService{ServiceID: 2, ServiceType: 1, Name: "Two", EITPresentFollowing: true, RunningStatus: "running"}
+	other := SDTService{ServiceID: 7, ServiceType: 1, Name: "Elsewhere", EITPresentFollowing: true, RunningStatus: "running"}
+	scrambled := testSDTService(3, "", "")
+	scrambled[2], scrambled[3] = 0xfe, 0x70|scrambled[3]&0x0f // EIT schedule only, pausing and scrambled
+
+	tables, diagnostics, events := testSectionTables()
+	tables.processSection(0x11, testSDT(0x42, 1, 2, testSDTService(1, "P", "One"), testSDTService(2, "", "Two"), scrambled))
+	tables.processSection(0x11, testSDT(0x46, 5, 2, testSDTService(7, "", "Elsewhere")))
+	if len(*diagnostics) != 0 {
+		t.Errorf("diagnostics %v", *diagnostics)
+	}
+	if len(events.sdts) != 2 {
+		t.Fatalf("%d SDT events, expected 2", len(events.sdts))
+	}
+
+	report := &Report{}
+	tables.addToReport(report)
+	scrambledService := SDTService{ServiceID: 3, ServiceType: 1, EITSchedule: true, RunningStatus: "pausing", FreeCAMode: true}
+	for _, test := range []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"actual SDT", *events.sdts[0], SDTEvent{Actual: true, TransportStreamID: 1, OriginalNetworkID: 2, Services: []SDTService{one, two, scrambledService}}},
+		{"other SDT", *events.sdts[1], SDTEvent{TransportStreamID: 5, OriginalNetworkID: 2, Services: []SDTService{other}}},
+		{"names from the actual SDT", [3]string{tables.serviceMap[1].serviceName, tables.serviceMap[2].serviceName, tables.serviceMap[7].serviceName},
+			[3]string{"One", "Two", ""}},
+		{"report", report.SDTs, []SDTReport{
+			{OriginalNetworkID: 2, TransportStreamID: 1, Actual: true, Complete: true, Services: []SDTService{one, two, scrambledService}},
+			{OriginalNetworkID: 2, TransportStreamID: 5, Complete: true, Services: []SDTService{other}},
+		}},
+	} {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Errorf("%s: %+v, expected %+v", test.name, test.got, test.expected)
+		}
+	}
+}
+
+// transport streams of different networks can share a transport_stream_id, and each keeps its SDT
+func TestSDTOtherKeyedByNetwork(t *testing.T) {
+	tables, _, events := testSectionTables()
+	for i := 0; i < 2; i++ {
+		tables.processSection(0x11, testSDT(0x46, 5, 100, testSDTService(1, "", "Network 100")))
+		tables.processSection(0x11, testSDT(0x46, 5, 200, testSDTService(1, "", "Network 200")))
+	}
+	if len(events.sdts) != 2 {
+		t.Errorf("%d SDT events, expected 2", len(events.sdts))
+	}
+	report := &Report{}
+	tables.addToReport(report)
+	var got [][3]interface{}
+	for _, sdt := range report.SDTs {
+		for _, service := range sdt.Services {
+			got = append(got, [3]interface{}{sdt.OriginalNetworkID, sdt.TransportStreamID, service.Name})
+		}
+	}
+	if expected := [][3]interface{}{{uint16(100), uint16(5), "Network 100"}, {uint16(200), uint16(5), "Network 200"}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("SDTs %v, expected %v", got, expected)
+	}
+	for key, state := range tables.versions {
+		if state.repeats != 1 {
+			t.Errorf("%+v repeated %d times, expected 1", key, state.repeats)
+		}
+	}
+}
+
+func TestSDTMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		body     []byte
+		services int
+	}{
+		{"no original_network_id", []byte{0, 2}, 0},
+		{"service cut short", append([]byte{0, 2, 0xff}, testSDTService(1, "", "a")[:4]...), 0},
+		{"descriptors_loop_length too long", []byte{0, 2, 0xff, 0, 1, 0xfc, 0x8f, 0xff}, 0},
+		{"descriptor too long", []byte{0, 2, 0xff, 0, 1, 0xfc, 0x80, 2, 0x48, 9}, 1},
+		{"service_descriptor name too long", []byte{0, 2, 0xff, 0, 1, 0xfc, 0x80, 7, 0x48, 5, 1, 0, 9, 'a', 'b'}, 1},
+		{"service_descriptor provider too long", []byte{0, 2, 0xff, 0, 1, 0xfc, 0x80, 4, 0x48, 2, 1, 7}, 1},
+	} {
+		tables, diagnostics, events := testSectionTables()
+		tables.processSection(0x11, testLongSection(0x42, 1, 0, 0, 0, test.body))
+		if diagnostics.count(DiagBadTable) != 1 || len(events.sdts) != 1 || len(events.sdts[0].Services) != test.services {
+			t.Errorf("%s: %d SDT events, diagnostics %v", test.name, len(events.sdts), *diagnostics)
+		}
+	}
+}
+
+// a registered descriptor decoder runs once per section, however many reports are made, and each
+// report is a copy of its own
+func TestSDTAndBATDecodedOnce(t *testing.T) {
+	descriptor := testLoop([]byte{0x90, 1, 0xaa})
+	for _, test := range []struct {
+		name        string
+		section     []byte
+		descriptors func(report *Report) []Descriptor
+	}{
+		{"SDT", testSDT(0x46, 5, 100, append([]byte{0, 1, 0xfd}, descriptor...)), func(report *Report) []Descriptor {
+			if len(report.SDTs) != 1 || len(report.SDTs[0].Services) != 1 {
+				return nil
+			}
+			return report.SDTs[0].Services[0].PrivateDescriptors
+		}},
+		{"BAT", testBAT(0, 0, nil, append([]byte{0, 1, 0, 2}, descriptor...)), func(report *Report) []Descriptor {
+			if len(report.Bouquets) != 1 || len(report.Bouquets[0].TransportStreams) != 1 {
+				return nil
+			}
+			return report.Bouquets[0].TransportStreams[0].PrivateDescriptors
+		}},
+	} {
+		tables, _, _ := testSectionTables()
+		calls := 0
+		tables.decoders.descriptors[descriptorDecoderKey{tag: 0x90, specifier: AnyPrivateDataSpecifier}] = func(tag uint8, body []byte) (interface{}, error) {
+			calls += 1
+			return int(body[0]), nil
+		}
+		tables.processSection(0x11, test.section)
+		expected := []Descriptor{{Tag: 0x90, Name: "descriptor 0x90", Raw: []byte{0xaa}, Value: 0xaa}}
+		for i := 0; i < 2; i++ {
+			report := &Report{}
+			tables.addToReport(report)
+			descriptors := test.descriptors(report)
+			if !reflect.DeepEqual(descriptors, expected) {
+				t.Fatalf("%s report %d: private descriptors %+v, expected %+v", test.name, i, descriptors, expected)
+			}
+			descriptors[0].Raw[0] = 0
+		}
+		if calls != 1 {
+			t.Errorf("%s: descriptor decoder called %d times, expected once", test.name, calls)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tshelper
+
+// PSI / SI section reassembly, 1 assembler per table PID
+// In a packet with PUSI set, the first payload byte is the pointer_field: the number of bytes
+// that finish off a section started in an earlier packet, before the first new section starts.
+// After that sections follow back to back until either the packet ends (the last one carries on
+// into the next packet on the PID) or a 0xFF table_id, which means the rest of the packet is
+// stuffing.  A continuity error loses any section part way through, as there is no telling
+// what went missing
+
+// biggest section_length allowed, for private sections.  PSI tables are limited to 1021
+const maxSectionLength = 4093
+
+// a section being put together on one PID
+type sectionBuffer struct {
+	start Position // packet the section in data started in
+	data  []byte   // bytes of the current section so far, nil when not part way through one
+}
+
+// add the payload of 1 TS packet on a table PID, processing every section it completes
+func (tables tableParser) assembleSections(pid uint16, pusi uint8, ccError bool, payload []byte) {
+	buffer := tables.sections[pid]
+	if buffer == nil {
+		buffer = new(sectionBuffer)
+		tables.sections[pid] = buffer
+	}
+
+	if ccError && buffer.data != nil {
+		tables.report.raise(SeverityWarning, DiagSectionDiscarded, "continuity error, dropping %d bytes of section", len(buffer.data))
+		buffer.data = nil
+	}
+
+	if pusi == 0 {
+		if buffer.data != nil {
+			buffer.data = append(buffer.data, payload...)
+			tables.extractSections(pid, buffer)
+		}
+		return
+	}
+
+	pointerField := int(payload[0])
+	if 1+pointerField > len(payload) {
+		tables.report.raise(SeverityWarning, DiagBadPointerField, "pointer_field %d runs past the %d byte payload", pointerField, len(payload))
+		buffer.data = nil
+		return
+	}
+
+	// finish off the section already under way
+	if buffer.data != nil {
+		buffer.data = append(buffer.data, payload[1:1+pointerField]...)
+		tables.extractSections(pid, buffer)
+		if buffer.data != nil {
+			tables.report.raise(SeverityWarning, DiagSectionDiscarded, "new section started with %d bytes of the last still incomplete", len(buffer.data))
+		}
+	}
+
+	buffer.start = tables.report.position
+	buffer.data = append([]byte(nil), payload[1+pointerField:]...)
+	tables.extractSections(pid, buffer)
+}
+
+// pull every complete section off the front of the buffer and process it.  Leaves buffer.data
+// holding the start of an incomplete section, or nil if there's nothing left worth keeping
+func (tables tableParser) extractSections(pid uint16, buffer *sectionBuffer) {
+	for {
+		if len(buffer.data) == 0 || buffer.data[0] == 0xff {
+			buffer.data = nil // nothing, or stuffing to the end of the packet
+			return
+		}
+		if len(buffer.data) < 3 {
+			return // not even the section_length yet
+		}
+		sectionLength := ((int(buffer.data[1]) << 8) | int(buffer.data[2])) & 0x0fff
+		if sectionLength > maxSectionLength {
+			tables.report.raiseAt(buffer.start, SeverityWarning, DiagBadSectionLength, "table 0x%x section_length %d is more than the %d allowed", buffer.data[0], sectionLength, maxSectionLength)
+			buffer.data = nil
+			return
+		}
+		if len(buffer.data) < 3+sectionLength {
+			return // rest is still to come
+		}
+
+		// processed with the position of the packet the section started in, then put back
+		section := buffer.data[:3+sectionLength]
+		buffer.data = buffer.data[3+sectionLength:]
+		packetPosition := tables.report.position
+		tables.report.position = buffer.start
+		tables.processSection(pid, section)
+		tables.report.position = packetPosition
+	}
+}
@@ -0,0 +1,121 @@
+package tshelper
+
+import (
+	"testing"
+)
+
+// a PAT for transportStreamID listing programs 1 on, their PMTs from 0x1000 on.  4 bytes a program
+// so it can be made as long as a test needs
+func testPATPrograms(transportStreamID uint16, programs int) []byte {
+	var body []byte
+	for program := 1; program <= programs; program++ {
+		pid := 0x1000 + program
+		body = append(body, uint8(program>>8), uint8(program), 0xe0|uint8(pid>>8), uint8(pid))
+	}
+	return testLongSection(0x00, transportStreamID, 0, 0, 0, body)
+}
+
+// a tableParser with its diagnostics and events collected
+func testSectionTables() (tableParser, *testDiagnostics, *testEvents) {
+	report := new(reporter)
+	diagnostics := &testDiagnostics{}
+	report.sink = diagnostics.sink
+	events := &testEvents{}
+	report.handlers = append(report.handlers, events)
+	return newTableParser(report), diagnostics, events
+}
+
+func TestSectionAssembly(t *testing.T) {
+	a := testPATPrograms(1, 1)
+	b := testPATPrograms(2, 100) // runs over 3 packets
+	c := testPATPrograms(3, 1)
+
+	// packet 1: a, then b as far as it fits
+	packet1 := append([]byte{0}, a...)
+	packet1 = append(packet1, b[:184-len(packet1)]...)
+	bSent := 184 - 1 - len(a)
+	// packet 2, no PUSI: more of b
+	packet2 := b[bSent : bSent+184]
+	bSent += 184
+	// packet 3: pointer_field over the end of b, then c and stuffing
+	packet3 := append([]byte{uint8(len(b) - bSent)}, b[bSent:]...)
+	packet3 = append(packet3, c...)
+	packet3 = append(packet3, 0xff, 0xff, 0xff)
+
+	tables, diagnostics, events := testSectionTables()
+	tables.assembleSections(0, 1, false, packet1)
+	tables.assembleSections(0, 0, false, packet2)
+	tables.assembleSections(0, 1, false, packet3)
+
+	if len(events.pats) != 3 {
+		t.Fatalf("%d PATs, expected a, b and c", len(events.pats))
+	}
+	for i, programs := range []int{1, 100, 1} {
+		if pat := events.pats[i]; pat.TransportStreamID != uint16(i+1) || len(pat.Programs) != programs {
+			t.Errorf("PAT %d: transport stream %d with %d programs, expected %d with %d", i, pat.TransportStreamID, len(pat.Programs), i+1, programs)
+		}
+	}
+	for _, diagnostic := range *diagnostics {
+		if diagnostic.Severity != SeverityInfo {
+			t.Errorf("diagnostic %v", diagnostic)
+		}
+	}
+}
+
+func TestSectionAssemblyDamage(t *testing.T) {
+	b := testPATPrograms(2, 72) // 300 bytes
+	c := testPATPrograms(3, 1)
+
+	for _, test := range []struct {
+		name     string
+		packets  [][]byte
+		pusi     []uint8
+		ccError  []bool
+		sections int
+		code     DiagnosticCode
+	}{
+		{
+			name:     "continuity error part way through",
+			packets:  [][]byte{append([]byte{0}, b[:183]...), b[183:]},
+			pusi:     []uint8{1, 0},
+			ccError:  []bool{false, true},
+			sections: 0,
+			code:     DiagSectionDiscarded,
+		},
+		{
+			name:     "pointer_field past the payload",
+			packets:  [][]byte{append([]byte{50}, c...)},
+			pusi:     []uint8{1},
+			ccError:  []bool{false},
+			sections: 0,
+			code:     DiagBadPointerField,
+		},
+		{
+			name:     "new section before the last finished",
+			packets:  [][]byte{append([]byte{0}, b[:183]...), append([]byte{0}, c...)},
+			pusi:     []uint8{1, 1},
+			ccError:  []bool{false, false},
+			sections: 1,
+			code:     DiagSectionDiscarded,
+		},
+		{
+			name:     "section_length over the limit",
+			packets:  [][]byte{{0, 0x00, 0x7f, 0xff, 1, 2, 3}},
+			pusi:     []uint8{1},
+			ccError:  []bool{false},
+			sections: 0,
+			code:     DiagBadSectionLength,
+		},
+	} {
+		tables, diagnostics, events := testSectionTables()
+		for i, packet := range test.packets {
+			tables.assembleSections(0, test.pusi[i], test.ccError[i], packet)
+		}
+		if len(events.pats) != test.sections {
+			t.Errorf("%s: %d sections, expected %d", test.name, len(events.pats), test.sections)
+		}
+		if diagnostics.count(test.code) != 1 {
+			t.Errorf("%s: diagnostics %v, expected a %v", test.name, *diagnostics, test.code)
+		}
+	}
+}
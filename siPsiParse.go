@@ -3,10 +3,16 @@ package tshelper
 // contains the logic to process basic tables
 // PAT
 // PMT
-// SDT 
+// SDT actual and other (sdtParse.go)
+// BAT (batParse.go)
+// NIT (nitParse.go)
+// EIT (eitParse.go)
+// TDT / TOT (tdtParse.go)
+// CAT and CA_descriptors (caParse.go)
 // SCTE-35 tables
+// private tables and descriptors, with the decoders registered for them (privateDecoders.go)
 
-// does not yet cope with tables that span multiple TS packets
+// sections spanning many TS packets are put back together first, see sectionAssembler.go
 
 import (
 	"fmt"
@@ -18,8 +24,18 @@ type tableIDsEnum uint8
  // from Table 2-31 – table_id assignment values in the mpeg systems spec
 const (
     programAssociationSection tableIDsEnum = 0x00
+    conditionalAccessSection tableIDsEnum = 0x01
     ProgramMapSection tableIDsEnum = 0x02
+    nitSectionActualNetwork tableIDsEnum = 0x40
+    nitSectionOtherNetwork tableIDsEnum = 0x41
     sdtSectionActualTransportStream tableIDsEnum = 0x42
+    sdtSectionOtherTransportStream tableIDsEnum = 0x46
+    batSection tableIDsEnum = 0x4a
+    eitPresentFollowingActual tableIDsEnum = 0x4e
+    eitPresentFollowingOther tableIDsEnum = 0x4f
+    eitScheduleOtherLast tableIDsEnum = 0x6f
+    tdtSection tableIDsEnum = 0x70
+    totSection tableIDsEnum = 0x73
 	scte35SpliceInfoSection tableIDsEnum = 0xfc
 )
 
@@ -28,10 +44,28 @@ func (tableID tableIDsEnum) String() string {
 	switch tableID {
 	case programAssociationSection:
 		return "programAssociationSection"
+	case conditionalAccessSection:
+		return "conditionalAccessSection"
 	case ProgramMapSection:
 		return "ProgramMapSection"
+	case nitSectionActualNetwork:
+		return "nitSectionActualNetwork"
+	case nitSectionOtherNetwork:
+		return "nitSectionOtherNetwork"
 	case sdtSectionActualTransportStream:
 		return "sdtSectionActualTransportStream"
+	case sdtSectionOtherTransportStream:
+		return "sdtSectionOtherTransportStream"
+	case batSection:
+		return "batSection"
+	case eitPresentFollowingActual:
+		return "eitPresentFollowingActual"
+	case eitPresentFollowingOther:
+		return "eitPresentFollowingOther"
+	case tdtSection:
+		return "tdtSection"
+	case totSection:
+		return "totSection"
 	case scte35SpliceInfoSection:
 		return "scte35SpliceInfoSection"
 	}
@@ -44,6 +78,10 @@ const (
 	pmtTable
 	nitTable
 	scte35Table
+	eitTable
+	tdtTable
+	catTable
+	privateTable  // has a registered TableDecoder, see privateDecoders.go
 )
 
 func (tableType tableTypeEnum) String() string {
@@ -58,6 +96,14 @@ func (tableType tableTypeEnum) String() string {
 		return "nitTable"
 	case scte35Table:
 		return "scte35Table"
+	case eitTable:
+		return "eitTable"
+	case tdtTable:
+		return "tdtTable"
+	case catTable:
+		return "catTable"
+	case privateTable:
+		return "privateTable"
 	}
 	return "unknown"
 }
@@ -67,6 +113,8 @@ type streamComponentDefinition struct {
 	streamType uint8
 	streamPID uint16
 	cueDescriptor bool
+	caSystems []CADescriptor  // ECMs for just this component
+	descriptors []Descriptor  // every descriptor in the ES_info loop, see pmtDescriptors.go
 }
 
 type programDefinition struct{
@@ -77,6 +125,11 @@ type programDefinition struct{
 	definedMaxBitrate uint32
 	numberOfStreams uint32
 	streamComps []streamComponentDefinition
+	caSystems []CADescriptor  // ECMs for the whole service
+	descriptors []Descriptor  // the program_info descriptors, see pmtDescriptors.go
+	presentEvent *EPGEvent        // from EIT present/following, see eitParse.go
+	followingEvent *EPGEvent
+	schedule map[uint8]*eitScheduleTable  // EIT schedule, by table_id
 }
 
 
@@ -85,7 +138,7 @@ type tablesMapEntry struct {
 	programNumber uint16
 	latestVersion uint8
 	versionsSeen uint64
-	numberTablesSeen uint64
+	numberTablesSeen uint64  // whole tables gone by, repeats included - counted at each last section
 	isSingleSection bool
 }
 
@@ -107,25 +160,69 @@ type tableParser struct {
 	// use when that is more appropriate
 	serviceMap map[uint16]programDefinition
 
+	// sections part way through arriving, by PID
+	sections map[uint16]*sectionBuffer
+
+	// sections dropped for failing their CRC, by PID and table_id
+	crcErrors map[crcErrorKey]uint64
+
+	// the current version of every table seen, see tableVersions.go
+	versions map[tableKey]*tableVersionState
+
+	// PIDs carrying PES for a program (so not sections), mapped to the program number they belong to.
+	// Rebuilt from serviceMap whenever a PMT is parsed
+	elementaryStreams map[uint16]uint16
+
+	// SCTE-35 cues placed against PCR and video PTS, shared with the tsdmx, see spliceTimeline.go
+	timeline *spliceTimeline
+
+	// PCR tied to UTC by the TDT / TOT, shared with the tsdmx, see tdtParse.go
+	clock *wallClock
+
+	// decoders for private descriptors and tables, shared with the tsdmx, see privateDecoders.go
+	decoders *decoderRegistry
+
+	// shared with the tsdmx, knows where we are in the stream and where diagnostics go
+	report *reporter
 }
 
 
 
-func newTableParser () tableParser {
+func newTableParser (report *reporter) tableParser {
 	newStruct := tableParser {}
+	newStruct.report = report
 	newStruct.tablesMap = make(map[uint16]tablesMapEntry)
 	
-	// prefill the table Map with SDT and PAT since we know where they will be
+	// prefill the table Map with PAT, CAT, NIT, SDT, EIT and TDT since we know where they will be
 	piddata := tablesMapEntry {}
 
 	piddata.tabletype = patTable
 	newStruct.tablesMap[0x00] = piddata
+
+	piddata.tabletype = catTable
+	newStruct.tablesMap[0x01] = piddata
 	
+	piddata.tabletype = nitTable
+	newStruct.tablesMap[0x10] = piddata
+
 	piddata.tabletype = sdtTable
 	newStruct.tablesMap[0x11] = piddata
+
+	piddata.tabletype = eitTable
+	newStruct.tablesMap[0x12] = piddata
+
+	piddata.tabletype = tdtTable
+	newStruct.tablesMap[0x14] = piddata
 	
 	// create empty Service List so we have somewhere to build up the service level view 
 	newStruct.serviceMap  = make(map[uint16]programDefinition)
+	newStruct.elementaryStreams = make(map[uint16]uint16)
+	newStruct.sections = make(map[uint16]*sectionBuffer)
+	newStruct.crcErrors = make(map[crcErrorKey]uint64)
+	newStruct.versions = make(map[tableKey]*tableVersionState)
+	newStruct.timeline = newSpliceTimeline()
+	newStruct.clock = newWallClock()
+	newStruct.decoders = newDecoderRegistry()
 
 
 	return newStruct
@@ -134,13 +231,27 @@ func newTableParser () tableParser {
 
 // tests if the packet is in the list of "known" siPsi
 // process is
-// at time 0, just know of PATs on PID 0 & SDT on PID 0x12- find these
+// at time 0, just know of PATs on PID 0 & SDT on PID 0x11- find these
 // PAT leads to PMTs
 // until PAT is parsed, you cannot find PMTs as their PID varies
+// PIDs given a TableDecoder are added as soon as it is registered
 // checkForSiPsi is entered pointing at the start of the data just past
-// where the adaptation field data ended.  As long as the PUSI bit is set then
-// a section starts in this TS packet.  IF so, first byte is the payloadOffset.
-// read this, jump to where it points and start parsing
+// where the adaptation field data ended.  The payload is handed to the section
+// assembler for the PID (sectionAssembler.go) which copes with pointer_field,
+// sections running over many packets, many sections in 1 packet and stuffing.
+// Each whole section it finds comes back to processSection
+
+func(tables tableParser) checkForSiPsi(pid uint16, pusi uint8, ccError bool, data[]byte) {
+
+	_, isTable := tables.tablesMap[pid];
+
+	if isTable {
+		tables.assembleSections(pid, pusi, ccError, data)
+	}
+}
+
+
+// processSection is handed 1 complete section, table_id through CRC. It reads
 //  tableID :8
 //  sectionlength :16  (bottom 12 actually )
 //	transportStreamID : 16
@@ -149,48 +260,83 @@ func newTableParser () tableParser {
 // 	sectionNumber : 8
 // 	lastSectionNumber : 8  
 // after this lot - can call specific parsers
+// Tables that span multiple sections have each new section parsed as it arrives, sectionIsNew
+// keeps track of which sections of the table are in
+func(tables tableParser) processSection(pid uint16, section []byte) {
+
+	tableID := tableIDsEnum(section[0])
+	sectionLength := uint16(len(section) - 3)
+
+	if !tables.sectionCRCGood(pid, section) {
+		// bad CRC, already counted and reported. Anything in it could be rubbish so it goes no further
+	} else if tableID == scte35SpliceInfoSection {
+		// splice_info_section doesn't use the long section header so nothing below applies,
+		// it is decoded (scte35Parse.go) and handed on with the whole section
+		event := &SCTE35Event{Position: tables.report.position, ProgramNumber: tables.tablesMap[pid].programNumber}
+		event.Section = append([]byte(nil), section...)
+		splice, err := parseSpliceInfoSection(event.Section)
+		if err != nil {
+			tables.report.raise(SeverityWarning, DiagBadSpliceInfo, "%v", err)
+		} else {
+			event.Splice = splice
+			tables.addSpliceCue(pid, event.ProgramNumber, splice)
+		}
+		for _, handler := range tables.report.handlers {
+			handler.OnSCTE35(event)
+		}
+	} else if tableID == tdtSection || tableID == totSection {
+		// short sections too, and just the time so always worth a look (tdtParse.go)
+		tables.tdtParser(section)
+	} else if !sectionHasCRC(section) && tables.decoders.tableDecoder(pid, section[0]) != nil {
+		// a private short section has no version to track, so each one goes to its decoder
+		tables.privateTableParser(pid, section)
+	} else if sectionLength < 9 {
+		// too short to hold the section header and CRC, so it is not one we can parse
+		tables.report.raise(SeverityWarning, DiagBadSectionLength, "table 0x%x section_length %d too short", uint8(tableID), sectionLength)
+	} else if tables.sectionIsNew(pid, section) {
+		// versionNumber and currentNext are dealt with by sectionIsNew (tableVersions.go), so only
+		// a section that is current and has changed gets this far
+		tableIDExtension := (uint16(section[3]) << 8) | uint16(section[4]) // transportStreamID for PAT / SDT
+		//sectionNumber := uint8(section[6])
+		//lastSectionNumber := (uint8(section[7]))
+		sectionLength -= 5
+		// any registered decoder (privateDecoders.go) sees the section before the built in parsers
+		tables.privateTableParser(pid, section)
+		if tableID == programAssociationSection {
+			 patParser (section[8:], sectionLength, tableIDExtension, tables.tablesMap, tables.serviceMap, tables.report)
+		} else if tableID == ProgramMapSection{
+			// TODO table ID says this is a PMT, was that was the PAT said it was (it lists PMTs)?
+			 programNumber := tables.tablesMap[pid].programNumber
+			 pmtParser (section[8:], sectionLength, tables.tablesMap, tables.serviceMap, programNumber, tables.decoders, tables.report)
+			 tables.refreshElementaryStreams()
+		} else if tableID == sdtSectionActualTransportStream || tableID == sdtSectionOtherTransportStream {
+			tables.sdtParser(pid, section)
+		} else if tableID == batSection {
+			tables.batParser(pid, section)
+		} else if tableID == nitSectionActualNetwork || tableID == nitSectionOtherNetwork {
+			tables.nitParser(pid, section)
+		} else if tableID >= eitPresentFollowingActual && tableID <= eitScheduleOtherLast {
+			tables.eitParser(section)
+		} else if tableID == conditionalAccessSection {
+			tables.catParser(pid, section)
+	   }
+		tables.announceComplete(pid, section)
+	}
+}
 
-// TODO - handle tables that span multiple sections 
-// TODO - tables can span mutiple packets, this is not covered YET
-
-func(tables tableParser) checkForSiPsi(pid uint16, pusi uint8, dataLeft uint8, data[]byte) {
-
-	_, isTable := tables.tablesMap[pid];
 
-	if isTable {
-		if pusi == 1 {
-
-			pointerField := uint8(data[0]) + 1
-			activeData := data[pointerField:]
-			dataLeft -= pointerField
-
-			tableID := tableIDsEnum(activeData[0])
-			sectionLength := ((uint16(activeData[1]) << 8 ) + uint16(activeData[2]) ) & 0x0fff
-
-			if (sectionLength <= uint16(dataLeft)) {
-				// transportStreamID 3, 4
-				// versionNumber := (uint8(activeData[5]) >> 1) & 0x1f
-				// currentNext := (uint8(activeData[5])) & 0x1
-				//sectionNumber := uint8(activeData[6])
-				//lastSectionNumber := (uint8(activeData[7]))
-				sectionLength -= 5
-				dataLeft -= 8
-				if tableID == programAssociationSection {
-					 patParser (activeData[8:], sectionLength, tables.tablesMap, tables.serviceMap)
-					 fmt.Printf("%v \n", tables.tablesMap)
-				} else if tableID == ProgramMapSection{
-					// TODO table ID says this is a PMT, was that was the PAT said it was (it lists PMTs)?
-					 programNumber := tables.tablesMap[pid].programNumber
-					 pmtParser (activeData[8:], sectionLength, tables.tablesMap, tables.serviceMap, programNumber)
-				} else if tableID == sdtSectionActualTransportStream {
-					sdtParser (activeData[8:], sectionLength, tables.serviceMap)
-			   }
-			} else {
-				fmt.Printf("\n [%v] %v %v Table Section Length %v > payload available %v in 1 packet - NOT SUPORTED", pid, pusi, tableID,  sectionLength, dataLeft )
+// work out again which PIDs carry PES, from what the PMTs have told us
+func (tables tableParser) refreshElementaryStreams() {
+	for pid := range tables.elementaryStreams {
+		delete(tables.elementaryStreams, pid)
+	}
+	for programNumber, service := range tables.serviceMap {
+		for _, comp := range service.streamComps {
+			_, isTable := tables.tablesMap[comp.streamPID]
+			if !isTable && !sectionStreamTypes[comp.streamType] {
+				tables.elementaryStreams[comp.streamPID] = programNumber
 			}
 		}
-	} else {
-		fmt.Print(".")
 	}
 }
 
@@ -199,9 +345,10 @@ func(tables tableParser) checkForSiPsi(pid uint16, pusi uint8, dataLeft uint8, d
 // This is parsed to find the PIDS that the Program Map Table (PMT) can be found
 // for the services in this stream.
 // jump here after the tavle upto and including last_section_number
-// TODO  - PATs have a CRC that should be checked for validty.... 
-func patParser (dataBuffer []byte, dataLeft uint16, tableMap  map[uint16]tablesMapEntry, serviceMap map[uint16]programDefinition) {
-	
+// the CRC has already been checked by processSection
+func patParser (dataBuffer []byte, dataLeft uint16, transportStreamID uint16, tableMap  map[uint16]tablesMapEntry, serviceMap map[uint16]programDefinition, report *reporter) {
+
+	event := &PATEvent{Position: report.position, TransportStreamID: transportStreamID}
 	for rd := 0 ; dataLeft > 4; dataLeft -= 4 {
 		programNumber := (uint16(dataBuffer[rd]) << 8) + uint16(dataBuffer[rd+1])
 		pid := ((uint16(dataBuffer[rd+2]) << 8) + uint16(dataBuffer[rd+3])) & 0x1fff
@@ -216,70 +363,59 @@ func patParser (dataBuffer []byte, dataLeft uint16, tableMap  map[uint16]tablesM
 			serviceMap[programNumber] = serviceEntry
 			
 			tableEntry.tabletype = pmtTable
-			fmt.Printf(" \n From PAT :: PMT prog # %d  is 0x%x \n", programNumber, pid)
+			report.raise(SeverityInfo, DiagProgramFound, "PAT lists program %d with its PMT on PID 0x%x", programNumber, pid)
 		}
 		tableEntry.programNumber = programNumber
 		tableMap[pid] = tableEntry
+		event.Programs = append(event.Programs, PATProgram{ProgramNumber: programNumber, PID: pid})
 	}
 
-	// TODO add in a CRC Check here to make sure PAT is valid
+	for _, handler := range report.handlers {
+		handler.OnPAT(event)
+	}
 }
 
 // Program Map Table Parsing
 // The program map is, a map of what PIDs provide components in the program
 // contains descriptors of what "type" services are, PIDs to locate and a PCR reference
-// TODO - really should be checking the CRC, tracking version and handling multi-section PMTs
-// This initial code is only meant for use with SIMPLE streams where the PMT fits in 1 TS packet
-
-func pmtParser (dataBuffer []byte, dataLeft uint16, tableMap  map[uint16]tablesMapEntry, serviceMap map[uint16]programDefinition, programNumber uint16)  {
+// Both loops are length prefixed, and a length that runs past the section stops the parse with a
+// BadTable diagnostic.  Streams before the bad one are kept
+func pmtParser (dataBuffer []byte, dataLeft uint16, tableMap  map[uint16]tablesMapEntry, serviceMap map[uint16]programDefinition, programNumber uint16, decoders *decoderRegistry, report *reporter)  {
 
 	programContainsSCTE35 := false
 	maxBitrate := uint32(0) 
-	pcrPID 	:= ( (uint16(dataBuffer[0]) << 8) | uint16(dataBuffer[1]) ) & 0x1fff
-	programInfoLength := ( (uint16(dataBuffer[2]) << 8) | uint16(dataBuffer[3]) ) & 0x0fff
-	dataLeft -= 4
+	var programCASystems []CADescriptor
 
-	descriptorDataLeft :=  programInfoLength
-	nextDescriptorStart := 4  	// we start the first desriptor after using 4 bytes of data passed in
-	progInfoBuffer := dataBuffer[(programInfoLength + 4):]
-	
-	// first get the program level descriptors
-	if programInfoLength != 0 {
-		for descriptorDataLeft != 0 {
-			rd := nextDescriptorStart
-			tag := uint8(dataBuffer[rd])
-			length := uint8(dataBuffer[rd+1])
-			rd += 2
-			nextDescriptorStart += int(length + 2) // +2 as jumping body + tag +length field
-			descriptorDataLeft  -= uint16(length + 2)
-			if (tag == 5) {
-				if (length == 4) {
-					id := ( (uint32(dataBuffer[rd+0]) << 24) |
-							(uint32(dataBuffer[rd+1]) << 16) |
-							(uint32(dataBuffer[rd+2]) <<  8) |
-							(uint32(dataBuffer[rd+3]) <<  0) )
-					if id == 0x43554549 {
-						programContainsSCTE35 = true;
-						fmt.Println(" SCTE-35 descriptor seen")
-					}
-				} else {
-					fmt.Println(" SCTE-35 Tag found, length wrong") // TODO raise error
-				}
-			} else if tag == 14 {
-				if (length == 0x3) {
-
-					maxBitrate := (( (uint32(dataBuffer[rd+0]) << 16) |
-									 (uint32(dataBuffer[rd+1]) <<  8) |
-									 (uint32(dataBuffer[rd+2]) <<  0) ) & 0x3fffff ) * 50*8
-					fmt.Printf(" \n MaxBitrate descriptor %d \n",  maxBitrate)
-				} else {
-					fmt.Println(" MaxBitrate descriptor  Tag found, length wrong") // TODO raise error
-				} 
+	// CRC is last 4 bytes, already checked by processSection
+	body := dataBuffer[:dataLeft-4]
+	if len(body) < 4 {
+		report.raise(SeverityWarning, DiagBadTable, "program %d PMT section of %d bytes is too short", programNumber, len(dataBuffer)+8)
+		return
+	}
+	pcrPID 	:= ( (uint16(body[0]) << 8) | uint16(body[1]) ) & 0x1fff
+	programInfo, esLoop, err := lengthPrefixedLoop(body[2:])
+	if err != nil {
+		report.raise(SeverityWarning, DiagBadTable, "program %d PMT program_info: %v", programNumber, err)
+		return
+	}
+
+	// first get the program level descriptors (pmtDescriptors.go)
+	programDescriptors, err := parsePMTDescriptors(programInfo, decoders)
+	if err != nil {
+		report.raise(SeverityWarning, DiagBadDescriptor, "program %d %v", programNumber, err)
+	}
+	for _, descriptor := range programDescriptors {
+		switch value := descriptor.Value.(type) {
+		case *RegistrationDescriptor:
+			if value.FormatIdentifier == cueIdentifier {
+				programContainsSCTE35 = true
 			}
+		case *MaximumBitrateDescriptor:
+			maxBitrate = value.Bitrate
+		case CADescriptor:
+			programCASystems = append(programCASystems, value)
 		}
 	}
-	// Program Info loop
-	dataLeft -= programInfoLength
 
 	serviceEntry := serviceMap[programNumber]
 	// TODO create an interface to craete these structure and make a 0 length list in side, as opposed to needing to do
@@ -289,116 +425,79 @@ func pmtParser (dataBuffer []byte, dataLeft uint16, tableMap  map[uint16]tablesM
 	serviceEntry.programHasSCTE35  = programContainsSCTE35
 	serviceEntry.definedMaxBitrate = maxBitrate
 	serviceEntry.numberOfStreams = 0
-	serviceEntry.serviceName = "not-Seen-SDT-Yet"
+	serviceEntry.caSystems = programCASystems
+	serviceEntry.descriptors = programDescriptors
+	// a new PMT version doesn't mean a new name, and the SDT is only parsed again when it changes
+	if serviceEntry.serviceName == "" {
+		serviceEntry.serviceName = "not-Seen-SDT-Yet"
+	}
 
 	streamDef := streamComponentDefinition {}
-	rd := 0	
-
-	// TODO - are these structure deepcopied over, or just the pointer in memory ?
-	for dataLeft > 4 {
 
-		streamDef.streamType = uint8(progInfoBuffer[rd+0])
-		streamDef.streamPID  = ( (uint16(progInfoBuffer[rd+1]) << 8) |
-							     (uint16(progInfoBuffer[rd+2]) << 0) ) & 0x1fff
+	for rd := 0; rd < len(esLoop); {
+		if rd+5 > len(esLoop) {
+			report.raise(SeverityWarning, DiagBadTable, "program %d PMT stream entry runs past the end of the section", programNumber)
+			break
+		}
+		streamDef.streamType = uint8(esLoop[rd+0])
+		streamDef.streamPID  = ( (uint16(esLoop[rd+1]) << 8) |
+							     (uint16(esLoop[rd+2]) << 0) ) & 0x1fff
 		streamDef.cueDescriptor = false
-		dataLeft -= 3
+		streamDef.caSystems = nil
+		streamDef.descriptors = nil
 
-		esInfoLength := ( (uint16(progInfoBuffer[rd+3]) << 8) |
-						  (uint16(progInfoBuffer[rd+4]) << 0) ) & 0x0fff
-		dataLeft -= 2
-		
-		rd += 5
-		serviceEntry.streamComps = append(serviceEntry.streamComps, streamDef)
+		esInfo, _, err := lengthPrefixedLoop(esLoop[rd+3:])
+		if err != nil {
+			report.raise(SeverityWarning, DiagBadTable, "program %d PMT PID 0x%x ES_info: %v", programNumber, streamDef.streamPID, err)
+			break
+		}
 
-		// the only stream type sought is cue descriptors, ie SCTE35 stuff.   Parse through 
-		// the data to check for them
-		{
-			// look for cue descriptors in the elementary stream descriptors
-			descriptorLength := esInfoLength;
-			descStart := rd
-			for descriptorLength > 0 {
-				tag := uint8(progInfoBuffer[descStart])
-				length := uint8(progInfoBuffer[descStart+1])
-		 		if tag == 0x8a {
-		 			streamDef.cueDescriptor = true
-		 			if programContainsSCTE35 {
-						tablesEntry := tableMap[streamDef.streamPID] 
-						tablesEntry.tabletype = scte35Table
-						tablesEntry.programNumber = programNumber
-						tableMap[streamDef.streamPID] = tablesEntry
-		 			}
-		 		} 
-		 		descStart += int(length + 2)
-		 		descriptorLength -= uint16(1 + 1 + length);
-		 	}
+		// the descriptors (pmtDescriptors.go) say if the stream carries SCTE35 cues and which
+		// CA systems protect it
+		descriptors, err := parsePMTDescriptors(esInfo, decoders)
+		if err != nil {
+			report.raise(SeverityWarning, DiagBadDescriptor, "program %d PID 0x%x %v", programNumber, streamDef.streamPID, err)
 		}
-		rd += int(esInfoLength)
-		dataLeft -= esInfoLength;
+		streamDef.descriptors = descriptors
+		for _, descriptor := range descriptors {
+			if descriptor.Tag == 0x8a {
+				streamDef.cueDescriptor = true
+				if programContainsSCTE35 {
+					tablesEntry := tableMap[streamDef.streamPID]
+					tablesEntry.tabletype = scte35Table
+					tablesEntry.programNumber = programNumber
+					tableMap[streamDef.streamPID] = tablesEntry
+				}
+			} else if ca, isCA := descriptor.Value.(CADescriptor); isCA {
+				streamDef.caSystems = append(streamDef.caSystems, ca)
+			}
+		}
+		// appended as a copy, so only once the descriptors have had their say
+		serviceEntry.streamComps = append(serviceEntry.streamComps, streamDef)
+		rd += 5 + len(esInfo)
 	}
 
 	serviceMap[programNumber] = serviceEntry
 
-	// TODO - catch system if number programs is exploding on us
-
-// CRC is last 4 bytes, ignore for now    TODO - handle and check CRCs
-}
-
-
-
-
-// Parse the SDT 
-func sdtParser (dataBuffer []byte, dataLeft uint16, serviceMap map[uint16]programDefinition) {
-
-	rd := 0
-	rd += 3 //  ignore original_network_id :16 and reserved_future_use :8 
-	dataLeft -= 3
-
-	for dataLeft > 4 {
-		serviceID := (uint16(dataBuffer[rd]) << 8) | uint16(dataBuffer[rd+1])
-		dataLeft -= 2
-
-		// ignore  reserved_future_use :6, EIT_schedule_flag :1  EIT_present_following_flag : 1 
-		dataLeft -= 1
-
-		desriptorLength := ( (uint16(dataBuffer[rd+3]) << 8) | uint16(dataBuffer[rd+4])  ) & 0x0fff
-		dataLeft -= 2
-		
-		bytesAvailable := int(desriptorLength)
-		descriptorRd := rd + 5
-
-		for bytesAvailable > 0 {
-			descriptorTag := uint8(dataBuffer[descriptorRd])
-			length := uint8(dataBuffer[descriptorRd + 1])
-
-			if descriptorTag == 0x48 {
-				serviceProviderNameLength := uint8(dataBuffer[descriptorRd + 3]) // ignore service type - so +3
-				serviceNameLength := uint8(dataBuffer[descriptorRd + 3 + 1 + int(serviceProviderNameLength)])
-				serviceNameStart := (descriptorRd + 3 + 1 + int(serviceProviderNameLength) + 1 )
-				serviceName := string( dataBuffer[serviceNameStart : serviceNameStart + int(serviceNameLength) ] )
-				fmt.Printf("\n SDT : [%d] :: %s  ",serviceID,  serviceName)
-
-				serviceEntry := serviceMap[serviceID]
-				serviceEntry.serviceName = serviceName
-				serviceMap[serviceID] = serviceEntry
-			}
-			descriptorRd += int(length + 2)
-			bytesAvailable -= int(length + 2)
-		}
-
-		rd += int(desriptorLength)
-		dataLeft -= uint16(desriptorLength)
+	// the handlers get copies, the service entry keeps what it has
+	event := &PMTEvent{Position: report.position, ProgramNumber: programNumber, PCRPID: pcrPID, HasSCTE35: programContainsSCTE35, MaxBitrate: maxBitrate,
+						CASystems: copyCASystems(programCASystems), Descriptors: copyDescriptors(programDescriptors)}
+	for _, comp := range serviceEntry.streamComps {
+		event.Streams = append(event.Streams, PMTStream{StreamType: comp.streamType, PID: comp.streamPID, CueDescriptor: comp.cueDescriptor,
+												CASystems: copyCASystems(comp.caSystems), Descriptors: copyDescriptors(comp.descriptors)})
+	}
+	for _, handler := range report.handlers {
+		handler.OnPMT(event)
 	}
 
-	//TODO HANDLE THE crc 
-
+	// TODO - catch system if number programs is exploding on us
 }
 
 
-// display the contents of the service List
-func(tables tableParser) summariseServiceList () {
 
-	var streamTypeStringMapping map[uint8]string
-	streamTypeStringMapping = map[uint8]string { 	0x1 : "Mpeg1 Video",
+
+// human readable names for the stream_type values we are likely to meet
+var streamTypeStringMapping = map[uint8]string { 	0x1 : "Mpeg1 Video",
 													0x2 : "Mpeg2 Video",
 													0x3 : "Mpeg1 Layer2 Audio",
 													0x4 : "Mpeg2 Audio",
@@ -409,8 +508,11 @@ func(tables tableParser) summariseServiceList () {
 													0x24 : "HEVC",
 													0x81 : "AC-3 (ATSC)",
 													0x86 : "SCTE-35",
-												    0x87 : "DDPlus "}
-	
+												    0x87 : "DDPlus"}
+
+// display the contents of the service List
+func(tables tableParser) summariseServiceList () {
+
 	fmt.Printf(" %v ", streamTypeStringMapping[6])
 	
 
@@ -0,0 +1,30 @@
+package tshelper
+
+import (
+	"testing"
+)
+
+// a PMT whose lengths run past the section raises BadTable, and keeps the streams before the damage
+func TestPMTMalformed(t *testing.T) {
+	video := []byte{0x1b, 0xe1, 0x01, 0xf0, 0}
+	for _, test := range []struct {
+		name    string
+		body    []byte
+		streams int
+	}{
+		{"too short", []byte{0xe1, 0x01, 0xf0}, 0},
+		{"program_info_length too long", []byte{0xe1, 0x01, 0xf0, 0x55, 0x05, 0x00}, 0},
+		{"ES_info_length too long", append(append([]byte{0xe1, 0x01, 0xf0, 0}, video...), 0x0f, 0xe1, 0x02, 0xf0, 0x44, 0x0a, 0x04), 1},
+		{"stream entry cut short", append(append([]byte{0xe1, 0x01, 0xf0, 0}, video...), 0x0f, 0xe1, 0x02, 0xf0), 1},
+	} {
+		tables, diagnostics, _ := testSectionTables()
+		tables.tablesMap[0x100] = tablesMapEntry{tabletype: pmtTable, programNumber: 1}
+		tables.processSection(0x100, testLongSection(0x02, 1, 0, 0, 0, test.body))
+		if diagnostics.count(DiagBadTable) != 1 {
+			t.Errorf("%s: diagnostics %v", test.name, *diagnostics)
+		}
+		if streams := len(tables.serviceMap[1].streamComps); streams != test.streams {
+			t.Errorf("%s: %d streams, expected %d", test.name, streams, test.streams)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package tshelper
+
+// SCTE-35 splice timeline
+// Every timed splice (splice_insert or time_signal) is placed on its program's clock.  When the
+// cue arrives, the splice PTS (pts_adjustment already added) is compared with the last PCR on
+// the program's PCR PID to give the pre-roll, how long the downstream splicer has to get ready.
+// SCTE 67 asks for at least 4 seconds, anything less is flagged as late, and a splice time the
+// PCR has already gone past can't be acted on at all.
+// The cue then waits for the first picture on the program's video PID at or after the splice
+// PTS.  A clean splice needs that picture to be a random access point sitting right on the
+// splice time, an IDR for H.264 / HEVC or an I picture for MPEG-2 video
+
+import (
+	"time"
+)
+
+const (
+	// SCTE 67 minimum pre-roll, 4 seconds at 90kHz
+	spliceMinimumPreroll = 4 * 90000
+
+	// splice PTS and picture PTS may differ by a rounding error, 1ms at 90kHz
+	spliceAlignmentTolerance = 90
+
+	// cues kept for the report, the oldest go first after this many
+	maxSpliceCues = 10000
+)
+
+// SpliceCueReport is 1 timed splice placed on its program's timeline.  Times are 90kHz ticks.
+// Preroll is only meaningful with HasArrivalPCR, the video fields only once VideoChecked
+type SpliceCueReport struct {
+	ProgramNumber uint16    `json:"programNumber"`
+	PID           uint16    `json:"pid"`
+	PacketIndex   uint64    `json:"packetIndex"`
+	Offset        uint64    `json:"offset"`
+	UTC           time.Time `json:"utc"` // when the cue arrived, zero without a TDT / TOT
+	Command       string    `json:"command"`
+	SpliceEventID uint32    `json:"spliceEventId,omitempty"` // splice_insert only
+	OutOfNetwork  bool      `json:"outOfNetwork,omitempty"`
+	Immediate     bool      `json:"immediate"` // no splice time, splice as soon as the cue arrives
+	SplicePTS     uint64    `json:"splicePts"`
+	HasArrivalPCR bool      `json:"hasArrivalPcr"`
+	ArrivalPCR    uint64    `json:"arrivalPcr"` // PCR base when the cue arrived
+	Preroll       int64     `json:"preroll"`    // splice PTS less arrival PCR
+	Late          bool      `json:"late"`       // pre-roll short of the SCTE 67 minimum
+	AlreadyPassed bool      `json:"alreadyPassed"`
+	VideoChecked  bool      `json:"videoChecked"`
+	VideoPTS      uint64    `json:"videoPts"`    // first picture at or after the splice PTS
+	VideoOffset   int64     `json:"videoOffset"` // video PTS less splice PTS
+	IDRAtSplice   bool      `json:"idrAtSplice"`
+}
+
+// shared (by pointer) between the tsdmx, which sees the PCRs and PES, and the tableParser, which
+// sees the cues
+type spliceTimeline struct {
+	lastPCR map[uint16]uint64 // latest PCR on each PID carrying them, 27MHz
+	cues    []*SpliceCueReport
+}
+
+func newSpliceTimeline() *spliceTimeline {
+	return &spliceTimeline{lastPCR: make(map[uint16]uint64)}
+}
+
+// video stream types that random access points can be found in
+func isVideoStreamType(streamType uint8) bool {
+	switch streamType {
+	case 0x01, 0x02, 0x1b, 0x24:
+		return true
+	}
+	return false
+}
+
+// place a newly arrived splice on its program's timeline
+func (tables tableParser) addSpliceCue(pid uint16, programNumber uint16, splice *SpliceInfoSection) {
+	cue := &SpliceCueReport{
+		ProgramNumber: programNumber,
+		PID:           pid,
+		PacketIndex:   tables.report.position.PacketIndex,
+		Offset:        tables.report.position.Offset,
+		UTC:           tables.report.position.UTC,
+		Command:       splice.CommandType.String(),
+	}
+	var spliceTime *SpliceTime
+	switch {
+	case splice.Insert != nil:
+		if splice.Insert.CancelIndicator {
+			return
+		}
+		cue.SpliceEventID = splice.Insert.SpliceEventID
+		cue.OutOfNetwork = splice.Insert.OutOfNetwork
+		spliceTime = splice.Insert.Time
+		for i := 0; spliceTime == nil && i < len(splice.Insert.Components); i++ {
+			spliceTime = splice.Insert.Components[i].Time // component mode, go by the first
+		}
+	case splice.TimeSignal != nil:
+		spliceTime = splice.TimeSignal
+	default:
+		return // nothing with a time on the program's clock
+	}
+
+	timeline := tables.timeline
+	if len(timeline.cues) >= maxSpliceCues {
+		timeline.cues = timeline.cues[1:]
+	}
+	timeline.cues = append(timeline.cues, cue)
+	if spliceTime == nil || !spliceTime.Specified {
+		cue.Immediate = true
+		return
+	}
+	cue.SplicePTS = spliceTime.PTS
+
+	pcr, havePCR := timeline.lastPCR[tables.serviceMap[programNumber].pcrPID]
+	if !havePCR {
+		return
+	}
+	cue.HasArrivalPCR = true
+	cue.ArrivalPCR = (pcr / 300) & timestampMask
+	cue.Preroll = timestampDelta(cue.ArrivalPCR, cue.SplicePTS)
+	if cue.Preroll <= 0 {
+		cue.AlreadyPassed = true
+		tables.report.raise(SeverityWarning, DiagSplicePassed, "%v for PTS %d arrived %d ticks after the splice time", splice.CommandType, cue.SplicePTS, -cue.Preroll)
+	} else if cue.Preroll < spliceMinimumPreroll {
+		cue.Late = true
+		tables.report.raise(SeverityWarning, DiagLateSpliceCue, "%v for PTS %d has %d ticks of pre-roll, less than the %d asked for", splice.CommandType, cue.SplicePTS, cue.Preroll, spliceMinimumPreroll)
+	}
+}
+
+// a video PES on programNumber, see if it settles where any waiting splices land
+func (tables tableParser) checkSpliceCues(programNumber uint16, streamType uint8, pes *PESPacket, position Position) {
+	if !pes.HasPTS || !isVideoStreamType(streamType) {
+		return
+	}
+	for _, cue := range tables.timeline.cues {
+		if cue.ProgramNumber != programNumber || cue.VideoChecked || cue.Immediate {
+			continue
+		}
+		offset := timestampDelta(cue.SplicePTS, pes.PTS)
+		if offset < -spliceAlignmentTolerance {
+			continue // splice still to come
+		}
+		cue.VideoChecked = true
+		cue.VideoPTS = pes.PTS
+		cue.VideoOffset = offset
+		cue.IDRAtSplice = offset <= spliceAlignmentTolerance && pesStartsRandomAccess(streamType, pes.Payload)
+		if !cue.IDRAtSplice && !cue.AlreadyPassed {
+			tables.report.raiseAt(position, SeverityWarning, DiagSpliceNotOnIDR, "splice at PTS %d, first picture at or after it is PTS %d and not a random access point there", cue.SplicePTS, pes.PTS)
+		}
+	}
+}
+
+// does the first picture in a video PES start a random access point - IDR for H.264 and HEVC,
+// an I picture for MPEG-2
+func pesStartsRandomAccess(streamType uint8, payload []byte) bool {
+	for i := 0; i+4 < len(payload); i++ {
+		if payload[i] != 0 || payload[i+1] != 0 || payload[i+2] != 1 {
+			continue
+		}
+		code := payload[i+3]
+		switch streamType {
+		case 0x1b:
+			nalType := code & 0x1f
+			if nalType >= 1 && nalType <= 5 {
+				return nalType == 5 // first slice of the picture
+			}
+		case 0x24:
+			nalType := (code >> 1) & 0x3f
+			if nalType <= 31 {
+				return nalType == 19 || nalType == 20
+			}
+		default:
+			if code == 0x00 && i+5 < len(payload) { // picture_start_code
+				return (payload[i+5]>>3)&0x7 == 1
+			}
+		}
+		i += 2
+	}
+	return false
+}
+
+func (timeline *spliceTimeline) addToReport(report *Report) {
+	report.SpliceCues = make([]SpliceCueReport, 0, len(timeline.cues))
+	for _, cue := range timeline.cues {
+		report.SpliceCues = append(report.SpliceCues, *cue)
+	}
+}
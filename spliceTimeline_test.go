@@ -0,0 +1,112 @@
+package tshelper
+
+import (
+	"testing"
+)
+
+func TestSpliceCuePlacement(t *testing.T) {
+	const second = 90000
+	const wrap = timestampMask + 1
+	idr := []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x65, 0x88, 0x84}
+	nonIDR := []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x41, 0x9a, 0x02}
+	timeSignal := func(ptsAdjustment, ptsTime uint64) []byte {
+		return testSpliceSection(ptsAdjustment, SpliceCommandTimeSignal, []byte{0xfe | uint8(ptsTime>>32), uint8(ptsTime >> 24), uint8(ptsTime >> 16), uint8(ptsTime >> 8), uint8(ptsTime)}, nil)
+	}
+
+	for _, test := range []struct {
+		name     string
+		pcr      uint64 // PCR base before the cue, 0 for none
+		cue      []byte
+		videoPTS uint64
+		video    []byte
+		code     DiagnosticCode // the splice diagnostic raised, 0 for none
+		expected SpliceCueReport
+	}{
+		{"on time on an IDR", 10 * second, timeSignal(0, 15*second), 15 * second, idr, 0,
+			SpliceCueReport{SplicePTS: 15 * second, HasArrivalPCR: true, ArrivalPCR: 10 * second, Preroll: 5 * second,
+				VideoChecked: true, VideoPTS: 15 * second, IDRAtSplice: true}},
+		{"picture within the tolerance", 10 * second, timeSignal(0, 15*second), 15*second + 90, idr, 0,
+			SpliceCueReport{SplicePTS: 15 * second, HasArrivalPCR: true, ArrivalPCR: 10 * second, Preroll: 5 * second,
+				VideoChecked: true, VideoPTS: 15*second + 90, VideoOffset: 90, IDRAtSplice: true}},
+		{"late", 10 * second, timeSignal(0, 12*second), 12 * second, idr, DiagLateSpliceCue,
+			SpliceCueReport{SplicePTS: 12 * second, HasArrivalPCR: true, ArrivalPCR: 10 * second, Preroll: 2 * second, Late: true,
+				VideoChecked: true, VideoPTS: 12 * second, IDRAtSplice: true}},
+		{"already passed", 10 * second, timeSignal(0, 9*second), 10 * second, nonIDR, DiagSplicePassed,
+			SpliceCueReport{SplicePTS: 9 * second, HasArrivalPCR: true, ArrivalPCR: 10 * second, Preroll: -second, AlreadyPassed: true,
+				VideoChecked: true, VideoPTS: 10 * second, VideoOffset: second}},
+		{"splice time wraps with pts_adjustment", wrap - 10000, timeSignal(460000, wrap-101), 459899, idr, 0,
+			SpliceCueReport{SplicePTS: 459899, HasArrivalPCR: true, ArrivalPCR: wrap - 10000, Preroll: 469899,
+				VideoChecked: true, VideoPTS: 459899, IDRAtSplice: true}},
+		{"not on an IDR", 10 * second, timeSignal(0, 15*second), 15 * second, nonIDR, DiagSpliceNotOnIDR,
+			SpliceCueReport{SplicePTS: 15 * second, HasArrivalPCR: true, ArrivalPCR: 10 * second, Preroll: 5 * second,
+				VideoChecked: true, VideoPTS: 15 * second}},
+		{"IDR after the splice time", 10 * second, timeSignal(0, 15*second), 15*second + 3000, idr, DiagSpliceNotOnIDR,
+			SpliceCueReport{SplicePTS: 15 * second, HasArrivalPCR: true, ArrivalPCR: 10 * second, Preroll: 5 * second,
+				VideoChecked: true, VideoPTS: 15*second + 3000, VideoOffset: 3000}},
+		{"video still before the splice", 10 * second, timeSignal(0, 15*second), 14 * second, idr, 0,
+			SpliceCueReport{SplicePTS: 15 * second, HasArrivalPCR: true, ArrivalPCR: 10 * second, Preroll: 5 * second}},
+		{"no PCR yet", 0, timeSignal(0, 15*second), 15 * second, idr, 0,
+			SpliceCueReport{SplicePTS: 15 * second, VideoChecked: true, VideoPTS: 15 * second, IDRAtSplice: true}},
+		{"immediate splice_insert", 10 * second, testSpliceSection(0, SpliceCommandInsert, []byte{0, 0, 0, 1, 0x7f, 0xdf, 0, 0, 0, 0}, nil), 15 * second, nonIDR, 0,
+			SpliceCueReport{Command: "splice_insert", SpliceEventID: 1, OutOfNetwork: true, Immediate: true}},
+	} {
+		stream := newTestStream()
+		stream.section(0, testPAT())
+		// CUEI registration_descriptor for the program, H.264 video and PCR on 0x101, cues on 0x102
+		pmt := []byte{0xe1, 0x01, 0xf0, 6, 0x05, 4, 'C', 'U', 'E', 'I', 0x1b, 0xe1, 0x01, 0xf0, 0, 0x86, 0xe1, 0x02, 0xf0, 3, 0x8a, 1, 0}
+		stream.section(0x100, testLongSection(0x02, 1, 0, 0, 0, pmt))
+		if test.pcr != 0 {
+			stream.packet(0x101, false, testPCRAdaptation(test.pcr*300), nil)
+		}
+		stream.section(0x102, test.cue)
+		stream.pes(0x101, testPES(0xe0, test.videoPTS, 0, test.video, true))
+		stream.padding(3)
+		demuxer, diagnostics := newTestDemuxer()
+		feedTestStream(t, demuxer, stream)
+
+		cues := demuxer.Report().SpliceCues
+		if len(cues) != 1 {
+			t.Errorf("%s: %d cues, expected 1", test.name, len(cues))
+			continue
+		}
+		cue := cues[0]
+		cue.PacketIndex, cue.Offset = 0, 0
+		expected := test.expected
+		expected.ProgramNumber, expected.PID = 1, 0x102
+		if expected.Command == "" {
+			expected.Command = "time_signal"
+		}
+		if cue != expected {
+			t.Errorf("%s: cue %+v, expected %+v", test.name, cue, expected)
+		}
+		for _, code := range []DiagnosticCode{DiagLateSpliceCue, DiagSplicePassed, DiagSpliceNotOnIDR} {
+			if raised, expected := diagnostics.count(code), code == test.code; (raised == 1) != expected || raised > 1 {
+				t.Errorf("%s: %d %v, expected %v", test.name, raised, code, expected)
+			}
+		}
+	}
+}
+
+func TestPESStartsRandomAccess(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		streamType uint8
+		payload    []byte
+		expected   bool
+	}{
+		{"H.264 IDR after an access unit delimiter", 0x1b, []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x65, 0x88, 0x84}, true},
+		{"H.264 IDR after SPS and PPS", 0x1b, []byte{0, 0, 1, 0x67, 0x64, 0x00, 0x28, 0, 0, 1, 0x68, 0xee, 0x3c, 0, 0, 1, 0x65, 0x88}, true},
+		{"H.264 non-IDR slice", 0x1b, []byte{0, 0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x41, 0x9a, 0x02}, false},
+		{"HEVC IDR_W_RADL", 0x24, []byte{0, 0, 1, 0x46, 0x01, 0x10, 0, 0, 1, 0x26, 0x01, 0xaf}, true},
+		{"HEVC IDR_N_LP", 0x24, []byte{0, 0, 1, 0x28, 0x01, 0xaf, 0x1d}, true},
+		{"HEVC TRAIL_R", 0x24, []byte{0, 0, 1, 0x46, 0x01, 0x10, 0, 0, 1, 0x02, 0x01, 0xd0}, false},
+		{"MPEG-2 I picture after a sequence header", 0x02, []byte{0, 0, 1, 0xb3, 0x14, 0x00, 0xf0, 0, 0, 1, 0x00, 0x00, 0x0f, 0xff, 0xf8}, true},
+		{"MPEG-2 P picture", 0x02, []byte{0, 0, 1, 0x00, 0x00, 0x17, 0xff, 0xf8}, false},
+		{"no start code", 0x1b, []byte{1, 2, 3, 4, 5, 6}, false},
+		{"empty", 0x1b, nil, false},
+	} {
+		if got := pesStartsRandomAccess(test.streamType, test.payload); got != test.expected {
+			t.Errorf("%s: %v, expected %v", test.name, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package tshelper
+
+// sync byte acquisition and tracking
+// A TS packet always starts 0x47, but so can any other byte, so a single 0x47 proves nothing.
+// We hunt for a run of lockCount 0x47s each 1 packet apart (188, 192 or 204 bytes, see
+// packetFormat.go) before believing we are aligned,
+// then stay locked until a packet turns up that doesn't start with 0x47.  A blob too short to hold
+// lockCount packets is locked to if it starts with 0x47 and every packet start in it is one, as
+// there is nothing more to prove it with.  At that point we
+// drop back to hunting from the next byte on.  Every lock / loss is recorded with where it
+// happened so damaged captures can be looked at afterwards
+
+const (
+	tsSyncByte = 0x47
+
+	// consecutive sync bytes wanted before we call it locked. 3 is the usual choice, enough that
+	// random payload 0x47s very rarely fool us while costing little at the start of a stream
+	defaultSyncLockCount = 3
+)
+
+// SyncEventKind says whether a SyncEvent is the demux locking on to the stream or losing it
+type SyncEventKind uint8
+
+const (
+	SyncAcquired SyncEventKind = iota
+	SyncLost
+)
+
+func (kind SyncEventKind) String() string {
+	switch kind {
+	case SyncAcquired:
+		return "SyncAcquired"
+	case SyncLost:
+		return "SyncLost"
+	}
+	return "unknown"
+}
+
+// MarshalText lets the kind go into JSON (and friends) by name
+func (kind SyncEventKind) MarshalText() ([]byte, error) {
+	return []byte(kind.String()), nil
+}
+
+// SyncEvent records a change in sync state and where in the stream it happened
+type SyncEvent struct {
+	Kind    SyncEventKind `json:"kind"`
+	Offset  uint64        `json:"offset"`            // stream byte offset of the first locked packet unit, or of the byte that broke sync
+	Packet  uint64        `json:"packet"`            // number of packets demuxed before the event
+	Skipped uint64        `json:"skipped,omitempty"` // SyncAcquired only - bytes thrown away while hunting
+}
+
+// state of the sync state machine, held by pointer in tsdmx so it lives across calls
+type syncTracker struct {
+	locked       bool
+	lockCount    int
+	forcedFormat PacketFormat // PacketFormatAuto unless the caller has said what to expect
+	format       PacketFormat // format of the packets we are locked to
+	huntStart    uint64       // stream offset where the current hunt began
+	events       []SyncEvent
+}
+
+func newSyncTracker() *syncTracker {
+	return &syncTracker{lockCount: defaultSyncLockCount}
+}
+
+// hunt looks through data for the first place a run of lockCount sync bytes, 1 packet apart, starts.
+// found says if one was, offset is where the packet unit starts (for M2TS that is the timestamp, 4 bytes
+// before the 0x47) and format is the packet format the run was found with.  When not found, offset is
+// how much of data can be thrown away - bytes from offset on might still turn out to be a packet start
+// once more data arrives
+func (tracker *syncTracker) hunt(data []byte) (offset int, format PacketFormat, found bool) {
+	formats := detectablePacketFormats
+	if tracker.forcedFormat != PacketFormatAuto {
+		formats = []PacketFormat{tracker.forcedFormat}
+	}
+	for candidate := 0; candidate < len(data); candidate++ {
+		if data[candidate] != tsSyncByte {
+			continue
+		}
+		// the formats go smallest unit first, so once one runs out of data the bigger ones would too
+		for _, format := range formats {
+			unitStart := candidate - format.syncOffset()
+			if unitStart < 0 {
+				continue
+			}
+			confirmed := true
+			for n := 1; n < tracker.lockCount; n++ {
+				next := candidate + (n * format.unitSize())
+				if next >= len(data) {
+					// ran out of data before we could decide, so keep it all from here (allowing
+					// for an M2TS timestamp in front)
+					keep := candidate - PacketFormatM2TS.syncOffset()
+					if keep < 0 {
+						keep = 0
+					}
+					return keep, PacketFormatAuto, false
+				}
+				if data[next] != tsSyncByte {
+					confirmed = false
+					break
+				}
+			}
+			if confirmed {
+				return unitStart, format, true
+			}
+		}
+	}
+	return len(data), PacketFormatAuto, false
+}
+
+// alignedShort is for data too short for hunt to decide on.  found says if it starts with a packet
+// unit and every packet start in it (including that of a partial packet at the end) is a sync
+// byte, format is the packet format that holds for
+func (tracker *syncTracker) alignedShort(data []byte) (format PacketFormat, found bool) {
+	formats := detectablePacketFormats
+	if tracker.forcedFormat != PacketFormatAuto {
+		formats = []PacketFormat{tracker.forcedFormat}
+	}
+	for _, format := range formats {
+		if len(data) < format.unitSize() {
+			continue
+		}
+		aligned := true
+		for next := format.syncOffset(); next < len(data); next += format.unitSize() {
+			if data[next] != tsSyncByte {
+				aligned = false
+				break
+			}
+		}
+		if aligned {
+			return format, true
+		}
+	}
+	return PacketFormatAuto, false
+}
+
+func (tracker *syncTracker) acquired(offset uint64, packet uint64, format PacketFormat) {
+	tracker.locked = true
+	tracker.format = format
+	tracker.events = append(tracker.events, SyncEvent{Kind: SyncAcquired, Offset: offset, Packet: packet, Skipped: offset - tracker.huntStart})
+}
+
+// offset is the byte that broke sync, huntFrom is where hunting starts again
+func (tracker *syncTracker) lost(offset uint64, huntFrom uint64, packet uint64) {
+	tracker.locked = false
+	tracker.huntStart = huntFrom
+	tracker.events = append(tracker.events, SyncEvent{Kind: SyncLost, Offset: offset, Packet: packet})
+}
+
+// SetSyncLockCount sets how many consecutive sync bytes are needed to (re)lock, minimum 1
+func (metaInfo tsdmx) SetSyncLockCount(count int) {
+	if count < 1 {
+		count = 1
+	}
+	metaInfo.sync.lockCount = count
+}
+
+// SyncEvents lists every sync acquire / loss seen so far, oldest first
+func (metaInfo tsdmx) SyncEvents() []SyncEvent {
+	events := make([]SyncEvent, len(metaInfo.sync.events))
+	copy(events, metaInfo.sync.events)
+	return events
+}
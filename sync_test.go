@@ -0,0 +1,104 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	stream := newTestStream()
+	stream.padding(5)
+	junk := []byte{0x00, 0x47, 0x12, 0x34, 0x47} // including stray sync bytes
+	// a damaged packet, 3 bytes short, between 2 good runs.  Hunting starts again from the byte after
+	// the one that broke sync
+	damaged := append(append(append([]byte(nil), stream.data[:4*tsPacketSize]...), make([]byte, tsPacketSize-3)...), stream.data[:4*tsPacketSize]...)
+
+	for _, test := range []struct {
+		name      string
+		data      []byte
+		chunk     int // bytes fed at a time, 0 for all at once
+		lockCount int
+		events    []SyncEvent
+		packets   uint64
+	}{
+		{"aligned", stream.data, 0, 3, []SyncEvent{{Kind: SyncAcquired}}, 5},
+		{"junk in front", append(append([]byte(nil), junk...), stream.data...), 0, 3, []SyncEvent{{Kind: SyncAcquired, Offset: 5, Skipped: 5}}, 5},
+		{"loss and relock", damaged, 0, 3, []SyncEvent{
+			{Kind: SyncAcquired},
+			{Kind: SyncLost, Offset: 4 * tsPacketSize, Packet: 4},
+			{Kind: SyncAcquired, Offset: 5*tsPacketSize - 3, Packet: 4, Skipped: tsPacketSize - 4},
+		}, 8},
+		{"1 packet", stream.data[:tsPacketSize], 0, 3, []SyncEvent{{Kind: SyncAcquired}}, 1},
+		{"2 packets", stream.data[:2*tsPacketSize], 0, 3, []SyncEvent{{Kind: SyncAcquired}}, 2},
+		{"too few packets to lock", append(append([]byte(nil), junk...), stream.data[:3*tsPacketSize]...), 0, 5, nil, 0},
+		{"lock count over 2 feeds", stream.data, 3 * tsPacketSize, 5, []SyncEvent{{Kind: SyncAcquired}}, 5},
+	} {
+		demuxer, diagnostics := newTestDemuxer()
+		demuxer.SetSyncLockCount(test.lockCount)
+		chunk := test.chunk
+		if chunk == 0 {
+			chunk = len(test.data)
+		}
+		for rd := 0; rd < len(test.data); rd += chunk {
+			end := rd + chunk
+			if end > len(test.data) {
+				end = len(test.data)
+			}
+			demuxer.Feed(test.data[rd:end])
+		}
+		if events := demuxer.SyncEvents(); !reflect.DeepEqual(events, test.events) && len(events)+len(test.events) != 0 {
+			t.Errorf("%s: sync events %+v, expected %+v", test.name, events, test.events)
+		}
+		if packets := demuxer.dmx.globalStats.totalPackets; packets != test.packets {
+			t.Errorf("%s: %d packets, expected %d", test.name, packets, test.packets)
+		}
+		// and a diagnostic for each
+		acquired, lost := 0, 0
+		for _, event := range test.events {
+			if event.Kind == SyncAcquired {
+				acquired++
+			} else {
+				lost++
+			}
+		}
+		if diagnostics.count(DiagSyncAcquired) != acquired || diagnostics.count(DiagSyncLost) != lost {
+			t.Errorf("%s: diagnostics %v", test.name, *diagnostics)
+		}
+	}
+}
+
+// a blob too short for a full run of sync bytes is locked to if it is whole packets from the start,
+// anything else needs more of the stream
+func TestSyncShortBlob(t *testing.T) {
+	stream := newTestStream()
+	stream.padding(2)
+	broken := append([]byte(nil), stream.data...)
+	broken[tsPacketSize] = 0
+	for _, test := range []struct {
+		name    string
+		data    []byte
+		format  PacketFormat
+		packets uint64
+		err     error
+	}{
+		{"1 packet", stream.data[:tsPacketSize], PacketFormatTS188, 1, nil},
+		{"2 packets", stream.data, PacketFormatTS188, 2, nil},
+		{"1 and a half packets", stream.data[:tsPacketSize+100], PacketFormatTS188, 1, nil},
+		{"2 M2TS packets", testM2TS(stream, 1000, 10), PacketFormatM2TS, 2, nil},
+		{"2 RS204 packets", testRS204(stream), PacketFormatRS204, 2, nil},
+		{"second sync byte missing", broken, PacketFormatAuto, 0, ErrNeedMoreData},
+		{"junk in front", append([]byte{0x00, 0x47}, stream.data...), PacketFormatAuto, 0, ErrNeedMoreData},
+	} {
+		dmx := Newtsdmx()
+		_, err := dmx.ParseTSDataBlob(test.data, uint64(len(test.data)))
+		if err != test.err {
+			t.Errorf("%s: error %v, expected %v", test.name, err, test.err)
+		}
+		if format := dmx.PacketFormat(); format != test.format {
+			t.Errorf("%s: locked to %v, expected %v", test.name, format, test.format)
+		}
+		if packets := dmx.globalStats.totalPackets; packets != test.packets {
+			t.Errorf("%s: %d packets, expected %d", test.name, packets, test.packets)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package tshelper
+
+// table version tracking and multi-section table assembly
+// Tables are sent over and over, mostly unchanged.  Each long form section carries a
+// version_number and current_next_indicator, so we keep the current sections seen for every
+// table (PID + table_id + table_id_extension) and only parse a section again when it is one we
+// don't already have.  Sections with current_next_indicator 0 describe a table that is not in
+// force yet, so they are ignored - the same version will come round again as current.
+// Big tables are split into sections numbered 0 to last_section_number.  Every new section is
+// parsed as soon as it arrives, but the table only counts as complete once every section of the
+// version is in.  EIT schedules are split into segments of 8 sections, each of which may stop
+// short at its segment_last_section_number, so for those only the sections each segment says it
+// has are expected
+
+import (
+	"bytes"
+)
+
+// identifies 1 table, eg the PMT for 1 program or the SDT for 1 transport stream.  SDT and EIT
+// tables for other transport streams are only told apart by the network they come from as well,
+// so for those the ids at the start of the section body are part of the key
+type tableKey struct {
+	pid               uint16
+	tableID           uint8
+	tableIDExtension  uint16
+	transportStreamID uint16 // EIT only, SDT has it as table_id_extension
+	originalNetworkID uint16 // SDT and EIT only
+}
+
+func newTableKey(pid uint16, section []byte) tableKey {
+	key := tableKey{pid: pid, tableID: section[0], tableIDExtension: (uint16(section[3]) << 8) | uint16(section[4])}
+	switch {
+	case key.tableID == uint8(sdtSectionActualTransportStream) || key.tableID == uint8(sdtSectionOtherTransportStream):
+		key.originalNetworkID = (uint16(section[8]) << 8) | uint16(section[9])
+	case isEITTableID(key.tableID) && len(section) >= 12:
+		key.transportStreamID = (uint16(section[8]) << 8) | uint16(section[9])
+		key.originalNetworkID = (uint16(section[10]) << 8) | uint16(section[11])
+	}
+	return key
+}
+
+// what we know of the current version of 1 table
+type tableVersionState struct {
+	version           uint8
+	lastSectionNumber uint8
+	sections          [][]byte        // copies of the sections seen, by section_number, nil for those still to come
+	decoded           []interface{}   // what the parser made of each section, for the report, see keepDecoded
+	segmentLast       map[uint8]uint8 // EIT only - segment_last_section_number by segment
+	complete          bool
+	announce          bool   // complete, but the events wait until the last section has been parsed
+	repeats           uint64 // unchanged repeats seen since this version arrived
+
+	// the last version to be complete, to hand on when the next one completes
+	previousComplete bool
+	previousVersion  uint8
+	previousSections [][]byte
+}
+
+// TableVersionChangeEvent - a new version of a table is complete.  The sections are the whole
+// of the old and new tables, each section table_id through CRC, in section_number order
+type TableVersionChangeEvent struct {
+	Position
+	TableID          uint8
+	TableIDExtension uint16
+	OldVersion       uint8
+	NewVersion       uint8
+	OldSections      [][]byte
+	NewSections      [][]byte
+}
+
+// TableCompleteEvent - every section of a version of a table has arrived.  Sections are in
+// section_number order, with nil for any an EIT schedule doesn't use
+type TableCompleteEvent struct {
+	Position
+	PID              uint16
+	TableID          uint8
+	TableIDExtension uint16
+	Version          uint8
+	Sections         [][]byte
+}
+
+func isEITTableID(tableID uint8) bool {
+	return tableID >= 0x4e && tableID <= 0x6f
+}
+
+// is section_number expected to be sent for this table
+func (state *tableVersionState) expects(sectionNumber uint8) bool {
+	if state.segmentLast == nil {
+		return true
+	}
+	segment := sectionNumber / 8
+	last, known := state.segmentLast[segment]
+	if !known {
+		return sectionNumber%8 == 0 // every segment sends at least its first section
+	}
+	return sectionNumber <= last
+}
+
+func (state *tableVersionState) checkComplete() bool {
+	for sectionNumber, section := range state.sections {
+		if section == nil && state.expects(uint8(sectionNumber)) {
+			return false
+		}
+	}
+	return true
+}
+
+// decides if a long form section needs parsing, keeping the tablesMap counts and version
+// state up to date as it goes.  Unchanged repeats and not yet current sections do not
+func (tables tableParser) sectionIsNew(pid uint16, section []byte) bool {
+	versionNumber := (section[5] >> 1) & 0x1f
+	currentNext := section[5] & 0x1
+	sectionNumber := section[6]
+	lastSectionNumber := section[7]
+	if currentNext == 0 {
+		return false
+	}
+	if sectionNumber > lastSectionNumber {
+		tables.report.raise(SeverityWarning, DiagBadSectionNumber, "table 0x%x section_number %d is past last_section_number %d", section[0], sectionNumber, lastSectionNumber)
+		return false
+	}
+
+	key := newTableKey(pid, section)
+	entry := tables.tablesMap[pid]
+	if sectionNumber == lastSectionNumber {
+		// a table is sent section 0 up, so its last section going by is 1 more table seen
+		entry.numberTablesSeen += 1
+	}
+	defer func() { tables.tablesMap[pid] = entry }()
+
+	state := tables.versions[key]
+	if state != nil && state.version == versionNumber && state.lastSectionNumber != lastSectionNumber {
+		// same version can't change size, start again with what this section says
+		tables.report.raise(SeverityWarning, DiagBadSectionNumber, "table 0x%x version %d last_section_number changed from %d to %d",
+			key.tableID, versionNumber, state.lastSectionNumber, lastSectionNumber)
+		state.sections = make([][]byte, int(lastSectionNumber)+1)
+		state.decoded = make([]interface{}, int(lastSectionNumber)+1)
+		state.lastSectionNumber = lastSectionNumber
+		state.complete = false
+	}
+
+	if state == nil || state.version != versionNumber {
+		newState := &tableVersionState{version: versionNumber, lastSectionNumber: lastSectionNumber}
+		newState.sections = make([][]byte, int(lastSectionNumber)+1)
+		newState.decoded = make([]interface{}, int(lastSectionNumber)+1)
+		if isEITTableID(key.tableID) {
+			newState.segmentLast = make(map[uint8]uint8)
+		}
+		if state != nil {
+			newState.previousComplete = state.complete || state.previousComplete
+			newState.previousVersion, newState.previousSections = state.previousVersion, state.previousSections
+			if state.complete {
+				newState.previousVersion, newState.previousSections = state.version, state.sections
+			}
+		}
+		state = newState
+		tables.versions[key] = state
+		entry.latestVersion = versionNumber
+		entry.versionsSeen += 1
+		entry.isSingleSection = lastSectionNumber == 0
+	}
+
+	if previous := state.sections[sectionNumber]; previous != nil {
+		if bytes.Equal(previous, section) {
+			state.repeats += 1
+			return false
+		}
+		// the content has changed but the version hasn't, which it should have.  Believe the content
+		tables.report.raise(SeverityWarning, DiagTableChangedWithoutVersion, "table 0x%x extension 0x%x section %d changed but stayed at version %d",
+			key.tableID, key.tableIDExtension, sectionNumber, versionNumber)
+		state.sections[sectionNumber] = append([]byte(nil), section...)
+		return true
+	}
+
+	state.sections[sectionNumber] = append([]byte(nil), section...)
+	if state.segmentLast != nil && len(section) > 12 {
+		state.segmentLast[sectionNumber/8] = section[12]
+	}
+	if !state.complete && state.checkComplete() {
+		state.complete = true
+		state.announce = true
+	}
+	return true
+}
+
+// hand on a table sectionIsNew found complete, once the section that completed it has been
+// through its parser so handlers see the demux with the whole table in
+func (tables tableParser) announceComplete(pid uint16, section []byte) {
+	key := newTableKey(pid, section)
+	if state := tables.versions[key]; state != nil && state.announce {
+		state.announce = false
+		tables.tableComplete(key, state)
+	}
+}
+
+// keep what a parser made of a section alongside it, so a report can be put together without
+// parsing the section again.  decoded must not be shared with anything handed out, handlers
+// included
+func (tables tableParser) keepDecoded(pid uint16, section []byte, decoded interface{}) {
+	if state := tables.versions[newTableKey(pid, section)]; state != nil && int(section[6]) < len(state.decoded) {
+		state.decoded[section[6]] = decoded
+	}
+}
+
+// copy of a table's sections for an event.  The version state keeps changing after the event
+// has gone, and handlers are allowed to keep what they are given
+func copySections(sections [][]byte) [][]byte {
+	copied := make([][]byte, len(sections))
+	for i, section := range sections {
+		if section != nil {
+			copied[i] = append([]byte(nil), section...)
+		}
+	}
+	return copied
+}
+
+// hand on a table that has just become complete, and the change from the last version if there was one
+func (tables tableParser) tableComplete(key tableKey, state *tableVersionState) {
+	event := &TableCompleteEvent{
+		Position:         tables.report.position,
+		PID:              key.pid,
+		TableID:          key.tableID,
+		TableIDExtension: key.tableIDExtension,
+		Version:          state.version,
+		Sections:         copySections(state.sections),
+	}
+	for _, handler := range tables.report.handlers {
+		handler.OnTableComplete(event)
+	}
+
+	if !state.previousComplete {
+		return
+	}
+	change := &TableVersionChangeEvent{
+		Position:         tables.report.position,
+		TableID:          key.tableID,
+		TableIDExtension: key.tableIDExtension,
+		OldVersion:       state.previousVersion,
+		NewVersion:       state.version,
+		OldSections:      copySections(state.previousSections),
+		NewSections:      copySections(state.sections),
+	}
+	for _, handler := range tables.report.handlers {
+		handler.OnTableVersionChange(change)
+	}
+}
@@ -0,0 +1,162 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTableVersions(t *testing.T) {
+	// a PAT of 2 sections, which then moves on to version 1
+	first := [][]byte{testLongSection(0, 1, 0, 0, 1, []byte{0, 1, 0xe1, 0x00}), testLongSection(0, 1, 0, 1, 1, []byte{0, 2, 0xe2, 0x00})}
+	changed := testLongSection(0, 1, 0, 1, 1, []byte{0, 3, 0xe3, 0x00})
+	next := [][]byte{testLongSection(0, 1, 1, 0, 1, []byte{0, 1, 0xe1, 0x00}), testLongSection(0, 1, 1, 1, 1, []byte{0, 4, 0xe4, 0x00})}
+	notCurrent := testLongSection(0, 1, 2, 0, 0, []byte{0, 5, 0xe5, 0x00})
+	notCurrent[5] &^= 0x01
+	crc := crc32Mpeg(notCurrent[:len(notCurrent)-4])
+	copy(notCurrent[len(notCurrent)-4:], []byte{uint8(crc >> 24), uint8(crc >> 16), uint8(crc >> 8), uint8(crc)})
+	pastLast := testLongSection(0, 1, 1, 2, 1, []byte{0, 6, 0xe6, 0x00})
+
+	tables, diagnostics, events := testSectionTables()
+	for _, step := range []struct {
+		name     string
+		section  []byte
+		parsed   bool
+		code     DiagnosticCode // raised by this section, 0 for none
+		complete *TableCompleteEvent
+		change   *TableVersionChangeEvent
+	}{
+		{"first section", first[0], true, 0, nil, nil},
+		{"last section", first[1], true, 0, &TableCompleteEvent{TableIDExtension: 1, Version: 0, Sections: first}, nil},
+		{"unchanged repeat", first[0], false, 0, nil, nil},
+		{"changed without a new version", changed, true, DiagTableChangedWithoutVersion, nil, nil},
+		{"new version, first section", next[0], true, 0, nil, nil},
+		{"new version, last section", next[1], true, 0,
+			&TableCompleteEvent{TableIDExtension: 1, Version: 1, Sections: next},
+			&TableVersionChangeEvent{TableIDExtension: 1, OldVersion: 0, NewVersion: 1, OldSections: [][]byte{first[0], changed}, NewSections: next}},
+		{"not current yet", notCurrent, false, 0, nil, nil},
+		{"section_number past last_section_number", pastLast, false, DiagBadSectionNumber, nil, nil},
+	} {
+		pats, completes, changes, raised := len(events.pats), len(events.completeTables), len(events.versionChanges), len(*diagnostics)
+		tables.processSection(0, step.section)
+
+		if parsed := len(events.pats) > pats; parsed != step.parsed {
+			t.Errorf("%s: parsed %v, expected %v", step.name, parsed, step.parsed)
+		}
+		var code DiagnosticCode
+		for _, diagnostic := range (*diagnostics)[raised:] {
+			if diagnostic.Severity > SeverityInfo {
+				code = diagnostic.Code
+			}
+		}
+		if code != step.code {
+			t.Errorf("%s: raised %v, expected %v", step.name, code, step.code)
+		}
+		var complete *TableCompleteEvent
+		if len(events.completeTables) > completes {
+			complete = events.completeTables[completes]
+			complete.Position = Position{}
+		}
+		if !reflect.DeepEqual(complete, step.complete) {
+			t.Errorf("%s: table complete %+v, expected %+v", step.name, complete, step.complete)
+		}
+		var change *TableVersionChangeEvent
+		if len(events.versionChanges) > changes {
+			change = events.versionChanges[changes]
+			change.Position = Position{}
+		}
+		if !reflect.DeepEqual(change, step.change) {
+			t.Errorf("%s: version change %+v, expected %+v", step.name, change, step.change)
+		}
+	}
+
+	// handlers may keep and change what they are given without it reaching the stored table
+	events.completeTables[1].Sections[0][0] = 0xff
+	events.versionChanges[0].NewSections[1][0] = 0xff
+	if state := tables.versions[tableKey{pid: 0, tableID: 0, tableIDExtension: 1}]; !reflect.DeepEqual(state.sections, next) {
+		t.Errorf("stored sections %v changed by a handler", state.sections)
+	}
+
+	report := &Report{}
+	tables.addToReport(report)
+	expected := []TableVersionReport{{PID: 0, TableID: 0, TableIDExtension: 1, Version: 1, LastSectionNumber: 1, SectionsSeen: 2, Complete: true}}
+	if !reflect.DeepEqual(report.TableVersions, expected) {
+		t.Errorf("table versions %+v, expected %+v", report.TableVersions, expected)
+	}
+	// whole tables, counted as their last section goes by
+	if pat := report.Tables[0]; pat.PID != 0 || pat.TablesSeen != 3 || pat.VersionsSeen != 2 {
+		t.Errorf("PAT %+v, expected 3 tables seen in 2 versions", pat)
+	}
+}
+
+// EIT schedule segments only send the sections up to their segment_last_section_number
+func TestEITScheduleComplete(t *testing.T) {
+	tables, _, events := testSectionTables()
+	eit := func(sectionNumber, segmentLast uint8) []byte {
+		return testLongSection(0x50, 1, 0, sectionNumber, 9, []byte{0, 1, 0, 2, segmentLast, 0x50})
+	}
+	for _, step := range []struct {
+		name     string
+		section  []byte
+		complete bool
+	}{
+		{"segment 0, section 0 of 1", eit(0, 1), false},
+		{"segment 1, section 8 of 9", eit(8, 9), false},
+		{"segment 0, section 1 of 1", eit(1, 1), false},
+		{"segment 1, section 9 of 9", eit(9, 9), true},
+	} {
+		tables.processSection(0x12, step.section)
+		if complete := len(events.completeTables) > 0; complete != step.complete {
+			t.Errorf("%s: complete %v, expected %v", step.name, complete, step.complete)
+		}
+	}
+	if sections := events.completeTables[0].Sections; sections[2] != nil || sections[8] == nil {
+		t.Errorf("sections %v, expected only 0, 1, 8 and 9", sections)
+	}
+}
+
+// a new PMT version keeps the name the SDT gave the service
+func TestPMTVersionKeepsServiceName(t *testing.T) {
+	name := "Channel"
+	service := append([]byte{0x48, uint8(3 + len(name)), 1, 0, uint8(len(name))}, name...)
+	stream := newTestStream()
+	stream.section(0, testPAT())
+	stream.section(0x100, testPMT(0, 0x1b, 0x101))
+	stream.section(0x11, testLongSection(0x42, 1, 0, 0, 0, append([]byte{0, 2, 0xff, 0, 1, 0xfc, 0xf0, uint8(len(service))}, service...)))
+	stream.section(0x100, testPMT(1, 0x1b, 0x101, 0x0f, 0x102))
+
+	demuxer, _ := newTestDemuxer()
+	feedTestStream(t, demuxer, stream)
+	services := demuxer.Report().Services
+	if len(services) != 1 || services[0].Name != name || len(services[0].Components) != 2 {
+		t.Errorf("services %+v, expected %q with 2 components", services, name)
+	}
+}
+
+// OnTableComplete and OnTableVersionChange come after the table's own event, once the section
+// that completes it has been parsed
+func TestTableEventOrder(t *testing.T) {
+	sdt := func(sectionNumber uint8, name string) []byte {
+		return testLongSection(0x42, 1, 0, sectionNumber, 1, append([]byte{0, 2, 0xff}, testSDTService(uint16(sectionNumber)+1, "", name)...))
+	}
+	for _, test := range []struct {
+		name     string
+		pid      uint16
+		sections [][]byte
+		order    []string
+	}{
+		{"PAT", 0, [][]byte{testPAT()}, []string{"PAT", "TableComplete"}},
+		{"PMT and a new version", 0x100, [][]byte{testPMT(0, 0x1b, 0x101), testPMT(1, 0x1b, 0x102)},
+			[]string{"PMT", "TableComplete", "PMT", "TableComplete", "TableVersionChange"}},
+		{"SDT of 2 sections", 0x11, [][]byte{sdt(0, "One"), sdt(1, "Two")}, []string{"SDT", "SDT", "TableComplete"}},
+		{"CAT", 0x01, [][]byte{testCAT()}, []string{"CAT", "TableComplete"}},
+	} {
+		tables, _, events := testSectionTables()
+		tables.tablesMap[0x100] = tablesMapEntry{tabletype: pmtTable, programNumber: 1}
+		for _, section := range test.sections {
+			tables.processSection(test.pid, section)
+		}
+		if !reflect.DeepEqual(events.tableOrder, test.order) {
+			t.Errorf("%s: events %v, expected %v", test.name, events.tableOrder, test.order)
+		}
+	}
+}
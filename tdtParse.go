@@ -0,0 +1,197 @@
+package tshelper
+
+// Time and Date Table (0x70) and Time Offset Table (0x73), EN 300 468 5.2.5 / 5.2.6, on PID 0x14.
+// Both are short sections carrying the current UTC, the TOT adds local_time_offset_descriptors
+// and a CRC_32.
+// Each one anchors the stream's PCR to UTC: the UTC it carries goes with the latest PCR on the
+// clock PID (the first PID seen carrying PCRs), and from then on the UTC of any packet is that
+// plus however far the PCR has moved on.  It goes in the Position of every event and diagnostic.
+// A PCR discontinuity drops the anchor until the next TDT / TOT
+
+import (
+	"fmt"
+	"time"
+)
+
+// the TDT only has 1 second resolution and may be sent a little late, so this far adrift of
+// where the PCR says UTC is counts as a jump
+const clockJumpThreshold = 2 * time.Second
+
+// LocalTimeOffset is 1 entry of a local_time_offset_descriptor.  Offsets are minutes ahead of UTC
+type LocalTimeOffset struct {
+	Country      string    `json:"country"`
+	RegionID     uint8     `json:"regionId"`
+	Offset       int       `json:"offset"`
+	TimeOfChange time.Time `json:"timeOfChange"` // UTC
+	NextOffset   int       `json:"nextOffset"`   // offset from TimeOfChange on
+}
+
+// TDTEvent - a TDT or TOT has been parsed
+type TDTEvent struct {
+	Position
+	TableID          uint8
+	UTC              time.Time
+	LocalTimeOffsets []LocalTimeOffset // TOT only
+	HasPCR           bool              // UTC has been anchored to PCR
+	PCR              uint64            // the PCR it was anchored to, 27MHz
+}
+
+// ClockReport is how the stream's PCR lines up with UTC
+type ClockReport struct {
+	PCRPID           uint16            `json:"pcrPid"`
+	Anchored         bool              `json:"anchored"`   // a TDT / TOT has tied the PCR to UTC
+	AnchorUTC        time.Time         `json:"anchorUtc"`  // from the latest TDT / TOT
+	AnchorPCR        uint64            `json:"anchorPcr"`  // 27MHz
+	CurrentUTC       time.Time         `json:"currentUtc"` // at the latest PCR
+	TimeTables       uint64            `json:"timeTables"` // TDTs and TOTs seen
+	ClockJumps       uint64            `json:"clockJumps"`
+	LocalTimeOffsets []LocalTimeOffset `json:"localTimeOffsets"` // from the latest TOT
+}
+
+// shared (by pointer) between the tsdmx, which sees the PCRs, and the tableParser, which sees
+// the TDT / TOT
+type wallClock struct {
+	pid        uint16
+	havePID    bool
+	havePCR    bool
+	pcr        uint64 // latest PCR on pid, 27MHz
+	anchored   bool
+	anchorPCR  uint64
+	anchorUTC  time.Time
+	timeTables uint64
+	clockJumps uint64
+	offsets    []LocalTimeOffset
+}
+
+func newWallClock() *wallClock {
+	return &wallClock{}
+}
+
+// a PCR has been found.  Only the clock PID's move the clock on
+func (clock *wallClock) pcrSeen(pid uint16, pcr uint64, discontinuity bool) {
+	if !clock.havePID {
+		clock.pid = pid
+		clock.havePID = true
+	}
+	if pid != clock.pid {
+		return
+	}
+	if discontinuity {
+		clock.anchored = false
+	}
+	clock.pcr = pcr
+	clock.havePCR = true
+}
+
+// UTC at the latest PCR, zero until a TDT / TOT has anchored the clock
+func (clock *wallClock) utc() time.Time {
+	if !clock.anchored {
+		return time.Time{}
+	}
+	ticks := timestampDelta((clock.anchorPCR/300)&timestampMask, (clock.pcr/300)&timestampMask)
+	return clock.anchorUTC.Add(time.Duration(ticks) * time.Second / 90000)
+}
+
+// UTC_time from a TDT / TOT has arrived, tie it to the latest PCR
+func (tables tableParser) anchorClock(utc time.Time) {
+	clock := tables.clock
+	clock.timeTables += 1
+	if clock.anchored {
+		drift := utc.Sub(clock.utc())
+		if drift > clockJumpThreshold || drift < -clockJumpThreshold {
+			clock.clockJumps += 1
+			tables.report.raise(SeverityWarning, DiagClockJump, "UTC %v is %v from where the PCR on PID 0x%x puts it", utc, drift, clock.pid)
+		}
+	}
+	if clock.havePCR {
+		clock.anchored = true
+		clock.anchorPCR = clock.pcr
+		clock.anchorUTC = utc
+	}
+}
+
+func parseLocalTimeOffsets(body []byte) []LocalTimeOffset {
+	var offsets []LocalTimeOffset
+	for rd := 0; rd+13 <= len(body); rd += 13 {
+		offset := LocalTimeOffset{
+			Country:      string(body[rd : rd+3]),
+			RegionID:     body[rd+3] >> 2,
+			Offset:       int(bcdValue(body[rd+4:rd+5])*60 + bcdValue(body[rd+5:rd+6])),
+			TimeOfChange: decodeMJDTime(body[rd+6 : rd+11]),
+			NextOffset:   int(bcdValue(body[rd+11:rd+12])*60 + bcdValue(body[rd+12:rd+13])),
+		}
+		if body[rd+3]&0x01 != 0 {
+			// polarity, set for west of Greenwich
+			offset.Offset = -offset.Offset
+			offset.NextOffset = -offset.NextOffset
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+// decode 1 whole TDT or TOT section
+func parseTDTSection(section []byte) (*TDTEvent, error) {
+	event := &TDTEvent{TableID: section[0]}
+	if len(section) < 8 {
+		return event, fmt.Errorf("table 0x%x of %d bytes is too short for UTC_time", section[0], len(section))
+	}
+	event.UTC = decodeMJDTime(section[3:8])
+	if tableIDsEnum(section[0]) != totSection {
+		return event, nil
+	}
+	if len(section) < 14 {
+		return event, fmt.Errorf("TOT of %d bytes is too short", len(section))
+	}
+	descriptors, _, err := lengthPrefixedLoop(section[8 : len(section)-4])
+	if err != nil {
+		return event, fmt.Errorf("TOT: %v", err)
+	}
+	err = forEachDescriptor(descriptors, func(tag uint8, body []byte) {
+		if tag == 0x58 {
+			event.LocalTimeOffsets = append(event.LocalTimeOffsets, parseLocalTimeOffsets(body)...)
+		}
+	})
+	if err != nil {
+		return event, fmt.Errorf("TOT: %v", err)
+	}
+	return event, nil
+}
+
+// parse a TDT or TOT, anchor the clock with it and hand it on
+func (tables tableParser) tdtParser(section []byte) {
+	event, err := parseTDTSection(section)
+	if err != nil {
+		tables.report.raise(SeverityWarning, DiagBadTable, "%v", err)
+		if event.UTC.IsZero() {
+			return
+		}
+	}
+	tables.anchorClock(event.UTC)
+	if tableIDsEnum(event.TableID) == totSection {
+		tables.clock.offsets = event.LocalTimeOffsets
+	}
+	event.Position = tables.report.position
+	event.HasPCR = tables.clock.anchored
+	event.PCR = tables.clock.anchorPCR
+
+	for _, handler := range tables.report.handlers {
+		handler.OnTDT(event)
+	}
+}
+
+func (clock *wallClock) addToReport(report *Report) {
+	if clock.timeTables == 0 {
+		return
+	}
+	report.Clock = &ClockReport{
+		PCRPID:           clock.pid,
+		Anchored:         clock.anchored,
+		AnchorUTC:        clock.anchorUTC,
+		AnchorPCR:        clock.anchorPCR,
+		CurrentUTC:       clock.utc(),
+		TimeTables:       clock.timeTables,
+		ClockJumps:       clock.clockJumps,
+		LocalTimeOffsets: append(make([]LocalTimeOffset, 0, len(clock.offsets)), clock.offsets...),
+	}
+}
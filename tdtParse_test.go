@@ -0,0 +1,125 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 2024-01-01 12:00:00 UTC as MJD and BCD
+var testUTCTime = []byte{0xeb, 0x96, 0x12, 0x00, 0x00}
+
+// a TDT for 2024-01-01 at the given BCD hours, minutes and seconds
+func testTDT(hours, minutes, seconds uint8) []byte {
+	return []byte{0x70, 0x70, 0x05, 0xeb, 0x96, hours, minutes, seconds}
+}
+
+// a TOT, UTC_time then loop, which is the descriptors_loop with its length already in front
+func testTOT(loop []byte) []byte {
+	length := 5 + len(loop) + 4
+	section := append([]byte{0x73, 0x70 | uint8(length>>8), uint8(length)}, testUTCTime...)
+	section = append(section, loop...)
+	crc := crc32Mpeg(section)
+	return append(section, uint8(crc>>24), uint8(crc>>16), uint8(crc>>8), uint8(crc))
+}
+
+// 1 local_time_offset_descriptor entry, offset and next_time_offset in BCD hours and minutes,
+// changing at 2024-01-11 01:00:00
+func testLocalTimeOffset(country string, west bool, offset, nextOffset [2]byte) []byte {
+	flags := uint8(0x02)
+	if west {
+		flags |= 0x01
+	}
+	entry := append([]byte(country), flags, offset[0], offset[1], 0xeb, 0xa0, 0x01, 0x00, 0x00)
+	return append(entry, nextOffset[0], nextOffset[1])
+}
+
+func TestTDTClock(t *testing.T) {
+	const second = 27000000
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tables, diagnostics, events := testSectionTables()
+	for _, step := range []struct {
+		name          string
+		pcr           uint64
+		discontinuity bool
+		tdt           []byte
+		utc           time.Time // where the clock puts the PCR afterwards
+		jumps         uint64
+	}{
+		{"PCR before any TDT", second, false, nil, time.Time{}, 0},
+		{"first TDT anchors the clock", second, false, testTDT(0x12, 0x00, 0x00), noon, 0},
+		{"clock moves on with the PCR", 2 * second, false, nil, noon.Add(time.Second), 0},
+		{"TDT agreeing with the PCR", 3 * second, false, testTDT(0x12, 0x00, 0x02), noon.Add(2 * time.Second), 0},
+		{"TDT that jumps", 4 * second, false, testTDT(0x12, 0x05, 0x00), noon.Add(5 * time.Minute), 1},
+		{"PCR discontinuity", 5 * second, true, nil, time.Time{}, 1},
+		{"next TDT anchors it again", 5 * second, false, testTDT(0x12, 0x06, 0x00), noon.Add(6 * time.Minute), 1},
+	} {
+		tdts := len(events.tdts)
+		tables.clock.pcrSeen(0x100, step.pcr, step.discontinuity)
+		if step.tdt != nil {
+			tables.processSection(0x14, step.tdt)
+			if len(events.tdts) != tdts+1 {
+				t.Fatalf("%s: no TDT event", step.name)
+			}
+			if event := events.tdts[tdts]; !event.HasPCR || event.PCR != step.pcr || !event.UTC.Equal(step.utc) {
+				t.Errorf("%s: TDT event %+v", step.name, event)
+			}
+		}
+		if utc := tables.clock.utc(); !utc.Equal(step.utc) {
+			t.Errorf("%s: UTC %v, expected %v", step.name, utc, step.utc)
+		}
+		if tables.clock.clockJumps != step.jumps || uint64(diagnostics.count(DiagClockJump)) != step.jumps {
+			t.Errorf("%s: %d clock jumps, %d raised, expected %d", step.name, tables.clock.clockJumps, diagnostics.count(DiagClockJump), step.jumps)
+		}
+	}
+}
+
+func TestTOTLocalTimeOffsets(t *testing.T) {
+	tables, diagnostics, events := testSectionTables()
+	body := append(testLocalTimeOffset("GBR", false, [2]byte{0x00, 0x00}, [2]byte{0x01, 0x00}),
+		testLocalTimeOffset("BRA", true, [2]byte{0x03, 0x00}, [2]byte{0x02, 0x30})...)
+	tables.processSection(0x14, testTOT(testLoop(append([]byte{0x58, uint8(len(body))}, body...))))
+	if len(*diagnostics) != 0 || len(events.tdts) != 1 {
+		t.Fatalf("%d TOT events, diagnostics %v", len(events.tdts), *diagnostics)
+	}
+	change := time.Date(2024, 1, 11, 1, 0, 0, 0, time.UTC)
+	expected := []LocalTimeOffset{
+		{Country: "GBR", Offset: 0, TimeOfChange: change, NextOffset: 60},
+		{Country: "BRA", Offset: -180, TimeOfChange: change, NextOffset: -150},
+	}
+	if !reflect.DeepEqual(events.tdts[0].LocalTimeOffsets, expected) {
+		t.Errorf("local time offsets %+v, expected %+v", events.tdts[0].LocalTimeOffsets, expected)
+	}
+
+	// no PCR yet, so the clock isn't anchored but the offsets are kept
+	report := &Report{}
+	tables.clock.addToReport(report)
+	if report.Clock == nil || report.Clock.Anchored || report.Clock.TimeTables != 1 || !reflect.DeepEqual(report.Clock.LocalTimeOffsets, expected) {
+		t.Errorf("clock report %+v", report.Clock)
+	}
+}
+
+// malformed TDTs and TOTs are BadTable diagnostics, never a panic
+func TestTDTMalformed(t *testing.T) {
+	offset := testLocalTimeOffset("GBR", false, [2]byte{0x00, 0x00}, [2]byte{0x01, 0x00})
+	for _, test := range []struct {
+		name    string
+		section []byte
+		event   bool // UTC_time was there, so the event still goes out
+	}{
+		{"TDT too short", []byte{0x70, 0x70, 0x02, 0xeb, 0x96}, false},
+		{"TOT too short", testTOT(nil), true},
+		{"descriptors_loop_length too long", testTOT(append([]byte{0xf0, 0x20, 0x58, 13}, offset...)), true},
+		{"descriptor runs past the loop", testTOT(testLoop(append([]byte{0x58, 20}, offset...))), true},
+		{"descriptor length missing", testTOT(testLoop([]byte{0x58})), true},
+	} {
+		tables, diagnostics, events := testSectionTables()
+		tables.processSection(0x14, test.section)
+		if diagnostics.count(DiagBadTable) != 1 || len(*diagnostics) != 1 {
+			t.Errorf("%s: diagnostics %v", test.name, *diagnostics)
+		}
+		if got := len(events.tdts) == 1; got != test.event {
+			t.Errorf("%s: TDT events %+v", test.name, events.tdts)
+		}
+	}
+}
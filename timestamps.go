@@ -0,0 +1,88 @@
+package tshelper
+
+// PTS / DTS decoding and per PID timestamp tracking
+// PTS and DTS are 33 bit counts of a 90kHz clock, so they wrap every ~26.5 hours.  Differences are
+// taken modulo 2^33: anything less than half the range ahead counts as forwards, anything else as
+// backwards, which copes with the wrap without special cases.
+// Decode order is what must always go forwards, that's the DTS, or the PTS for streams (like audio)
+// that only send a PTS because the two are the same.  Presentation order may legitimately step
+// back a frame or two for B pictures, so PTS is only checked for big jumps
+
+const (
+	timestampWrap = uint64(1) << 33
+	timestampMask = timestampWrap - 1
+
+	// PTS steps bigger than this (either way) are reported as a jump - 1 second at 90kHz. Well past
+	// any frame reordering or audio PES duration
+	ptsJumpThreshold = 90000
+)
+
+// decode a 33 bit PTS or DTS from its 5 byte, marker bit laden, form
+func extractTimestamp(data []byte) uint64 {
+	return ((uint64(data[0])>>1)&0x07)<<30 |
+		(uint64(data[1]) << 22) |
+		((uint64(data[2]) >> 1) << 15) |
+		(uint64(data[3]) << 7) |
+		(uint64(data[4]) >> 1)
+}
+
+// signed distance from 'from' to 'to' in 90kHz ticks, allowing for the 33 bit wrap
+func timestampDelta(from uint64, to uint64) int64 {
+	delta := (to - from) & timestampMask
+	if delta >= timestampWrap/2 {
+		return int64(delta) - int64(timestampWrap)
+	}
+	return int64(delta)
+}
+
+// fill in PTS / DTS from the optional PES header fields
+func decodePESTimestamps(pes *PESPacket) {
+	if pes.PTSDTSFlags&0x2 != 0 && len(pes.Header) >= 5 {
+		pes.HasPTS = true
+		pes.PTS = extractTimestamp(pes.Header[0:5])
+		if pes.PTSDTSFlags == 0x3 && len(pes.Header) >= 10 {
+			pes.HasDTS = true
+			pes.DTS = extractTimestamp(pes.Header[5:10])
+		}
+	}
+}
+
+// check the timestamps of a newly completed PES against the last ones seen on the PID, updating
+// the PID's stats.  discontinuity is set when the PES started in a packet with the
+// discontinuity_indicator set, in which case a jump is expected and not reported
+func (metaInfo tsdmx) trackTimestamps(pes *PESPacket, pidData *pidInfo, discontinuity bool, position Position) {
+	if !pes.HasOptionalHeader {
+		return
+	}
+	if !pes.HasPTS {
+		pidData.missingTimestamps += 1
+		metaInfo.report.raiseAt(position, SeverityWarning, DiagMissingTimestamp, "PES with stream_id 0x%x has no PTS", pes.StreamID)
+		return
+	}
+
+	decodeTime := pes.PTS
+	if pes.HasDTS {
+		decodeTime = pes.DTS
+	}
+
+	if !pidData.haveTimestamps {
+		pidData.haveTimestamps = true
+		pidData.firstPTS = pes.PTS
+		pidData.firstDTS = decodeTime
+	} else if !discontinuity {
+		if pes.PTS < pidData.lastPTS && timestampDelta(pidData.lastPTS, pes.PTS) > 0 {
+			pidData.ptsWraps += 1
+			metaInfo.report.raiseAt(position, SeverityInfo, DiagTimestampWrap, "PTS wrapped from %d to %d", pidData.lastPTS, pes.PTS)
+		}
+		if jump := timestampDelta(pidData.lastPTS, pes.PTS); jump > ptsJumpThreshold || jump < -ptsJumpThreshold {
+			pidData.ptsJumps += 1
+			metaInfo.report.raiseAt(position, SeverityWarning, DiagPTSJump, "PTS jumped by %d ticks, from %d to %d", jump, pidData.lastPTS, pes.PTS)
+		}
+		if timestampDelta(pidData.lastDTS, decodeTime) <= 0 {
+			pidData.dtsNonMonotonic += 1
+			metaInfo.report.raiseAt(position, SeverityWarning, DiagDTSNonMonotonic, "decode time went from %d to %d", pidData.lastDTS, decodeTime)
+		}
+	}
+	pidData.lastPTS = pes.PTS
+	pidData.lastDTS = decodeTime
+}
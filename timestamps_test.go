@@ -0,0 +1,77 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTimestampDelta(t *testing.T) {
+	for _, test := range []struct {
+		from, to uint64
+		delta    int64
+	}{
+		{1000, 4600, 3600},
+		{4600, 1000, -3600},
+		{timestampMask - 99, 100, 200},
+		{100, timestampMask - 99, -200},
+	} {
+		if delta := timestampDelta(test.from, test.to); delta != test.delta {
+			t.Errorf("%d to %d is %d ticks, expected %d", test.from, test.to, delta, test.delta)
+		}
+	}
+}
+
+// timestamps running forwards, wrapping, jumping and going backwards on an audio PID
+func TestTimestampTracking(t *testing.T) {
+	audio := func(pts ...uint64) [][]byte {
+		var pes [][]byte
+		for _, timestamp := range pts {
+			pes = append(pes, testPES(0xc0, timestamp, 0, []byte{0xbb}, true))
+		}
+		return pes
+	}
+	noPTS := []byte{0, 0, 1, 0xc0, 0, 4, 0x80, 0, 0, 0xbb}
+
+	for _, test := range []struct {
+		name     string
+		pes      [][]byte
+		expected TimestampReport
+		code     DiagnosticCode // raised once, 0 for none
+	}{
+		{"forwards", audio(1800, 3600, 5400), TimestampReport{FirstPTS: 1800, LastPTS: 5400, FirstDTS: 1800, LastDTS: 5400}, 0},
+		{"wrap", audio(timestampMask-1799, 1, 1801), TimestampReport{FirstPTS: timestampMask - 1799, LastPTS: 1801, FirstDTS: timestampMask - 1799, LastDTS: 1801, PTSWraps: 1}, DiagTimestampWrap},
+		{"jump", audio(1800, 3600, 3600+10*90000), TimestampReport{FirstPTS: 1800, LastPTS: 903600, FirstDTS: 1800, LastDTS: 903600, PTSJumps: 1}, DiagPTSJump},
+		{"backwards", audio(1800, 3600, 1800), TimestampReport{FirstPTS: 1800, LastPTS: 1800, FirstDTS: 1800, LastDTS: 1800, NonMonotonicDTS: 1}, DiagDTSNonMonotonic},
+		{"repeated", audio(1800, 1800), TimestampReport{FirstPTS: 1800, LastPTS: 1800, FirstDTS: 1800, LastDTS: 1800, NonMonotonicDTS: 1}, DiagDTSNonMonotonic},
+		{"no PTS", append(audio(1800), noPTS), TimestampReport{FirstPTS: 1800, LastPTS: 1800, FirstDTS: 1800, LastDTS: 1800, MissingTimestamps: 1}, DiagMissingTimestamp},
+	} {
+		stream := newTestStream()
+		stream.section(0, testPAT())
+		stream.section(0x100, testPMT(0, 0x0f, 0x102))
+		for _, pes := range test.pes {
+			stream.pes(0x102, pes)
+		}
+		demuxer, diagnostics := newTestDemuxer()
+		feedTestStream(t, demuxer, stream)
+		demuxer.Flush()
+
+		var timestamps *TimestampReport
+		for _, pid := range demuxer.Report().PIDs {
+			if pid.PID == 0x102 {
+				timestamps = pid.Timestamps
+			}
+		}
+		if timestamps == nil || !reflect.DeepEqual(*timestamps, test.expected) {
+			t.Errorf("%s: timestamps %+v, expected %+v", test.name, timestamps, test.expected)
+		}
+		for _, code := range []DiagnosticCode{DiagTimestampWrap, DiagPTSJump, DiagDTSNonMonotonic, DiagMissingTimestamp} {
+			expected := 0
+			if code == test.code {
+				expected = 1
+			}
+			if diagnostics.count(code) != expected {
+				t.Errorf("%s: diagnostics %v", test.name, *diagnostics)
+			}
+		}
+	}
+}
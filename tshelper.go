@@ -7,10 +7,14 @@ import (
 )
 
 // the data structure that is the TS-Demultiplxer
+// not safe for use from more than 1 goroutine, Demuxer wraps it with a lock for that
 type tsdmx struct {
 	pidStats map[uint16]pidInfo
 	globalStats *globalInfo
+	sync *syncTracker
+	report *reporter
 	tables tableParser
+	pes map[uint16]*pesBuffer // PES being reassembled, by PID
 }
 
 // information on what we have seen on individual PIDs
@@ -22,6 +26,18 @@ type pidInfo struct {
 	packetCountSinceBitrateCalc uint64
 	pcr27MHzAtLastBitrateSlice uint64
 	pktCountAtLastBitrateSlice uint64
+	lastArrivalTimestamp uint32 // M2TS only - arrival time of the last packet seen on this PID
+
+	// PES timestamps, see timestamps.go.  lastDTS / firstDTS are the decode time, so the PTS if there's no DTS
+	haveTimestamps bool
+	firstPTS uint64
+	lastPTS uint64
+	firstDTS uint64
+	lastDTS uint64
+	ptsWraps uint64
+	ptsJumps uint64
+	dtsNonMonotonic uint64
+	missingTimestamps uint64
 }
 
 
@@ -30,7 +46,9 @@ type pidInfo struct {
 // and then count pkts on each pid seen between PCR packets
 type globalInfo struct {
 	totalPackets uint64
+	bytesConsumed uint64 // stream byte offset of the next byte ParseTSDataBlob will see
 	pcrUsedForCrudeTimings uint16
+	arrivalTimestamp uint32 // M2TS only - 27MHz arrival time of the packet being processed
 }
 
 
@@ -61,8 +79,11 @@ type tsAdaptInfo struct {
 func Newtsdmx ( ) tsdmx {
 	newStruct := tsdmx{}
 	newStruct.pidStats = make(map[uint16]pidInfo)
-	newStruct.tables = newTableParser()
+	newStruct.report = new(reporter)
+	newStruct.tables = newTableParser(newStruct.report)
+	newStruct.pes = make(map[uint16]*pesBuffer)
 	newStruct.globalStats = new(globalInfo)
+	newStruct.sync = newSyncTracker()
 	return newStruct
 }
 
@@ -92,7 +113,7 @@ func parseTSAdaptFields (adaptationByte uint8, tsAdaptFields *tsAdaptInfo) {
 }
 
 // extract the pcr from the adaptation fields in the packet
-// pass in pointer to start of adaptation field, return PCR as uint64
+// pass in the 6 bytes of PCR, just past the adaptation field flags, return PCR as uint64
 func extractPCR (adaptationData []byte) (pcr27Mhz uint64) {
 	top32Bits := (uint64(adaptationData[0]) << 24) +
 				(uint64(adaptationData[1])	   << 16) +
@@ -117,8 +138,8 @@ func takeBitrateSlice(pidStats *map[uint16]pidInfo, pcrNow uint64) {
 			packetDelta := info.packetCount - info.pktCountAtLastBitrateSlice
 			// TODO - PCRs wrap aouund ~ 26hours - cope with it!!!!!
 			pcrDelta27Mhz := pcrNow - info.pcr27MHzAtLastBitrateSlice
-			bitrate := ((188 * 8 * packetDelta) * 27000000) / (pcrDelta27Mhz + 1)
-			fmt.Printf("\n  PID known 0x%x  rate %v", pid, bitrate)
+			// TS rate, so just the 188 byte packets - any M2TS timestamps or RS parity are not counted
+			bitrate := ((tsPacketSize * 8 * packetDelta) * 27000000) / (pcrDelta27Mhz + 1)
 			info.pktCountAtLastBitrateSlice = info.packetCount
 			info.bitrate = bitrate
 			info.pcr27MHzAtLastBitrateSlice = pcrNow
@@ -126,66 +147,169 @@ func takeBitrateSlice(pidStats *map[uint16]pidInfo, pcrNow uint64) {
 		}
 }
 
-// Parse the data sent.  Data must be byte aligned
-// start with a 0x47 (ie the start of a TS packet must be first)
+// ErrNeedMoreData is returned by ParseTSDataBlob when it couldn't lock to the packets in a blob
+// without more of the stream to go on.  The unused bytes should be sent again with the data after them
+var ErrNeedMoreData = errors.New("tshelper: need more data to find sync")
+
+// Parse the data sent.  Data does not need to be aligned, the sync tracker hunts for
+// packet starts (0x47 every 188, 192 or 204 bytes) and carries on hunting whenever sync is lost
 // length of blob is number bytes passed in
+// dataParsed is the number of bytes used, any trailing partial packet is left for the caller
+// to send again with the rest of its data (see Demuxer, which does this for you)
+// err is a Diagnostics listing any SeverityError diagnostics raised, unless a DiagnosticSink has
+// been set.  Without a sink the info and warning ones are dropped.  It is ErrNeedMoreData when
+// no packets could be demuxed because the blob was too short to find sync in
 func (metaInfo tsdmx) ParseTSDataBlob(blobData []byte, blobLength uint64) (dataParsed uint64, err error) {
 	err = nil
 	dataParsed = 0
-	blobLength = (blobLength / 188) * 188 // must be multiple of TS packet length
 
-	if blobLength == 0 {
+	if blobLength < tsPacketSize {
 		err = errors.New(" TS parsing requires blob to be >= 188 bytes long ")
 	} else {
-		for packetToProcess := uint64(0); packetToProcess < blobLength; packetToProcess += 188 {
-			nextPacket := blobData[packetToProcess:(packetToProcess + 188)]
-			startOfPayload := uint8(4)
-			payloadLength  := uint8(184)
-			tsAdaptFields := new(tsAdaptInfo)
-			header := parseTSHeader (nextPacket)
-			pidData := metaInfo.pidStats[header.pid]
-			
-			if (header.adaptation & 0x2) == 0x2 {
-				adaptationLength := uint8(nextPacket[4])
-				if adaptationLength != 0 {
-					adaptationBitField := uint8(nextPacket[5])
-					parseTSAdaptFields(adaptationBitField, tsAdaptFields)
-					startOfPayload += (1 + adaptationLength);
-					payloadLength = 184 - (1 + adaptationLength);
-					if tsAdaptFields.pcrFlag != 0 {
-						pcr27Mhz := extractPCR(nextPacket[6:6+adaptationLength])
-						fmt.Printf(" \n PCR %v   at count %d   %d 0x%x %d", pcr27Mhz, pidData.packetCount, metaInfo.globalStats.pcrUsedForCrudeTimings, header.pid, 	metaInfo.globalStats.totalPackets )
-						if metaInfo.globalStats.pcrUsedForCrudeTimings == 0 {
-							metaInfo.globalStats.pcrUsedForCrudeTimings = header.pid
-						} else if metaInfo.globalStats.pcrUsedForCrudeTimings == header.pid {
-							takeBitrateSlice(&metaInfo.pidStats, pcr27Mhz)
-							pidData = metaInfo.pidStats[header.pid]
-						}
+		metaInfo.report.errs = nil
+		sync := metaInfo.sync
+		streamOffset := metaInfo.globalStats.bytesConsumed
+		packetsBefore := metaInfo.globalStats.totalPackets
+		rd := uint64(0)
+		for rd < blobLength {
+			if !sync.locked {
+				offset, format, found := sync.hunt(blobData[rd:blobLength])
+				if !found && rd == 0 && streamOffset == sync.huntStart {
+					// too short to hunt in, but if it is packets and nothing else take it as they come
+					if format, found = sync.alignedShort(blobData[:blobLength]); found {
+						offset = 0
 					}
 				}
+				rd += uint64(offset)
+				if !found {
+					break
+				}
+				sync.acquired(streamOffset + rd, metaInfo.globalStats.totalPackets, format)
+				metaInfo.report.raiseAt(Position{PacketIndex: metaInfo.globalStats.totalPackets, Offset: streamOffset + rd}, SeverityInfo, DiagSyncAcquired,
+					"locked to %v packets after skipping %d bytes", format, sync.events[len(sync.events)-1].Skipped)
+			}
+			unitSize := uint64(sync.format.unitSize())
+			syncOffset := uint64(sync.format.syncOffset())
+			if rd + unitSize > blobLength {
+				break
 			}
-			
-			if pidData.packetCount!= 0 {
-				expectedContCount := pidData.lastContCount
-				if (header.adaptation & 0x1) == 0x1 {
-					expectedContCount = (expectedContCount + 1) & 0xf;
+			packetStart := rd + syncOffset
+			if blobData[packetStart] != tsSyncByte {
+				// move on a byte, the packet we thought started here clearly doesn't
+				sync.lost(streamOffset + packetStart, streamOffset + rd + 1, metaInfo.globalStats.totalPackets)
+				metaInfo.report.raiseAt(Position{PacketIndex: metaInfo.globalStats.totalPackets, Offset: streamOffset + packetStart}, SeverityError, DiagSyncLost,
+					"expected sync byte, found 0x%x", blobData[packetStart])
+				rd += 1
+				continue
+			}
+			metaInfo.globalStats.arrivalTimestamp = 0
+			if sync.format == PacketFormatM2TS {
+				metaInfo.globalStats.arrivalTimestamp = extractArrivalTimestamp(blobData[rd:packetStart])
+			}
+			// for RS204 the parity after the packet is just skipped, we don't try to correct with it
+			metaInfo.report.position = Position{PacketIndex: metaInfo.globalStats.totalPackets, Offset: streamOffset + packetStart, UTC: metaInfo.tables.clock.utc(),
+				ArrivalTimestamp: metaInfo.globalStats.arrivalTimestamp}
+			metaInfo.processPacket(blobData[packetStart:(packetStart + tsPacketSize)])
+			rd += unitSize
+		}
+		dataParsed = rd
+		metaInfo.globalStats.bytesConsumed += rd
+		if len(metaInfo.report.errs) != 0 {
+			err = metaInfo.report.errs
+		} else if !sync.locked && metaInfo.globalStats.totalPackets == packetsBefore {
+			err = ErrNeedMoreData
+		}
+	}
+	return
+}
+
+// demux 1 aligned TS packet
+func (metaInfo tsdmx) processPacket(nextPacket []byte) {
+	startOfPayload := uint8(4)
+	payloadLength  := uint8(tsPacketSize - 4)
+	tsAdaptFields := new(tsAdaptInfo)
+	header := parseTSHeader (nextPacket)
+	pidData := metaInfo.pidStats[header.pid]
+	metaInfo.report.position.PID = header.pid
+	if pidData.packetCount == 0 {
+		event := &NewPIDEvent{Position: metaInfo.report.position}
+		for _, handler := range metaInfo.report.handlers {
+			handler.OnNewPID(event)
+		}
+	}
+	
+	if (header.adaptation & 0x2) == 0x2 {
+		adaptationLength := uint8(nextPacket[4])
+		if (header.adaptation & 0x1) == 0 && adaptationLength < 183 {
+			// adaptation only should fill the packet.  There's no payload either way, so what
+			// the field does hold is still used
+			metaInfo.report.raise(SeverityWarning, DiagBadAdaptationField, "adaptation_field_length %d in a packet with no payload, expected 183", adaptationLength)
+		}
+		if adaptationLength > 183 {
+			// can't be right, would run past the end of the packet. most likely a damaged
+			// packet that still happened to start 0x47 - keep the counts but use none of it
+			payloadLength = 0
+			adaptationLength = 0
+			startOfPayload = tsPacketSize
+			metaInfo.report.raise(SeverityError, DiagBadAdaptationField, "adaptation_field_length %d is longer than the packet", nextPacket[4])
+		}
+		if adaptationLength != 0 {
+			adaptationBitField := uint8(nextPacket[5])
+			parseTSAdaptFields(adaptationBitField, tsAdaptFields)
+			startOfPayload += (1 + adaptationLength);
+			payloadLength = (tsPacketSize - 4) - (1 + adaptationLength);
+			if tsAdaptFields.pcrFlag != 0 && adaptationLength < 7 {
+				metaInfo.report.raise(SeverityWarning, DiagBadAdaptationField, "PCR flag set but adaptation_field_length %d is too short to hold one", adaptationLength)
+			} else if tsAdaptFields.pcrFlag != 0 {
+				pcr27Mhz := extractPCR(nextPacket[6:12])
+				metaInfo.tables.timeline.lastPCR[header.pid] = pcr27Mhz
+				metaInfo.tables.clock.pcrSeen(header.pid, pcr27Mhz, tsAdaptFields.discontinuityFlag != 0)
+				event := &PCREvent{Position: metaInfo.report.position, PCR: pcr27Mhz, Discontinuity: tsAdaptFields.discontinuityFlag != 0}
+				for _, handler := range metaInfo.report.handlers {
+					handler.OnPCR(event)
 				}
-				if ((expectedContCount != header.contCount) && (tsAdaptFields.discontinuityFlag == 0)) {
-					pidData.contCountErrors += 1
+				if metaInfo.globalStats.pcrUsedForCrudeTimings == 0 {
+					metaInfo.globalStats.pcrUsedForCrudeTimings = header.pid
+				} else if metaInfo.globalStats.pcrUsedForCrudeTimings == header.pid {
+					takeBitrateSlice(&metaInfo.pidStats, pcr27Mhz)
+					pidData = metaInfo.pidStats[header.pid]
 				}
 			}
-			pidData.lastContCount = header.contCount
-			pidData.packetCount += 1
-			
-			metaInfo.tables.checkForSiPsi(header.pid, header.payloadUnitStart, payloadLength, nextPacket[startOfPayload:] )
-
-			metaInfo.globalStats.totalPackets += 1
-			metaInfo.pidStats[header.pid] = pidData
-
-			//fmt.Printf(" sync 0x%x  payloadLength %v", header.syncByte, payloadLength)
 		}
 	}
-	return
+	
+	ccError := false
+	if pidData.packetCount!= 0 {
+		expectedContCount := pidData.lastContCount
+		if (header.adaptation & 0x1) == 0x1 {
+			expectedContCount = (expectedContCount + 1) & 0xf;
+		}
+		if ((expectedContCount != header.contCount) && (tsAdaptFields.discontinuityFlag == 0)) {
+			pidData.contCountErrors += 1
+			ccError = true
+			metaInfo.report.raise(SeverityError, DiagContinuityError, "continuity counter %d, expected %d", header.contCount, expectedContCount)
+			event := &ContinuityErrorEvent{Position: metaInfo.report.position, Expected: expectedContCount, Found: header.contCount}
+			for _, handler := range metaInfo.report.handlers {
+				handler.OnContinuityError(event)
+			}
+		}
+	}
+	pidData.lastContCount = header.contCount
+	pidData.packetCount += 1
+	pidData.lastArrivalTimestamp = metaInfo.globalStats.arrivalTimestamp
+	
+	if (header.adaptation & 0x1) == 0 {
+		payloadLength = 0
+	}
+	if payloadLength != 0 {
+		metaInfo.tables.checkForSiPsi(header.pid, header.payloadUnitStart, ccError, nextPacket[startOfPayload:] )
+		if _, isES := metaInfo.tables.elementaryStreams[header.pid]; isES {
+			metaInfo.assemblePES(header.pid, header.payloadUnitStart, ccError, tsAdaptFields.discontinuityFlag != 0, nextPacket[startOfPayload:], &pidData)
+		}
+	}
+
+	metaInfo.globalStats.totalPackets += 1
+	metaInfo.pidStats[header.pid] = pidData
 }
 
 
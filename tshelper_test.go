@@ -0,0 +1,83 @@
+package tshelper
+
+import (
+	"reflect"
+	"testing"
+)
+
+// the PCR is read from its own 6 bytes, however long the adaptation field is, and a packet that
+// is all adaptation field can end the blob
+func TestPCR(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		pcr     uint64
+		payload []byte
+	}{
+		{"zero", 0, make([]byte, 176)},
+		{"extension only", 299, make([]byte, 176)},
+		{"1 second", 27000000, make([]byte, 176)},
+		{"largest", (1<<33-1)*300 + 299, make([]byte, 176)},
+		{"adaptation only, ending the blob", 27000000, nil},
+		{"adaptation with stuffing", 54000000, make([]byte, 100)},
+	} {
+		stream := newTestStream()
+		stream.padding(3)
+		stream.packet(0x100, false, testPCRAdaptation(test.pcr), test.payload)
+		dmx := Newtsdmx()
+		events := &testEvents{}
+		dmx.AddHandler(events)
+		blob := stream.data[:len(stream.data):len(stream.data)]
+		if _, err := dmx.ParseTSDataBlob(blob, uint64(len(blob))); err != nil {
+			t.Fatalf("%s: ParseTSDataBlob: %v", test.name, err)
+		}
+		var pcrs []uint64
+		for _, event := range events.pcrs {
+			pcrs = append(pcrs, event.PCR)
+		}
+		if !reflect.DeepEqual(pcrs, []uint64{test.pcr}) {
+			t.Errorf("%s: PCRs %v, expected [%d]", test.name, pcrs, test.pcr)
+		}
+	}
+}
+
+// adaptation_field_length is used as sent and never runs past the packet
+func TestAdaptationFieldLengths(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		control uint8 // adaptation_field_control
+		length  uint8
+		bad     bool // a BadAdaptationField diagnostic is expected
+		pcr     bool
+	}{
+		{"adaptation only, full", 0x2, 183, false, true},
+		{"adaptation only, short", 0x2, 7, true, true},
+		{"adaptation only, too long", 0x2, 200, true, false},
+		{"with payload, too long", 0x3, 184, true, false},
+		{"PCR flag, too short", 0x3, 3, true, false},
+	} {
+		stream := newTestStream()
+		stream.padding(3)
+		packet := make([]byte, tsPacketSize)
+		for i := range packet {
+			packet[i] = 0xff
+		}
+		packet[0], packet[1], packet[2], packet[3] = 0x47, 0x01, 0x00, test.control<<4
+		packet[4] = test.length
+		copy(packet[5:], testPCRAdaptation(27000000))
+		stream.data = append(stream.data, packet...)
+
+		dmx := Newtsdmx()
+		diagnostics := &testDiagnostics{}
+		dmx.SetDiagnosticSink(diagnostics.sink)
+		events := &testEvents{}
+		dmx.AddHandler(events)
+		blob := stream.data[:len(stream.data):len(stream.data)]
+		dmx.ParseTSDataBlob(blob, uint64(len(blob)))
+		if bad := diagnostics.count(DiagBadAdaptationField) == 1; bad != test.bad {
+			t.Errorf("%s: diagnostics %v", test.name, *diagnostics)
+		}
+		if pcr := len(events.pcrs) == 1; pcr != test.pcr {
+			t.Errorf("%s: %d PCR events", test.name, len(events.pcrs))
+		}
+	}
+}